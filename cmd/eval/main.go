@@ -0,0 +1,387 @@
+// Command eval measures scan accuracy on labelled ticket photos with and
+// without image preprocessing.
+//
+// Every image in -dir (jpg, png, webp, heic or pdf) needs a sidecar
+// <name>.json holding the expected card as
+// {"blocks": [{"row1": [...], "row2": [...], "row3": [...]}]}.
+// Providers are configured from the environment exactly as for the server.
+//
+//	go run ./cmd/eval -dir test -runs 3
+//
+// With -server the images are scanned by a running server instead, through
+// internal/client, with the API key in -api-key or an anonymous device
+// account; -strict then makes any inexact or failed scan exit non-zero.
+//
+//	go run ./cmd/eval -dir test -server http://localhost:8080 -strict
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/joho/godotenv"
+	"go.uber.org/zap"
+
+	"loto/internal/ai"
+	"loto/internal/client"
+	"loto/internal/config"
+	"loto/internal/model"
+	"loto/internal/ocr"
+	"loto/internal/preprocess"
+	"loto/internal/prompt"
+	"loto/internal/scan"
+)
+
+type expected struct {
+	Blocks []model.Block `json:"blocks"`
+}
+
+type outcome struct {
+	exact   bool
+	cells   int
+	total   int
+	latency time.Duration
+	steps   []string
+	err     error
+}
+
+type pipeline struct {
+	ai     ai.Scanner
+	hybrid *scan.HybridScanner
+}
+
+func main() {
+	dir := flag.String("dir", "test", "directory with images and <name>.json expectations")
+	runs := flag.Int("runs", 1, "scans per image and mode")
+	server := flag.String("server", "", "scan through the API of this server instead of in process")
+	apiKey := flag.String("api-key", os.Getenv("LOTO_API_KEY"), "API key for -server; a device account is used when empty")
+	strict := flag.Bool("strict", false, "with -server, exit 1 unless every scan is exact")
+	flag.Parse()
+
+	_ = godotenv.Load()
+	logger := zap.NewNop()
+
+	if *server != "" {
+		images, err := listImages(*dir)
+		if err != nil {
+			fatal("%v", err)
+		}
+		if len(images) == 0 {
+			fatal("no labelled images in %s", *dir)
+		}
+		if !evalServer(context.Background(), *server, *apiKey, images, *runs) && *strict {
+			os.Exit(1)
+		}
+		return
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		fatal("load config: %v", err)
+	}
+
+	ctx := context.Background()
+	p, cleanup, err := newPipeline(ctx, cfg, logger)
+	if err != nil {
+		fatal("%v", err)
+	}
+	defer cleanup()
+
+	images, err := listImages(*dir)
+	if err != nil {
+		fatal("%v", err)
+	}
+	if len(images) == 0 {
+		fatal("no labelled images in %s", *dir)
+	}
+
+	preCfg := cfg.Preprocess
+	preCfg.Enabled = true
+	pre := preprocess.New(preCfg)
+	totals := map[bool][]outcome{}
+
+	fmt.Printf("%-32s %-6s %-6s %-9s %-9s %s\n", "image", "mode", "exact", "cells", "latency", "steps")
+	for _, path := range images {
+		want, err := loadExpected(path)
+		if err != nil {
+			fatal("%v", err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fatal("%v", err)
+		}
+
+		for _, withPre := range []bool{false, true} {
+			for i := 0; i < *runs; i++ {
+				o := p.run(ctx, pre, data, withPre, want)
+				totals[withPre] = append(totals[withPre], o)
+				printOutcome(filepath.Base(path), preLabel(withPre), o)
+			}
+		}
+	}
+
+	fmt.Println()
+	for _, withPre := range []bool{false, true} {
+		label := "without preprocessing"
+		if withPre {
+			label = "with preprocessing"
+		}
+		printSummary(label, totals[withPre])
+	}
+}
+
+func preLabel(withPre bool) string {
+	if withPre {
+		return "pre"
+	}
+	return "raw"
+}
+
+// evalServer scans every image through the API and reports whether all
+// scans were exact.
+func evalServer(ctx context.Context, baseURL, apiKey string, images []string, runs int) bool {
+	c := client.New(baseURL)
+	c.APIKey = apiKey
+	if apiKey == "" {
+		auth, err := c.DeviceLogin(ctx, model.DeviceRequest{DeviceID: "eval-" + uuid.NewString()})
+		if err != nil {
+			fatal("device login: %v", err)
+		}
+		c.AccessToken = auth.AccessToken
+	}
+
+	var outcomes []outcome
+	fmt.Printf("%-32s %-6s %-6s %-9s %-9s %s\n", "image", "mode", "exact", "cells", "latency", "steps")
+	for _, path := range images {
+		want, err := loadExpected(path)
+		if err != nil {
+			fatal("%v", err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fatal("%v", err)
+		}
+		for i := 0; i < runs; i++ {
+			var o outcome
+			start := time.Now()
+			resp, err := c.ScanTicket(ctx, client.ScanTicketForm{Image: client.File{Name: filepath.Base(path), Data: data}})
+			o.latency = time.Since(start)
+			if err != nil {
+				o.err = err
+			} else {
+				o.steps = resp.Preprocessing
+				o.cells, o.total = matchCells(resp.Blocks, want.Blocks)
+				o.exact = o.cells == o.total && countCells(resp.Blocks) == o.total
+			}
+			outcomes = append(outcomes, o)
+			printOutcome(filepath.Base(path), "server", o)
+		}
+	}
+
+	fmt.Println()
+	printSummary("server", outcomes)
+	for _, o := range outcomes {
+		if o.err != nil || !o.exact {
+			return false
+		}
+	}
+	return true
+}
+
+func newPipeline(ctx context.Context, cfg *config.Config, logger *zap.Logger) (*pipeline, func(), error) {
+	prompts, err := prompt.Load(cfg.Prompt.Version, cfg.Prompt.Experiment)
+	if err != nil {
+		return nil, nil, fmt.Errorf("load prompts: %w", err)
+	}
+
+	p := &pipeline{}
+	switch cfg.AIProvider {
+	case "google", "gemini":
+		client, err := ai.NewGeminiClient(ctx, cfg.GoogleAI, prompts, logger)
+		if err != nil {
+			return nil, nil, fmt.Errorf("create Gemini client: %w", err)
+		}
+		p.ai = client
+	default:
+		p.ai = ai.NewClient(cfg.OpenAI, prompts, logger)
+	}
+
+	cleanup := func() {}
+	if cfg.Vision.Enabled {
+		ocrScanner, err := ocr.New(cfg.Vision, logger)
+		if err != nil {
+			return nil, nil, fmt.Errorf("create OCR scanner: %w", err)
+		}
+		p.hybrid = scan.NewHybridScanner(ocrScanner, p.ai, cfg.Vision.Hybrid, logger)
+		p.hybrid.SetMaxPixels(cfg.Preprocess.MaxPixels)
+		if cfg.Vision.Hybrid.DigitVote {
+			templates, err := ocr.LoadDigitTemplates(cfg.Vision.Digits.Templates)
+			if err != nil {
+				return nil, nil, fmt.Errorf("load digit templates: %w", err)
+			}
+			p.hybrid.SetDigitClassifier(ocr.NewDigitClassifier(templates))
+		}
+		cleanup = func() { ocrScanner.Close() }
+	}
+	return p, cleanup, nil
+}
+
+func (p *pipeline) run(ctx context.Context, pre *preprocess.Preprocessor, data []byte, withPre bool, want expected) outcome {
+	var o outcome
+	data, mimeType, err := pre.Normalize(data, preprocess.DetectContentType(data))
+	if err != nil {
+		return outcome{err: err}
+	}
+	if withPre {
+		res, err := pre.Process(data, mimeType)
+		if err != nil {
+			return outcome{err: err}
+		}
+		data, mimeType, o.steps = res.Data, res.MimeType, res.Steps
+	}
+
+	b64 := base64.StdEncoding.EncodeToString(data)
+	start := time.Now()
+	var resp *model.GPTScanResponse
+	if p.hybrid != nil {
+		resp, err = p.hybrid.Scan(ctx, data, b64, mimeType)
+	} else {
+		resp, err = p.ai.ScanTicket(ctx, b64, mimeType)
+	}
+	o.latency = time.Since(start)
+	if err != nil {
+		o.err = err
+		return o
+	}
+	scan.ApplyCorrections(resp)
+
+	o.cells, o.total = matchCells(resp.Blocks, want.Blocks)
+	o.exact = o.cells == o.total && countCells(resp.Blocks) == o.total
+	return o
+}
+
+// matchCells counts expected numbers found in the same block and row.
+func matchCells(got, want []model.Block) (int, int) {
+	var matched, total int
+	for b, block := range want {
+		wantRows := [][]int{block.Row1, block.Row2, block.Row3}
+		var gotRows [][]int
+		if b < len(got) {
+			gotRows = [][]int{got[b].Row1, got[b].Row2, got[b].Row3}
+		}
+		for r, row := range wantRows {
+			total += len(row)
+			if r >= len(gotRows) {
+				continue
+			}
+			for _, n := range row {
+				if slices.Contains(gotRows[r], n) {
+					matched++
+				}
+			}
+		}
+	}
+	return matched, total
+}
+
+func countCells(blocks []model.Block) int {
+	n := 0
+	for _, b := range blocks {
+		n += len(b.Row1) + len(b.Row2) + len(b.Row3)
+	}
+	return n
+}
+
+func listImages(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, e := range entries {
+		ext := strings.ToLower(filepath.Ext(e.Name()))
+		if e.IsDir() || !imageExts[ext] {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		if _, err := os.Stat(sidecar(path)); err == nil {
+			out = append(out, path)
+		}
+	}
+	return out, nil
+}
+
+var imageExts = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".webp": true, ".heic": true, ".pdf": true,
+}
+
+func sidecar(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".json"
+}
+
+func loadExpected(path string) (expected, error) {
+	var want expected
+	data, err := os.ReadFile(sidecar(path))
+	if err != nil {
+		return want, err
+	}
+	if err := json.Unmarshal(data, &want); err != nil {
+		return want, fmt.Errorf("%s: %w", sidecar(path), err)
+	}
+	return want, nil
+}
+
+func printOutcome(name, mode string, o outcome) {
+	if o.err != nil {
+		fmt.Printf("%-32s %-6s error: %v\n", name, mode, o.err)
+		return
+	}
+	fmt.Printf("%-32s %-6s %-6t %-9s %-9s %s\n",
+		name, mode, o.exact,
+		fmt.Sprintf("%d/%d", o.cells, o.total),
+		o.latency.Round(time.Millisecond),
+		strings.Join(o.steps, " "),
+	)
+}
+
+func printSummary(label string, outcomes []outcome) {
+	var exact, cells, total, failed int
+	var latency time.Duration
+	for _, o := range outcomes {
+		if o.err != nil {
+			failed++
+			continue
+		}
+		if o.exact {
+			exact++
+		}
+		cells += o.cells
+		total += o.total
+		latency += o.latency
+	}
+	ok := len(outcomes) - failed
+	if ok == 0 || total == 0 {
+		fmt.Printf("%-22s all %d scans failed\n", label, len(outcomes))
+		return
+	}
+	fmt.Printf("%-22s exact %d/%d  cells %.1f%%  avg latency %s  failed %d\n",
+		label, exact, ok,
+		100*float64(cells)/float64(total),
+		(latency / time.Duration(ok)).Round(time.Millisecond),
+		failed,
+	)
+}
+
+func fatal(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "eval: "+format+"\n", args...)
+	os.Exit(1)
+}
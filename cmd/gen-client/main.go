@@ -0,0 +1,267 @@
+// Command gen-client writes the operations of internal/client from the
+// OpenAPI document in internal/openapi. It is run by go generate:
+//
+//	go generate ./internal/client
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"os"
+	"sort"
+	"strings"
+
+	"loto/internal/openapi"
+)
+
+func main() {
+	out := flag.String("o", "operations.go", "output file")
+	flag.Parse()
+
+	doc, err := openapi.Load()
+	if err != nil {
+		fatal("parse openapi.json: %v", err)
+	}
+	src, err := generate(doc)
+	if err != nil {
+		fatal("%v", err)
+	}
+	if err := os.WriteFile(*out, src, 0o644); err != nil {
+		fatal("%v", err)
+	}
+}
+
+type operation struct {
+	method, path string
+	*openapi.Operation
+}
+
+func generate(doc *openapi.Document) ([]byte, error) {
+	var ops []operation
+	for path, item := range doc.Paths {
+		for method, op := range item {
+			if op.OperationID == "" {
+				return nil, fmt.Errorf("%s %s has no operationId", strings.ToUpper(method), path)
+			}
+			ops = append(ops, operation{strings.ToUpper(method), path, op})
+		}
+	}
+	sort.Slice(ops, func(i, j int) bool { return ops[i].OperationID < ops[j].OperationID })
+
+	var body bytes.Buffer
+	for _, op := range ops {
+		if err := writeOperation(&body, op); err != nil {
+			return nil, fmt.Errorf("%s: %w", op.OperationID, err)
+		}
+	}
+
+	var b bytes.Buffer
+	b.WriteString("// Code generated by gen-client from internal/openapi/openapi.json. DO NOT EDIT.\n\n")
+	b.WriteString("package client\n\nimport (\n\"context\"\n")
+	for _, pkg := range []string{"encoding/json", "net/url"} {
+		if bytes.Contains(body.Bytes(), []byte(pkg[strings.LastIndex(pkg, "/")+1:]+".")) {
+			fmt.Fprintf(&b, "%q\n", pkg)
+		}
+	}
+	b.WriteString("\n\"loto/internal/model\"\n)\n")
+	b.Write(body.Bytes())
+	return format.Source(b.Bytes())
+}
+
+func writeOperation(b *bytes.Buffer, op operation) error {
+	name := op.OperationID
+	args := []string{"ctx context.Context"}
+
+	// Path parameters become arguments, query parameters a Params struct.
+	var query []openapi.Parameter
+	for _, p := range op.Parameters {
+		switch p.In {
+		case "path":
+			args = append(args, lowerName(p.Name)+" string")
+		case "query":
+			query = append(query, p)
+		default:
+			return fmt.Errorf("unsupported parameter location %q", p.In)
+		}
+	}
+	if len(query) > 0 {
+		fmt.Fprintf(b, "\n// %sParams are the query parameters of %s.\ntype %sParams struct {\n", name, name, name)
+		for _, p := range query {
+			fmt.Fprintf(b, "%s string\n", goName(p.Name))
+		}
+		fmt.Fprintf(b, "}\n\nfunc (p %sParams) values() url.Values {\nq := url.Values{}\n", name)
+		for _, p := range query {
+			fmt.Fprintf(b, "if p.%s != \"\" {\nq.Set(%q, p.%s)\n}\n", goName(p.Name), p.Name, goName(p.Name))
+		}
+		b.WriteString("return q\n}\n")
+		args = append(args, "params "+name+"Params")
+	}
+
+	body := "nil"
+	if rb := op.RequestBody; rb != nil {
+		if mt, ok := rb.Content["application/json"]; ok {
+			ref := mt.Schema.RefName()
+			if ref == "" {
+				return fmt.Errorf("json request body must be a $ref")
+			}
+			args = append(args, "req model."+ref)
+			body = "req"
+		} else if mt, ok := rb.Content["multipart/form-data"]; ok {
+			if err := writeForm(b, name, mt.Schema); err != nil {
+				return err
+			}
+			args = append(args, "form "+name+"Form")
+			body = "form.parts()"
+		} else {
+			return fmt.Errorf("unsupported request body")
+		}
+	}
+
+	result, err := successType(op.Responses)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(b, "\n// %s calls %s %s: %s.\n", name, op.method, op.path, lowerFirst(op.Summary))
+	returns := "error"
+	if result != "" {
+		returns = "(" + result + ", error)"
+	}
+	fmt.Fprintf(b, "func (c *Client) %s(%s) %s {\n", name, strings.Join(args, ", "), returns)
+
+	queryArg := "nil"
+	if len(query) > 0 {
+		queryArg = "params.values()"
+	}
+	call := fmt.Sprintf("c.do(ctx, %q, %s, %s, %s, ", op.method, pathExpr(op.path), queryArg, body)
+	switch {
+	case result == "":
+		fmt.Fprintf(b, "return %snil)\n}\n", call)
+	case strings.HasPrefix(result, "*"):
+		fmt.Fprintf(b, "var out %s\nif err := %s&out); err != nil {\nreturn nil, err\n}\nreturn &out, nil\n}\n", result[1:], call)
+	default:
+		fmt.Fprintf(b, "var out %s\nif err := %s&out); err != nil {\nreturn nil, err\n}\nreturn out, nil\n}\n", result, call)
+	}
+	return nil
+}
+
+// writeForm declares the multipart form of an operation: binary fields are
+// Files, the others strings.
+func writeForm(b *bytes.Buffer, name string, s *openapi.Schema) error {
+	props := make([]string, 0, len(s.Properties))
+	for p := range s.Properties {
+		props = append(props, p)
+	}
+	sort.Strings(props)
+
+	fmt.Fprintf(b, "\n// %sForm is the multipart form of %s.\ntype %sForm struct {\n", name, name, name)
+	for _, p := range props {
+		ps := s.Properties[p]
+		switch {
+		case ps.Format == "binary":
+			fmt.Fprintf(b, "%s File\n", goName(p))
+		case ps.Type == "array" && ps.Items != nil && ps.Items.Format == "binary":
+			fmt.Fprintf(b, "%s []File\n", goName(p))
+		case ps.Type == "string":
+			fmt.Fprintf(b, "%s string\n", goName(p))
+		default:
+			return fmt.Errorf("unsupported form field %s", p)
+		}
+	}
+	fmt.Fprintf(b, "}\n\nfunc (f %sForm) parts() []part {\nreturn []part{\n", name)
+	for _, p := range props {
+		ps := s.Properties[p]
+		switch {
+		case ps.Format == "binary":
+			fmt.Fprintf(b, "{name: %q, files: []File{f.%s}},\n", p, goName(p))
+		case ps.Type == "array":
+			fmt.Fprintf(b, "{name: %q, files: f.%s},\n", p, goName(p))
+		default:
+			fmt.Fprintf(b, "{name: %q, value: f.%s},\n", p, goName(p))
+		}
+	}
+	b.WriteString("}\n}\n")
+	return nil
+}
+
+// successType returns the Go type of the first 2xx response, "" when it has
+// no body.
+func successType(responses map[string]*openapi.Response) (string, error) {
+	codes := make([]string, 0, len(responses))
+	for code := range responses {
+		if strings.HasPrefix(code, "2") {
+			codes = append(codes, code)
+		}
+	}
+	if len(codes) == 0 {
+		return "", fmt.Errorf("no success response")
+	}
+	sort.Strings(codes)
+
+	mt, ok := responses[codes[0]].Content["application/json"]
+	if !ok {
+		return "", nil
+	}
+	if ref := mt.Schema.RefName(); ref != "" {
+		return "*model." + ref, nil
+	}
+	return "json.RawMessage", nil
+}
+
+// pathExpr turns /a/{id}/b into "/a/" + url.PathEscape(id) + "/b".
+func pathExpr(path string) string {
+	var parts []string
+	for {
+		start := strings.Index(path, "{")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(path, "}")
+		if start > 0 {
+			parts = append(parts, fmt.Sprintf("%q", path[:start]))
+		}
+		parts = append(parts, "url.PathEscape("+lowerName(path[start+1:end])+")")
+		path = path[end+1:]
+	}
+	if path != "" {
+		parts = append(parts, fmt.Sprintf("%q", path))
+	}
+	return strings.Join(parts, " + ")
+}
+
+var initialisms = map[string]string{"id": "ID", "api": "API", "url": "URL"}
+
+// goName turns snake_case into an exported Go name.
+func goName(s string) string {
+	var out strings.Builder
+	for _, w := range strings.Split(s, "_") {
+		if up, ok := initialisms[w]; ok {
+			out.WriteString(up)
+		} else if w != "" {
+			out.WriteString(strings.ToUpper(w[:1]) + w[1:])
+		}
+	}
+	return out.String()
+}
+
+func lowerName(s string) string {
+	name := goName(s)
+	if up, ok := initialisms[strings.ToLower(name)]; ok && up == name {
+		return strings.ToLower(name)
+	}
+	return lowerFirst(name)
+}
+
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToLower(s[:1]) + s[1:]
+}
+
+func fatal(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "gen-client: "+format+"\n", args...)
+	os.Exit(1)
+}
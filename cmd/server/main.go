@@ -2,7 +2,10 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/base64"
 	"errors"
+	"flag"
 	"fmt"
 	"net/http"
 	"os"
@@ -13,20 +16,43 @@ import (
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
 	"go.uber.org/zap"
 
 	"loto/internal/ai"
+	"loto/internal/auth"
 	"loto/internal/config"
 	"loto/internal/handler"
+	"loto/internal/model"
 	"loto/internal/ocr"
-	"loto/internal/repository"
+	"loto/internal/openapi"
+	"loto/internal/preprocess"
+	"loto/internal/pricing"
+	"loto/internal/prompt"
+	"loto/internal/ratelimit"
 	"loto/internal/scan"
 	"loto/internal/service"
 )
 
 func main() {
+	checkOpenAPI := flag.Bool("check-openapi", false, "check internal/openapi/openapi.json against the routes and models, then exit")
+	checkStorage := flag.String("check-storage", "", "run the storage conformance checks against a comma-separated list of backends (memory, sqlite, postgres), then exit")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags]\n       %s migrate up|down [steps]|status\n\nflags:\n", os.Args[0], os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *checkOpenAPI {
+		gin.SetMode(gin.ReleaseMode)
+		router := setupRouter(handler.New(nil, zap.NewNop()), &config.Config{}, nil)
+		if err := openapi.Verify(router.Routes()); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Println("openapi.json matches the routes and models")
+		return
+	}
+
 	logCfg := zap.NewProductionConfig()
 	logCfg.OutputPaths = []string{"stdout"}
 	logCfg.ErrorOutputPaths = []string{"stderr"}
@@ -46,13 +72,37 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	if *checkStorage != "" {
+		if err := runStorageCheck(ctx, cfg.Database, *checkStorage, logger); err != nil {
+			logger.Fatal("storage check failed", zap.Error(err))
+		}
+		return
+	}
+
+	if flag.Arg(0) == "migrate" {
+		if err := runMigrate(ctx, cfg.Database, flag.Args()[1:], logger); err != nil {
+			logger.Fatal("migration failed", zap.Error(err))
+		}
+		return
+	}
+
+	prompts, err := prompt.Load(cfg.Prompt.Version, cfg.Prompt.Experiment)
+	if err != nil {
+		logger.Fatal("failed to load prompts", zap.Error(err))
+	}
+	logger.Info("prompts loaded",
+		zap.Strings("versions", prompts.Versions()),
+		zap.String("default", prompts.Default()),
+		zap.String("experiment", cfg.Prompt.Experiment),
+	)
+
 	var aiClient ai.Scanner
 	switch cfg.AIProvider {
 	case "google", "gemini":
 		if cfg.GoogleAI.APIKey == "" {
 			logger.Fatal("GOOGLE_API_KEY is required when AI_PROVIDER=google")
 		}
-		geminiClient, err := ai.NewGeminiClient(ctx, cfg.GoogleAI, logger)
+		geminiClient, err := ai.NewGeminiClient(ctx, cfg.GoogleAI, prompts, logger)
 		if err != nil {
 			logger.Fatal("failed to create Gemini client", zap.Error(err))
 		}
@@ -62,42 +112,92 @@ func main() {
 		if cfg.OpenAI.APIKey == "" {
 			logger.Fatal("OPENAI_API_KEY is required when AI_PROVIDER=openai")
 		}
-		aiClient = ai.NewClient(cfg.OpenAI, logger)
+		aiClient = ai.NewClient(cfg.OpenAI, prompts, logger)
 		logger.Info("using OpenAI provider", zap.String("model", cfg.OpenAI.Model))
 	}
 
-	var repo *repository.Repository
-	pool, err := pgxpool.New(ctx, cfg.Database.DSN())
+	store, pool, closeStore, err := openStore(ctx, cfg.Database, logger)
 	if err != nil {
-		logger.Warn("database not available, running without persistence", zap.Error(err))
-	} else if err := pool.Ping(ctx); err != nil {
-		logger.Warn("database not reachable, running without persistence", zap.Error(err))
-		pool.Close()
-	} else {
-		logger.Info("connected to database")
-		repo = repository.New(pool)
-		defer pool.Close()
+		logger.Fatal("failed to open storage", zap.Error(err))
 	}
+	defer closeStore()
 
 	var hybridScanner *scan.HybridScanner
 	if cfg.Vision.Enabled {
-		ocrScanner, err := ocr.NewGoogleVisionScanner(cfg.Vision.CredentialsFile, logger)
+		ocrScanner, err := ocr.New(cfg.Vision, logger)
 		if err != nil {
-			logger.Warn("Google Vision not available, using AI-only mode", zap.Error(err))
+			logger.Warn("OCR not available, using AI-only mode", zap.String("provider", cfg.Vision.Provider), zap.Error(err))
 		} else {
-			hybridScanner = scan.NewHybridScanner(ocrScanner, aiClient, logger)
-			logger.Info("hybrid scanner enabled (OCR + AI)")
+			hybridScanner = scan.NewHybridScanner(ocrScanner, aiClient, cfg.Vision.Hybrid, logger)
+			hybridScanner.SetMaxPixels(cfg.Preprocess.MaxPixels)
+			if cfg.Vision.Hybrid.DigitVote {
+				templates, err := ocr.LoadDigitTemplates(cfg.Vision.Digits.Templates)
+				if err != nil {
+					logger.Fatal("failed to load digit templates", zap.Error(err))
+				}
+				hybridScanner.SetDigitClassifier(ocr.NewDigitClassifier(templates))
+			}
+			logger.Info("hybrid scanner enabled (OCR + AI)",
+				zap.String("ocr_provider", cfg.Vision.Provider),
+				zap.String("strategy", cfg.Vision.Hybrid.Strategy),
+				zap.Float64("agreement_threshold", cfg.Vision.Hybrid.AgreementThreshold),
+				zap.Bool("digit_vote", cfg.Vision.Hybrid.DigitVote),
+				zap.Int("region_workers", cfg.Vision.Hybrid.RegionWorkers),
+			)
 			defer ocrScanner.Close()
 		}
 	}
 
-	svc := service.New(repo, aiClient, logger)
+	if cfg.Auth.JWTSecret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			logger.Fatal("failed to generate JWT secret", zap.Error(err))
+		}
+		cfg.Auth.JWTSecret = base64.RawURLEncoding.EncodeToString(secret)
+		logger.Warn("JWT_SECRET not set, using a random secret: tokens will not survive a restart")
+	}
+	tokens, err := auth.NewTokens(cfg.Auth)
+	if err != nil {
+		logger.Fatal("invalid auth config", zap.Error(err))
+	}
+
+	prices, err := pricing.Load(cfg.Pricing.File)
+	if err != nil {
+		logger.Fatal("failed to load price table", zap.Error(err))
+	}
+
+	svc := service.New(store, aiClient, logger)
+	svc.SetPriceTable(prices)
+	svc.SetPrompts(prompts)
+	svc.SetPreprocessor(preprocess.New(cfg.Preprocess))
+	svc.SetBatchConfig(cfg.Batch)
+	svc.SetTokens(tokens)
+	if cfg.Preprocess.Enabled {
+		logger.Info("image preprocessing enabled",
+			zap.Strings("steps", cfg.Preprocess.Steps),
+			zap.Int("max_dimension", cfg.Preprocess.MaxDimension),
+		)
+	}
 	if hybridScanner != nil {
 		svc.SetHybridScanner(hybridScanner)
 	}
 	h := handler.New(svc, logger)
+	if cfg.RateLimit.Enabled {
+		var limits ratelimit.Store = ratelimit.NewMemoryStore()
+		if cfg.RateLimit.Store == "postgres" {
+			if pool == nil {
+				logger.Warn("RATE_LIMIT_STORE=postgres needs the Postgres database, keeping limits in memory")
+			} else {
+				pgStore := ratelimit.NewPostgresStore(pool)
+				go cleanupRateLimits(ctx, pgStore, logger)
+				limits = pgStore
+			}
+		}
+		h.SetLimiter(ratelimit.New(limits, cfg.RateLimit))
+		logger.Info("rate limiting enabled", zap.String("store", cfg.RateLimit.Store))
+	}
 
-	router := setupRouter(h, cfg.Server.MaxUploadSizeMB)
+	router := setupRouter(h, cfg, tokens)
 
 	srv := &http.Server{
 		Addr:         fmt.Sprintf(":%s", cfg.Server.Port),
@@ -129,10 +229,17 @@ func main() {
 	logger.Info("server stopped")
 }
 
-func setupRouter(h *handler.Handler, maxUploadMB int64) *gin.Engine {
+func setupRouter(h *handler.Handler, cfg *config.Config, tokens *auth.Tokens) *gin.Engine {
 	router := gin.Default()
+	router.Use(handler.RequestID())
+	router.NoRoute(handler.RouteNotFound)
 
-	router.MaxMultipartMemory = maxUploadMB << 20
+	router.MaxMultipartMemory = cfg.Server.MaxUploadSizeMB << 20
+	if len(cfg.Server.TrustedProxies) > 0 {
+		if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+			panic(fmt.Sprintf("invalid TRUSTED_PROXIES: %v", err))
+		}
+	}
 
 	corsOrigins := []string{"http://localhost:8081", "http://localhost:19006"}
 	if extra := os.Getenv("CORS_ORIGINS"); extra != "" {
@@ -140,19 +247,70 @@ func setupRouter(h *handler.Handler, maxUploadMB int64) *gin.Engine {
 	}
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     corsOrigins,
-		AllowMethods:     []string{"GET", "POST", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type"},
+		AllowMethods:     []string{"GET", "POST", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "X-API-Key", "X-Request-ID"},
+		ExposeHeaders:    []string{"X-Request-ID"},
 		AllowCredentials: false,
 	}))
 
 	router.GET("/health", h.HealthCheck)
+	router.GET("/api/v1/openapi.json", handler.OpenAPI)
 
-	api := router.Group("/api/v1")
+	accounts := router.Group("/api/v1/auth", h.RateLimit())
 	{
-		api.POST("/scan-ticket", h.ScanTicket)
-		api.GET("/scan-history", h.GetScanHistory)
-		api.GET("/check-result", h.CheckResult)
+		accounts.POST("/register", h.Register)
+		accounts.POST("/login", h.Login)
+		accounts.POST("/device", h.DeviceLogin)
+		accounts.POST("/refresh", h.Refresh)
+		accounts.POST("/logout", h.Logout)
+	}
+
+	api := router.Group("/api/v1", h.RateLimit(), h.RequireAuth(tokens), h.RateLimit())
+	{
+		account := api.Group("/auth", handler.RequireScope(model.ScopeAccount))
+		account.GET("/me", h.Me)
+		account.POST("/upgrade", h.UpgradeAccount)
+
+		scans := api.Group("", handler.RequireScope(model.ScopeScanWrite))
+		scans.POST("/scan-ticket", h.ScanTicket)
+		scans.POST("/scan-tickets", h.ScanTickets)
+		scans.POST("/scan-tickets/batch", h.StartBatch)
+
+		results := api.Group("", handler.RequireScope(model.ScopeResultsRead))
+		results.GET("/scan-tickets/batch/:id", h.GetBatch)
+		results.GET("/scan-history", h.GetScanHistory)
+		results.GET("/scans/:id", h.GetScan)
+		results.GET("/check-result", h.CheckResult)
+	}
+
+	admin := router.Group("/api/v1/admin", handler.AdminAuth(cfg.Admin.Token))
+	{
+		admin.GET("/usage", h.GetDailyUsage)
+		admin.GET("/prompt-stats", h.GetPromptStats)
+		admin.GET("/suspicious-cards", h.GetSuspiciousCards)
+		admin.GET("/scans/:id", h.GetAdminScan)
+		admin.GET("/api-keys", h.ListAPIKeys)
+		admin.POST("/api-keys", h.CreateAPIKey)
+		admin.POST("/api-keys/:id/rotate", h.RotateAPIKey)
+		admin.DELETE("/api-keys/:id", h.RevokeAPIKey)
+		admin.GET("/api-keys/:id/usage", h.GetAPIKeyUsage)
 	}
 
 	return router
 }
+
+// cleanupRateLimits deletes expired buckets and quota counters hourly.
+func cleanupRateLimits(ctx context.Context, store *ratelimit.PostgresStore, logger *zap.Logger) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := store.Cleanup(ctx); err != nil {
+				logger.Warn("rate limit cleanup failed", zap.Error(err))
+			}
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"loto/internal/config"
+	"loto/internal/handler"
+	"loto/internal/openapi"
+)
+
+// TestOpenAPIMatchesRouter keeps internal/openapi/openapi.json in sync with
+// the routes and models, as -check-openapi does.
+func TestOpenAPIMatchesRouter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(handler.New(nil, zap.NewNop()), &config.Config{}, nil)
+	if err := openapi.Verify(router.Routes()); err != nil {
+		t.Fatalf("openapi.json is out of date:\n%v", err)
+	}
+
+	// An undocumented route must be caught.
+	router.GET("/api/v1/undocumented", func(*gin.Context) {})
+	if err := openapi.Verify(router.Routes()); err == nil {
+		t.Error("Verify accepted an undocumented route")
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+
+	"loto/internal/config"
+	"loto/internal/migrate"
+	"loto/internal/repository"
+	"loto/internal/repository/conformance"
+	"loto/internal/repository/memory"
+	"loto/internal/repository/reconnect"
+	"loto/internal/repository/sqlite"
+	"loto/migrations"
+)
+
+// openStore opens the configured backend. The pool is returned for the
+// Postgres backend only, for the rate limiter to share. Postgres connects in
+// the background: while it is unreachable the server runs degraded, queueing
+// scans in the outbox. release closes whatever was opened.
+func openStore(ctx context.Context, cfg config.DatabaseConfig, logger *zap.Logger) (store repository.Store, pool *pgxpool.Pool, release func(), err error) {
+	release = func() {}
+	switch cfg.Backend {
+	case "memory":
+		logger.Warn("keeping data in memory: it is lost on restart")
+		return memory.New(), nil, release, nil
+	case "sqlite":
+		db, err := sqlite.Open(cfg.SQLitePath)
+		if err != nil {
+			return nil, nil, release, fmt.Errorf("open %s: %w", cfg.SQLitePath, err)
+		}
+		logger.Info("using SQLite database", zap.String("path", cfg.SQLitePath))
+		return db, nil, func() { db.Close() }, nil
+	case "postgres", "":
+	default:
+		return nil, nil, release, fmt.Errorf("unknown DB_BACKEND %q: want postgres, sqlite or memory", cfg.Backend)
+	}
+
+	// The pool only connects when used, so this fails on bad settings alone.
+	pool, err = pgxpool.New(ctx, cfg.DSN())
+	if err != nil {
+		return nil, nil, release, fmt.Errorf("database config: %w", err)
+	}
+
+	var outbox reconnect.Outbox = reconnect.NewMemoryOutbox(cfg.OutboxMax)
+	if cfg.OutboxDir != "" {
+		dir, err := reconnect.NewDirOutbox(cfg.OutboxDir, cfg.OutboxMax, logger)
+		if err != nil {
+			pool.Close()
+			return nil, nil, release, fmt.Errorf("open outbox: %w", err)
+		}
+		outbox = dir
+	}
+
+	db := reconnect.New(func(ctx context.Context) (repository.Store, error) {
+		return connectPostgres(ctx, pool, cfg, logger)
+	}, outbox, cfg.RetryInterval, logger)
+	db.Start(ctx)
+	return db, pool, func() {
+		if n := outbox.Len(); n > 0 && cfg.OutboxDir == "" {
+			logger.Warn("dropping scans queued in memory", zap.Int("queued", n))
+		}
+		pool.Close()
+	}, nil
+}
+
+// connectPostgres checks that the database is reachable and, when
+// configured, migrates it.
+func connectPostgres(ctx context.Context, pool *pgxpool.Pool, cfg config.DatabaseConfig, logger *zap.Logger) (*repository.Repository, error) {
+	if err := pool.Ping(ctx); err != nil {
+		return nil, err
+	}
+	if cfg.MigrateOnStart {
+		m, err := migrate.New(pool, migrations.FS, logger)
+		if err != nil {
+			return nil, fmt.Errorf("load migrations: %w", err)
+		}
+		applied, err := m.Up(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("migrate database: %w", err)
+		}
+		logger.Info("database migrated", zap.Int("applied", applied))
+	}
+	return repository.New(pool), nil
+}
+
+// runStorageCheck runs the conformance checks against each of the
+// comma-separated backends. SQLite uses a temporary file; Postgres uses the
+// DB_* settings and leaves its test records behind, so point it at a
+// scratch database.
+func runStorageCheck(ctx context.Context, cfg config.DatabaseConfig, backends string, logger *zap.Logger) error {
+	var errs []error
+	for _, backend := range strings.Split(backends, ",") {
+		backend = strings.TrimSpace(backend)
+		dbCfg := cfg
+		dbCfg.Backend = backend
+		if backend == "sqlite" {
+			dir, err := os.MkdirTemp("", "loto-storage-check")
+			if err != nil {
+				return err
+			}
+			defer os.RemoveAll(dir)
+			dbCfg.SQLitePath = filepath.Join(dir, "check.db")
+		}
+
+		store, release, err := openCheckedStore(ctx, dbCfg)
+		if err == nil {
+			err = conformance.Run(ctx, store)
+			release()
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s:\n%w", backend, err))
+			continue
+		}
+		logger.Info("storage backend conforms", zap.String("backend", backend))
+	}
+	return errors.Join(errs...)
+}
+
+// openCheckedStore opens a backend for the conformance checks, connecting
+// Postgres directly: the checks need it up, not queueing.
+func openCheckedStore(ctx context.Context, cfg config.DatabaseConfig) (repository.Store, func(), error) {
+	if cfg.Backend != "postgres" {
+		store, _, release, err := openStore(ctx, cfg, zap.NewNop())
+		return store, release, err
+	}
+	pool, err := pgxpool.New(ctx, cfg.DSN())
+	if err != nil {
+		return nil, nil, err
+	}
+	store, err := connectPostgres(ctx, pool, cfg, zap.NewNop())
+	if err != nil {
+		pool.Close()
+		return nil, nil, fmt.Errorf("database not reachable at %s:%s: %w", cfg.Host, cfg.Port, err)
+	}
+	return store, pool.Close, nil
+}
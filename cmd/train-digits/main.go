@@ -0,0 +1,365 @@
+// Command train-digits learns the templates of the built-in digit classifier
+// (OCR_PROVIDER=digits, HYBRID_DIGIT_VOTE) from labelled ticket photos.
+//
+// Images and their <name>.json sidecars use the same layout as cmd/eval, in
+// -dir or listed in a -manifest. Each round reads every photo with the
+// current templates, places the numbers on the card grid and labels the
+// digits of every cell whose expected number has as many glyphs as were
+// found; the labelled glyphs are averaged into the next round's templates.
+// The first round starts from -base, or from digits rendered in the Go Bold
+// font when it is empty. The photos in -holdout (test/, which cmd/eval
+// scores) are never trained on: the finished templates are only scored on
+// them.
+//
+// test/ holds a single labelled photo, so the embedded templates
+// (internal/ocr/digits.json) are learned from synthetic cards instead:
+// testdata/digits holds 8 cards printed in four Go fonts, condensed like
+// card numerals, listed in its manifest.txt and written by -render:
+//
+//	go run ./cmd/train-digits -render testdata/digits -cards 2 -seed 1
+//	PREPROCESS_ENABLED=true go run ./cmd/train-digits -manifest testdata/digits/manifest.txt -out internal/ocr/digits.json
+//
+// That is 31, 72, 86, 85, 80, 70, 81, 82, 70 and 29 glyphs of the digits 0
+// to 9, and the templates read 28 of the 45 cells of the held-out photo
+// correctly. Retrain with labelled photos of real printings, kept apart
+// from the evaluation photos, before relying on them. The file's source
+// field records the settings and images of each run.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"image/draw"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+
+	"loto/internal/config"
+	"loto/internal/model"
+	"loto/internal/ocr"
+	"loto/internal/preprocess"
+	"loto/internal/scan"
+	"loto/internal/validator"
+)
+
+type sample struct {
+	name   string
+	img    image.Image
+	blocks []model.Block
+}
+
+func main() {
+	dir := flag.String("dir", "", "directory with training images and <name>.json expectations")
+	manifest := flag.String("manifest", "", "file listing the training images, one per line relative to it")
+	holdout := flag.String("holdout", "test", "directory with the evaluation photos, never trained on")
+	out := flag.String("out", "digits.json", "where to write the templates")
+	base := flag.String("base", "", "templates to start from (default: rendered Go Bold digits)")
+	rounds := flag.Int("rounds", 3, "training rounds")
+	renderDir := flag.String("render", "", "write synthetic training cards and their manifest to this directory and exit")
+	cards := flag.Int("cards", 2, "with -render, cards per font")
+	seed := flag.Uint64("seed", 1, "with -render, random seed")
+	flag.Parse()
+
+	if *renderDir != "" {
+		if err := render(*renderDir, *cards, *seed); err != nil {
+			fatal("%v", err)
+		}
+		return
+	}
+	if (*dir == "") == (*manifest == "") {
+		fatal("give the training images with exactly one of -dir and -manifest")
+	}
+
+	_ = godotenv.Load()
+	cfg, err := config.Load()
+	if err != nil {
+		fatal("load config: %v", err)
+	}
+
+	pre := preprocess.New(cfg.Preprocess)
+	paths, err := trainingImages(*dir, *manifest)
+	if err != nil {
+		fatal("%v", err)
+	}
+	var held []string
+	if *holdout != "" {
+		if held, err = listImages(*holdout); err != nil {
+			fatal("%v", err)
+		}
+	}
+	for _, p := range paths {
+		if slices.ContainsFunc(held, func(h string) bool { return samePath(h, p) }) {
+			fatal("%s is in the evaluation set %s; train on other photos", p, *holdout)
+		}
+	}
+
+	samples, err := loadSamples(paths, pre)
+	if err != nil {
+		fatal("%v", err)
+	}
+	if len(samples) == 0 {
+		fatal("no labelled training images")
+	}
+	heldOut, err := loadSamples(held, pre)
+	if err != nil {
+		fatal("%v", err)
+	}
+
+	var templates *ocr.DigitTemplates
+	if *base != "" {
+		templates, err = ocr.LoadDigitTemplates(*base)
+	} else {
+		templates, err = renderTemplates()
+	}
+	if err != nil {
+		fatal("%v", err)
+	}
+
+	for round := 1; round <= *rounds; round++ {
+		classifier := ocr.NewDigitClassifier(templates)
+		trainer := ocr.NewTemplateTrainer()
+		var correct, labelled, total int
+		for _, s := range samples {
+			c, l, t := label(classifier, trainer, s)
+			correct += c
+			labelled += l
+			total += t
+		}
+		fmt.Printf("round %d: %d/%d cells read correctly, %d labelled, samples per digit %v\n",
+			round, correct, total, labelled, trainer.Samples())
+
+		if templates, err = trainer.Templates(templates); err != nil {
+			fatal("%v", err)
+		}
+	}
+
+	if len(heldOut) > 0 {
+		classifier := ocr.NewDigitClassifier(templates)
+		var correct, total int
+		for _, s := range heldOut {
+			c, _, t := label(classifier, ocr.NewTemplateTrainer(), s)
+			correct += c
+			total += t
+		}
+		fmt.Printf("held out (%s): %d/%d cells read correctly\n", *holdout, correct, total)
+	}
+
+	from := "Go Bold"
+	if *base != "" {
+		from = *base
+	}
+	steps := "none"
+	if cfg.Preprocess.Enabled {
+		steps = strings.Join(cfg.Preprocess.Steps, ",")
+	}
+	on := fmt.Sprintf("%d images in %s", len(samples), filepath.ToSlash(*dir))
+	if *manifest != "" {
+		on = fmt.Sprintf("the %d images of %s", len(samples), filepath.ToSlash(*manifest))
+	}
+	templates.Source = fmt.Sprintf("cmd/train-digits: %d rounds from %s, preprocessing %s, on %s",
+		*rounds, from, steps, on)
+
+	var buf bytes.Buffer
+	if err := templates.Write(&buf); err != nil {
+		fatal("%v", err)
+	}
+	if err := os.WriteFile(*out, buf.Bytes(), 0o644); err != nil {
+		fatal("%v", err)
+	}
+	fmt.Printf("wrote %s\n", *out)
+}
+
+// label reads s with classifier and adds the glyphs of every cell it can
+// attribute to an expected number to trainer. It returns the cells read
+// correctly, the cells labelled and the expected cell count.
+func label(classifier *ocr.DigitClassifier, trainer *ocr.TemplateTrainer, s sample) (int, int, int) {
+	want := expectedCells(s.blocks)
+	grid := scan.ReconstructGrid(classifier.Tokens(s.img))
+	if grid == nil || len(grid.Cells) != len(s.blocks) {
+		fmt.Printf("%s: card not found (%d blocks expected)\n", s.name, len(s.blocks))
+		return 0, 0, len(want)
+	}
+
+	var correct, labelled int
+	for b, block := range grid.Cells {
+		for r, row := range block {
+			for c, cell := range row {
+				n, ok := want[[3]int{b, r, c}]
+				if !ok || cell.Number == 0 {
+					continue
+				}
+				if cell.Number == n {
+					correct++
+				}
+
+				box := image.Rect(cell.X, cell.Y, cell.X+cell.Width, cell.Y+cell.Height)
+				glyphs := ocr.CellGlyphs(s.img, box)
+				digits := strconv.Itoa(n)
+				if len(glyphs) != len(digits) {
+					continue
+				}
+				for i, g := range glyphs {
+					trainer.Add(int(digits[i]-'0'), g)
+				}
+				labelled++
+			}
+		}
+	}
+	return correct, labelled, len(want)
+}
+
+// expectedCells indexes the labelled numbers by 0-based block, row and the
+// column their decade puts them in.
+func expectedCells(blocks []model.Block) map[[3]int]int {
+	cells := make(map[[3]int]int)
+	for b, block := range blocks {
+		for r, row := range [][]int{block.Row1, block.Row2, block.Row3} {
+			for _, n := range row {
+				cells[[3]int{b, r, validator.DecadeColumn(n) - 1}] = n
+			}
+		}
+	}
+	return cells
+}
+
+// renderTemplates draws the digits in Go Bold as a starting point; the
+// first round then relabels real glyphs with them.
+func renderTemplates() (*ocr.DigitTemplates, error) {
+	f, err := opentype.Parse(gobold.TTF)
+	if err != nil {
+		return nil, err
+	}
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: 64, DPI: 72, Hinting: font.HintingNone})
+	if err != nil {
+		return nil, err
+	}
+	defer face.Close()
+
+	trainer := ocr.NewTemplateTrainer()
+	for d := 0; d <= 9; d++ {
+		img := image.NewRGBA(image.Rect(0, 0, 80, 100))
+		draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+		dr := font.Drawer{Dst: img, Src: image.Black, Face: face, Dot: fixed.P(10, 80)}
+		dr.DrawString(strconv.Itoa(d))
+
+		glyphs := ocr.CellGlyphs(img, img.Bounds())
+		if len(glyphs) != 1 {
+			return nil, fmt.Errorf("rendering digit %d: %d glyphs", d, len(glyphs))
+		}
+		trainer.Add(d, glyphs[0])
+	}
+	return trainer.Templates(nil)
+}
+
+// trainingImages lists the images in dir, or those named in manifest: one
+// path per line relative to the manifest, blank lines and # comments skipped.
+func trainingImages(dir, manifest string) ([]string, error) {
+	if manifest == "" {
+		return listImages(dir)
+	}
+	data, err := os.ReadFile(manifest)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		paths = append(paths, filepath.Join(filepath.Dir(manifest), filepath.FromSlash(line)))
+	}
+	return paths, nil
+}
+
+// listImages returns the images in dir that have a <name>.json sidecar.
+func listImages(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, e := range entries {
+		ext := strings.ToLower(filepath.Ext(e.Name()))
+		if e.IsDir() || !imageExts[ext] {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		if _, err := os.Stat(sidecar(path)); err == nil {
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
+
+func sidecar(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".json"
+}
+
+func samePath(a, b string) bool {
+	fa, errA := os.Stat(a)
+	fb, errB := os.Stat(b)
+	return errA == nil && errB == nil && os.SameFile(fa, fb)
+}
+
+func loadSamples(paths []string, pre *preprocess.Preprocessor) ([]sample, error) {
+	var samples []sample
+	for _, path := range paths {
+		label, err := os.ReadFile(sidecar(path))
+		if err != nil {
+			return nil, err
+		}
+
+		var want struct {
+			Blocks []model.Block `json:"blocks"`
+		}
+		if err := json.Unmarshal(label, &want); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		img, err := decode(path, pre)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		samples = append(samples, sample{name: filepath.Base(path), img: img, blocks: want.Blocks})
+	}
+	return samples, nil
+}
+
+// decode prepares an image exactly as the server does before OCR.
+func decode(path string, pre *preprocess.Preprocessor) (image.Image, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data, mimeType, err := pre.Normalize(data, preprocess.DetectContentType(data))
+	if err != nil {
+		return nil, err
+	}
+	res, err := pre.Process(data, mimeType)
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(res.Data))
+	return img, err
+}
+
+var imageExts = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".webp": true, ".heic": true, ".pdf": true,
+}
+
+func fatal(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "train-digits: "+format+"\n", args...)
+	os.Exit(1)
+}
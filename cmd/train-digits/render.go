@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gomedium"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+
+	"loto/internal/model"
+)
+
+// renderFonts are the typefaces synthetic cards are printed in. Printed
+// cards use a condensed bold sans; the digits are squeezed to condensedWidth
+// of their natural width to match.
+var renderFonts = []struct {
+	name string
+	ttf  []byte
+}{
+	{"gobold", gobold.TTF},
+	{"gomedium", gomedium.TTF},
+	{"gomonobold", gomonobold.TTF},
+	{"goregular", goregular.TTF},
+}
+
+// Synthetic card geometry, in pixels.
+const (
+	cellWidth      = 60
+	cellHeight     = 72
+	digitHeight    = 54
+	blockGap       = 56
+	cardMargin     = 30
+	gridLine       = 2
+	condensedWidth = 0.7
+)
+
+var (
+	cellFill = color.RGBA{128, 74, 50, 255}
+	paper    = color.RGBA{250, 246, 238, 255}
+)
+
+// render writes cardsPerFont synthetic cards per font to dir, each PNG with
+// its <name>.json labels as cmd/eval expects, and a manifest.txt listing
+// them. Cards are drawn from seed, so a run is reproducible.
+func render(dir string, cardsPerFont int, seed uint64) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	rng := rand.New(rand.NewPCG(seed, seed))
+
+	var manifest strings.Builder
+	fmt.Fprintf(&manifest, "# Synthetic LOTO cards for cmd/train-digits, kept apart from the photos\n")
+	fmt.Fprintf(&manifest, "# in test/ that the templates are evaluated on. Regenerate with\n")
+	fmt.Fprintf(&manifest, "#   go run ./cmd/train-digits -render %s -cards %d -seed %d\n", filepath.ToSlash(dir), cardsPerFont, seed)
+	for _, f := range renderFonts {
+		parsed, err := opentype.Parse(f.ttf)
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.name, err)
+		}
+		face, err := opentype.NewFace(parsed, &opentype.FaceOptions{Size: 96, DPI: 72, Hinting: font.HintingNone})
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.name, err)
+		}
+
+		for i := 1; i <= cardsPerFont; i++ {
+			name := fmt.Sprintf("%s-%d", f.name, i)
+			blocks := randomCard(rng)
+			if err := writeCard(filepath.Join(dir, name), drawCard(blocks, face), blocks); err != nil {
+				face.Close()
+				return err
+			}
+			fmt.Fprintf(&manifest, "%s.png\n", name)
+		}
+		face.Close()
+	}
+
+	path := filepath.Join(dir, "manifest.txt")
+	if err := os.WriteFile(path, []byte(manifest.String()), 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %d cards and %s\n", cardsPerFont*len(renderFonts), path)
+	return nil
+}
+
+// randomCard deals a valid card: 5 numbers per row in distinct columns, no
+// number twice, and each block's columns ascending top to bottom.
+func randomCard(rng *rand.Rand) []model.Block {
+	var pool [9][]int
+	for n := 1; n <= 90; n++ {
+		c := min(n/10, 8)
+		pool[c] = append(pool[c], n)
+	}
+	for c := range pool {
+		rng.Shuffle(len(pool[c]), func(i, j int) { pool[c][i], pool[c][j] = pool[c][j], pool[c][i] })
+	}
+
+	blocks := make([]model.Block, 3)
+	for b := range blocks {
+		var cols [3][]int
+		for r := range cols {
+			cols[r] = rng.Perm(9)[:5]
+		}
+		var rows [3][]int
+		for c := 0; c < 9; c++ {
+			var rowsUsing []int
+			for r := range cols {
+				if slices.Contains(cols[r], c) {
+					rowsUsing = append(rowsUsing, r)
+				}
+			}
+			nums := slices.Clone(pool[c][:len(rowsUsing)])
+			pool[c] = pool[c][len(rowsUsing):]
+			slices.Sort(nums)
+			for i, r := range rowsUsing {
+				rows[r] = append(rows[r], nums[i])
+			}
+		}
+		for r := range rows {
+			slices.Sort(rows[r])
+		}
+		blocks[b] = model.Block{Row1: rows[0], Row2: rows[1], Row3: rows[2]}
+	}
+	return blocks
+}
+
+// drawCard prints blocks as on a paper card: numbered cells white, empty
+// cells filled, black grid lines between them.
+func drawCard(blocks []model.Block, face font.Face) image.Image {
+	blockHeight := 3 * cellHeight
+	w := 2*cardMargin + 9*cellWidth
+	h := 2*cardMargin + len(blocks)*blockHeight + (len(blocks)-1)*blockGap
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	xdraw.Draw(img, img.Bounds(), image.NewUniform(paper), image.Point{}, xdraw.Src)
+
+	for b, block := range blocks {
+		top := cardMargin + b*(blockHeight+blockGap)
+		grid := image.Rect(cardMargin-gridLine, top-gridLine, cardMargin+9*cellWidth+gridLine, top+blockHeight+gridLine)
+		xdraw.Draw(img, grid, image.Black, image.Point{}, xdraw.Src)
+
+		for r, row := range [][]int{block.Row1, block.Row2, block.Row3} {
+			for c := 0; c < 9; c++ {
+				cell := image.Rect(cardMargin+c*cellWidth, top+r*cellHeight, cardMargin+(c+1)*cellWidth, top+(r+1)*cellHeight).Inset(gridLine / 2)
+				xdraw.Draw(img, cell, image.NewUniform(cellFill), image.Point{}, xdraw.Src)
+				for _, n := range row {
+					if min(n/10, 8) == c {
+						xdraw.Draw(img, cell, image.White, image.Point{}, xdraw.Src)
+						drawNumber(img, cell, strconv.Itoa(n), face)
+					}
+				}
+			}
+		}
+	}
+	return img
+}
+
+// drawNumber prints text centred in cell, condensed and scaled to
+// digitHeight, and narrower still when it would not fit the cell.
+func drawNumber(dst *image.RGBA, cell image.Rectangle, text string, face font.Face) {
+	bounds, _ := font.BoundString(face, text)
+	src := image.Rect(bounds.Min.X.Floor(), bounds.Min.Y.Floor(), bounds.Max.X.Ceil(), bounds.Max.Y.Ceil())
+	glyphs := image.NewRGBA(src)
+	xdraw.Draw(glyphs, src, image.White, image.Point{}, xdraw.Src)
+	d := font.Drawer{Dst: glyphs, Src: image.Black, Face: face, Dot: fixed.P(0, 0)}
+	d.DrawString(text)
+
+	scale := float64(digitHeight) / float64(src.Dy())
+	gw := min(int(float64(src.Dx())*scale*condensedWidth), cell.Dx()-6)
+	x := cell.Min.X + (cell.Dx()-gw)/2
+	y := cell.Min.Y + (cell.Dy()-digitHeight)/2
+	xdraw.CatmullRom.Scale(dst, image.Rect(x, y, x+gw, y+digitHeight), glyphs, src, xdraw.Src, nil)
+}
+
+func writeCard(base string, img image.Image, blocks []model.Block) error {
+	f, err := os.Create(base + ".png")
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	labels, err := json.Marshal(struct {
+		Blocks []model.Block `json:"blocks"`
+	}{blocks})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(base+".json", append(labels, '\n'), 0o644)
+}
@@ -13,6 +13,7 @@ import (
 
 	"loto/internal/config"
 	"loto/internal/model"
+	"loto/internal/prompt"
 )
 
 type GeminiClient struct {
@@ -20,10 +21,11 @@ type GeminiClient struct {
 	model    string
 	thinking string
 	timeout  time.Duration
+	prompts  *prompt.Registry
 	logger   *zap.Logger
 }
 
-func NewGeminiClient(ctx context.Context, cfg config.GoogleAIConfig, logger *zap.Logger) (*GeminiClient, error) {
+func NewGeminiClient(ctx context.Context, cfg config.GoogleAIConfig, prompts *prompt.Registry, logger *zap.Logger) (*GeminiClient, error) {
 	client, err := genai.NewClient(ctx, &genai.ClientConfig{
 		APIKey:  cfg.APIKey,
 		Backend: genai.BackendGeminiAPI,
@@ -42,17 +44,25 @@ func NewGeminiClient(ctx context.Context, cfg config.GoogleAIConfig, logger *zap
 		model:    modelName,
 		thinking: cfg.Thinking,
 		timeout:  cfg.Timeout,
+		prompts:  prompts,
 		logger:   logger,
 	}, nil
 }
 
 func (c *GeminiClient) ScanTicket(ctx context.Context, base64Image string, mimeType string) (*model.GPTScanResponse, error) {
-	return c.scan(ctx, base64Image, mimeType, scanPrompt)
+	text, version, err := renderPrompt(ctx, c.prompts, prompt.KindScan, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.scan(ctx, base64Image, mimeType, text, version)
 }
 
 func (c *GeminiClient) ScanTicketWithOCR(ctx context.Context, base64Image string, mimeType string, ocrResult *model.OCRScanResult) (*model.GPTScanResponse, error) {
-	prompt := buildOCRAugmentedPrompt(ocrResult)
-	return c.scan(ctx, base64Image, mimeType, prompt)
+	text, version, err := renderPrompt(ctx, c.prompts, prompt.KindHybrid, ocrResult)
+	if err != nil {
+		return nil, err
+	}
+	return c.scan(ctx, base64Image, mimeType, text, version)
 }
 
 func (c *GeminiClient) buildConfig() *genai.GenerateContentConfig {
@@ -81,7 +91,7 @@ func (c *GeminiClient) buildConfig() *genai.GenerateContentConfig {
 	return cfg
 }
 
-func (c *GeminiClient) scan(ctx context.Context, base64Image string, mimeType string, prompt string) (*model.GPTScanResponse, error) {
+func (c *GeminiClient) scan(ctx context.Context, base64Image string, mimeType string, promptText string, promptVersion string) (*model.GPTScanResponse, error) {
 	ctx, cancel := context.WithTimeout(ctx, c.timeout)
 	defer cancel()
 
@@ -91,11 +101,12 @@ func (c *GeminiClient) scan(ctx context.Context, base64Image string, mimeType st
 	}
 
 	parts := []*genai.Part{
-		{Text: prompt},
+		{Text: promptText},
 		{InlineData: &genai.Blob{Data: imgBytes, MIMEType: mimeType}},
 	}
 
 	contentConfig := c.buildConfig()
+	usage := model.Usage{Provider: "gemini", Model: c.model}
 
 	var lastErr error
 	for attempt := 0; attempt < 2; attempt++ {
@@ -109,6 +120,7 @@ func (c *GeminiClient) scan(ctx context.Context, base64Image string, mimeType st
 			lastErr = fmt.Errorf("gemini request failed: %w", err)
 			continue
 		}
+		addGeminiUsage(&usage, resp.UsageMetadata)
 
 		rawContent := resp.Text()
 		content := cleanJSON(rawContent)
@@ -120,12 +132,25 @@ func (c *GeminiClient) scan(ctx context.Context, base64Image string, mimeType st
 		var result model.GPTScanResponse
 		if err := json.Unmarshal([]byte(content), &result); err != nil {
 			c.logger.Error("failed to parse Gemini response", zap.String("raw_content", rawContent), zap.String("cleaned_content", content), zap.Error(err))
-			return nil, fmt.Errorf("invalid JSON from Gemini: %w", err)
+			return nil, withUsage(fmt.Errorf("invalid JSON from Gemini: %w", err), usage)
 		}
+		result.Usage = []model.Usage{usage}
+		result.PromptVersion = promptVersion
+		result.Provider, result.Model = usage.Provider, usage.Model
+		result.RawResponse = rawContent
 
 		logScanResult(c.logger, "Gemini", &result)
 		return &result, nil
 	}
 
-	return nil, lastErr
+	return nil, withUsage(lastErr, usage)
+}
+
+func addGeminiUsage(u *model.Usage, md *genai.GenerateContentResponseUsageMetadata) {
+	if md == nil {
+		return
+	}
+	u.InputTokens += int64(md.PromptTokenCount)
+	u.OutputTokens += int64(md.CandidatesTokenCount)
+	u.ThinkingTokens += int64(md.ThoughtsTokenCount)
 }
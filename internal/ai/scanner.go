@@ -2,12 +2,15 @@ package ai
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"go.uber.org/zap"
 
 	"loto/internal/model"
+	"loto/internal/prompt"
 )
 
 type Scanner interface {
@@ -15,6 +18,81 @@ type Scanner interface {
 	ScanTicketWithOCR(ctx context.Context, base64Image string, mimeType string, ocrResult *model.OCRScanResult) (*model.GPTScanResponse, error)
 }
 
+// UsageError is returned by a scan that failed after the provider had billed
+// for some of its calls, so that their cost can still be recorded.
+type UsageError struct {
+	Err   error
+	Usage []model.Usage
+}
+
+func (e *UsageError) Error() string { return e.Err.Error() }
+func (e *UsageError) Unwrap() error { return e.Err }
+
+// FailedUsage returns the usage billed by the calls behind a scan error, or
+// nil when there is none.
+func FailedUsage(err error) []model.Usage {
+	var ue *UsageError
+	if errors.As(err, &ue) {
+		return ue.Usage
+	}
+	return nil
+}
+
+// withUsage attaches usage to err when any tokens were billed.
+func withUsage(err error, usage model.Usage) error {
+	if usage.InputTokens+usage.OutputTokens+usage.ThinkingTokens == 0 {
+		return err
+	}
+	return &UsageError{Err: err, Usage: []model.Usage{usage}}
+}
+
+var ocrProviderNames = map[string]string{
+	"google_vision": "Google Cloud Vision",
+	"tesseract":     "Tesseract OCR",
+	"digits":        "a printed-digit classifier",
+}
+
+func renderPrompt(ctx context.Context, prompts *prompt.Registry, kind prompt.Kind, ocrResult *model.OCRScanResult) (string, string, error) {
+	opts := prompt.FromContext(ctx)
+	in := prompt.Input{
+		LotteryTypeHint: opts.LotteryTypeHint,
+		Locale:          opts.Locale,
+	}
+	if ocrResult != nil {
+		in.OCRProvider = ocrProviderNames[ocrResult.Provider]
+		in.OCRNumbers = ocrResult.Numbers
+		in.OCRConfidence = ocrResult.Confidence
+		in.FullText = ocrResult.FullText
+		in.GridRows = gridRows(ocrResult.Layout)
+	}
+	return prompts.Render(opts.Version, kind, in)
+}
+
+func gridRows(layout *model.OCRLayout) []prompt.GridRow {
+	if layout == nil {
+		return nil
+	}
+
+	type key struct{ block, row int }
+	index := make(map[key]int)
+	var rows []prompt.GridRow
+	for _, c := range layout.Cells {
+		k := key{c.Block, c.Row}
+		i, ok := index[k]
+		if !ok {
+			i = len(rows)
+			index[k] = i
+			rows = append(rows, prompt.GridRow{Block: c.Block, Row: c.Row, Cells: make([]string, 9)})
+		}
+		cell := &rows[i].Cells[c.Col-1]
+		if *cell != "" {
+			*cell += "/"
+		}
+		*cell += strconv.Itoa(c.Number)
+	}
+	return rows
+}
+
 func logScanResult(logger *zap.Logger, provider string, result *model.GPTScanResponse) {
 	var blocksSummary []string
 	for i, b := range result.Blocks {
@@ -30,6 +108,7 @@ func logScanResult(logger *zap.Logger, provider string, result *model.GPTScanRes
 		zap.Int("total_numbers", len(result.AllNumbers)),
 		zap.Ints("all_numbers", result.AllNumbers),
 		zap.String("notes", result.Notes),
+		zap.String("prompt_version", result.PromptVersion),
 	)
 
 	if len(blocksSummary) > 0 {
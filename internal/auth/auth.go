@@ -0,0 +1,135 @@
+// Package auth issues and verifies the JWT access tokens and opaque refresh
+// tokens of user accounts, generates partner API keys and hashes passwords.
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+
+	"loto/internal/config"
+)
+
+// ErrInvalidToken is returned for access tokens that are malformed, signed
+// with another key or expired.
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+const issuer = "loto"
+
+// Tokens signs access tokens with HMAC-SHA256. Access tokens are stateless
+// and short-lived; refresh tokens are random strings the caller stores
+// hashed, so they can be rotated and revoked.
+type Tokens struct {
+	secret     []byte
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+}
+
+func NewTokens(cfg config.AuthConfig) (*Tokens, error) {
+	if len(cfg.JWTSecret) < 32 {
+		return nil, fmt.Errorf("JWT secret must be at least 32 bytes")
+	}
+	return &Tokens{
+		secret:     []byte(cfg.JWTSecret),
+		accessTTL:  cfg.AccessTTL,
+		refreshTTL: cfg.RefreshTTL,
+	}, nil
+}
+
+// Claims are the claims of an access token. Anonymous marks device accounts
+// that have not been upgraded with an email and password.
+type Claims struct {
+	Anonymous bool `json:"anon,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Access returns a signed access token for userID and its lifetime.
+func (t *Tokens) Access(userID string, anonymous bool) (string, time.Duration, error) {
+	now := time.Now()
+	claims := Claims{
+		Anonymous: anonymous,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   userID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(t.accessTTL)),
+		},
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(t.secret)
+	if err != nil {
+		return "", 0, err
+	}
+	return signed, t.accessTTL, nil
+}
+
+// Verify parses an access token and returns its claims.
+func (t *Tokens) Verify(token string) (*Claims, error) {
+	var claims Claims
+	_, err := jwt.ParseWithClaims(token, &claims,
+		func(*jwt.Token) (any, error) { return t.secret, nil },
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(issuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil || claims.Subject == "" {
+		return nil, ErrInvalidToken
+	}
+	return &claims, nil
+}
+
+// Refresh returns a new random refresh token, its hash for storage and its
+// expiry.
+func (t *Tokens) Refresh() (token, hash string, expires time.Time, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", time.Time{}, err
+	}
+	token = base64.RawURLEncoding.EncodeToString(buf)
+	return token, HashToken(token), time.Now().UTC().Add(t.refreshTTL), nil
+}
+
+// HashToken returns the SHA-256 of a refresh token or API key as stored in
+// the database. Both are random, so a fast hash is enough.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func CheckPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// apiKeyPrefix marks API keys so they are recognisable in logs and secret
+// scanners.
+const apiKeyPrefix = "loto_"
+
+// NewAPIKey returns a new partner API key, the short prefix shown in key
+// listings and the hash stored in place of the key.
+func NewAPIKey() (key, prefix, hash string, err error) {
+	id := make([]byte, 4)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", "", err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", "", err
+	}
+	prefix = apiKeyPrefix + hex.EncodeToString(id)
+	key = prefix + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	return key, prefix, HashToken(key), nil
+}
@@ -0,0 +1,162 @@
+// Package client calls the HTTP API with the request and response types of
+// internal/model. One method per operation is generated from the OpenAPI
+// document; regenerate after changing it.
+package client
+
+//go:generate go run ../../cmd/gen-client -o operations.go
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"loto/internal/model"
+)
+
+// Client sends requests to one server. Credentials that are set are sent
+// with every request: AccessToken as a bearer token, APIKey in X-API-Key
+// and AdminToken in X-Admin-Token.
+type Client struct {
+	BaseURL     string
+	HTTPClient  *http.Client
+	AccessToken string
+	APIKey      string
+	AdminToken  string
+	// Language is sent as Accept-Language and picks the language of error
+	// messages.
+	Language string
+}
+
+func New(baseURL string) *Client {
+	return &Client{BaseURL: strings.TrimRight(baseURL, "/"), HTTPClient: http.DefaultClient}
+}
+
+// Error is an error response of the API.
+type Error struct {
+	StatusCode int
+	model.APIError
+}
+
+func (e *Error) Error() string {
+	msg := e.Detail
+	if msg == "" {
+		msg = e.Message
+	}
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, e.Code, msg)
+}
+
+// File is an upload of a multipart form. A File without Data is not sent.
+type File struct {
+	Name string
+	Data []byte
+}
+
+// part is a field of a multipart form; empty values are not sent.
+type part struct {
+	name  string
+	value string
+	files []File
+}
+
+// do sends a request with a JSON body, or a multipart form when body is a
+// []part, and decodes a JSON response into out unless it is nil.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body any, out any) error {
+	target := c.BaseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	var reader io.Reader
+	contentType := ""
+	switch b := body.(type) {
+	case nil:
+	case []part:
+		buf, ct, err := encodeForm(b)
+		if err != nil {
+			return err
+		}
+		reader, contentType = buf, ct
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			return err
+		}
+		reader, contentType = bytes.NewReader(data), "application/json"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.AccessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.AccessToken)
+	}
+	if c.APIKey != "" {
+		req.Header.Set("X-API-Key", c.APIKey)
+	}
+	if c.AdminToken != "" {
+		req.Header.Set("X-Admin-Token", c.AdminToken)
+	}
+	if c.Language != "" {
+		req.Header.Set("Accept-Language", c.Language)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		data, _ := io.ReadAll(resp.Body)
+		var e model.ErrorResponse
+		if json.Unmarshal(data, &e) != nil || e.Error.Code == "" {
+			e.Error.Message = strings.TrimSpace(string(data))
+		}
+		return &Error{StatusCode: resp.StatusCode, APIError: e.Error}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode %s %s response: %w", method, path, err)
+	}
+	return nil
+}
+
+func encodeForm(parts []part) (*bytes.Buffer, string, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for _, p := range parts {
+		if p.value != "" {
+			if err := w.WriteField(p.name, p.value); err != nil {
+				return nil, "", err
+			}
+		}
+		for _, f := range p.files {
+			if f.Data == nil {
+				continue
+			}
+			fw, err := w.CreateFormFile(p.name, f.Name)
+			if err != nil {
+				return nil, "", err
+			}
+			if _, err := fw.Write(f.Data); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	return &buf, w.FormDataContentType(), nil
+}
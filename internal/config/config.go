@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -14,6 +15,75 @@ type Config struct {
 	OpenAI     OpenAIConfig
 	GoogleAI   GoogleAIConfig
 	Vision     VisionConfig
+	Pricing    PricingConfig
+	Admin      AdminConfig
+	Prompt     PromptConfig
+	Preprocess PreprocessConfig
+	Batch      BatchConfig
+	Auth       AuthConfig
+	RateLimit  RateLimitConfig
+}
+
+// RateLimitConfig sets request rates and scan quotas per IP, user and API
+// key. Store is "memory" (per instance) or "postgres" (shared).
+type RateLimitConfig struct {
+	Enabled   bool
+	Store     string
+	IP        Rate
+	User      Rate
+	Key       Rate
+	IPQuota   Quota
+	UserQuota Quota
+	KeyQuota  Quota
+}
+
+// Rate allows PerMinute requests on average and bursts of Burst; 0 is
+// unlimited.
+type Rate struct {
+	PerMinute float64
+	Burst     int
+}
+
+// Quota caps scans per UTC day and month; 0 is unlimited.
+type Quota struct {
+	Daily   int64
+	Monthly int64
+}
+
+// AuthConfig configures user tokens. An empty JWTSecret makes the server
+// generate one at startup, which logs everyone out on restart.
+type AuthConfig struct {
+	JWTSecret  string
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+}
+
+type BatchConfig struct {
+	Workers       int
+	RatePerMinute int
+	MaxImages     int
+	Retention     time.Duration
+}
+
+type PreprocessConfig struct {
+	Enabled      bool
+	MaxDimension int
+	MaxPixels    int
+	Steps        []string
+	PDFRenderer  string
+}
+
+type PromptConfig struct {
+	Version    string
+	Experiment string
+}
+
+type PricingConfig struct {
+	File string
+}
+
+type AdminConfig struct {
+	Token string
 }
 
 type GoogleAIConfig struct {
@@ -28,15 +98,33 @@ type ServerConfig struct {
 	MaxUploadSizeMB int64
 	ReadTimeout     time.Duration
 	WriteTimeout    time.Duration
+	// TrustedProxies may set X-Forwarded-For, which then gives the client IP
+	// used by the IP rate limits. Empty keeps gin's default of trusting all.
+	TrustedProxies []string
 }
 
+// DatabaseConfig selects where scans and accounts are kept. Backend is
+// "postgres", "sqlite" (a single file at SQLitePath) or "memory" (lost on
+// restart); the connection settings apply to Postgres only.
 type DatabaseConfig struct {
+	Backend    string
+	SQLitePath string
+
 	Host     string
 	Port     string
 	User     string
 	Password string
 	DBName   string
 	SSLMode  string
+	// MigrateOnStart applies pending migrations when the server connects.
+	MigrateOnStart bool
+
+	// While Postgres is unreachable the server retries every RetryInterval
+	// and queues up to OutboxMax scans, in OutboxDir if set and otherwise
+	// in memory.
+	RetryInterval time.Duration
+	OutboxDir     string
+	OutboxMax     int
 }
 
 func (d DatabaseConfig) DSN() string {
@@ -53,13 +141,53 @@ type OpenAIConfig struct {
 	Timeout         time.Duration
 }
 
+// VisionConfig configures the OCR stage of hybrid scanning. Provider selects
+// Google Cloud Vision or a local Tesseract.
 type VisionConfig struct {
+	Provider        string
 	CredentialsFile string
 	Enabled         bool
+	Tesseract       TesseractConfig
+	Digits          DigitsConfig
+	Hybrid          HybridConfig
+}
+
+// DigitsConfig configures the built-in digit classifier. Templates is a
+// file written by cmd/train-digits; empty uses the embedded templates.
+type DigitsConfig struct {
+	Templates string
+}
+
+type TesseractConfig struct {
+	Path      string
+	Languages string
+	PSM       int
+	Timeout   time.Duration
+}
+
+type HybridConfig struct {
+	Strategy           string
+	AgreementThreshold float64
+	DigitVote          bool
+	// RegionWorkers caps how many cards of one photo are scanned at once.
+	RegionWorkers int
 }
 
 func Load() (*Config, error) {
 	maxUpload, _ := strconv.ParseInt(getEnv("MAX_UPLOAD_SIZE_MB", "5"), 10, 64)
+	batchWorkers, _ := strconv.Atoi(getEnv("BATCH_WORKERS", "4"))
+	batchRate, _ := strconv.Atoi(getEnv("BATCH_RATE_PER_MINUTE", "30"))
+	batchMax, _ := strconv.Atoi(getEnv("BATCH_MAX_IMAGES", "100"))
+	batchRetention, _ := strconv.Atoi(getEnv("BATCH_RETENTION_HOURS", "24"))
+	maxDimension, _ := strconv.Atoi(getEnv("PREPROCESS_MAX_DIMENSION", "2000"))
+	maxPixels, _ := strconv.Atoi(getEnv("PREPROCESS_MAX_PIXELS", "40000000"))
+	tesseractPSM, _ := strconv.Atoi(getEnv("TESSERACT_PSM", "11"))
+	accessTTL, _ := strconv.Atoi(getEnv("JWT_ACCESS_TTL_MINUTES", "15"))
+	refreshTTL, _ := strconv.Atoi(getEnv("JWT_REFRESH_TTL_DAYS", "30"))
+	dbRetry, _ := strconv.Atoi(getEnv("DB_RETRY_INTERVAL_SECONDS", "5"))
+	outboxMax, _ := strconv.Atoi(getEnv("DB_OUTBOX_MAX", "10000"))
+	agreementThreshold, _ := strconv.ParseFloat(getEnv("HYBRID_AGREEMENT_THRESHOLD", "0.9"), 64)
+	regionWorkers, _ := strconv.Atoi(getEnv("HYBRID_REGION_WORKERS", "4"))
 
 	return &Config{
 		AIProvider: getEnv("AI_PROVIDER", "google"),
@@ -68,14 +196,23 @@ func Load() (*Config, error) {
 			MaxUploadSizeMB: maxUpload,
 			ReadTimeout:     30 * time.Second,
 			WriteTimeout:    90 * time.Second,
+			TrustedProxies:  splitList(getEnv("TRUSTED_PROXIES", "")),
 		},
 		Database: DatabaseConfig{
+			Backend:    getEnv("DB_BACKEND", "postgres"),
+			SQLitePath: getEnv("DB_SQLITE_PATH", "loto.db"),
+
 			Host:     getEnv("DB_HOST", "localhost"),
 			Port:     getEnv("DB_PORT", "5432"),
 			User:     getEnv("DB_USER", "postgres"),
 			Password: getEnv("DB_PASSWORD", "postgres"),
 			DBName:   getEnv("DB_NAME", "loto"),
 			SSLMode:  getEnv("DB_SSLMODE", "disable"),
+
+			MigrateOnStart: getEnv("DB_MIGRATE_ON_START", "false") == "true",
+			RetryInterval:  time.Duration(max(dbRetry, 1)) * time.Second,
+			OutboxDir:      getEnv("DB_OUTBOX_DIR", ""),
+			OutboxMax:      outboxMax,
 		},
 		OpenAI: OpenAIConfig{
 			APIKey:          getEnv("OPENAI_API_KEY", ""),
@@ -90,8 +227,62 @@ func Load() (*Config, error) {
 			Timeout:  90 * time.Second,
 		},
 		Vision: VisionConfig{
+			Provider:        getEnv("OCR_PROVIDER", "google_vision"),
 			CredentialsFile: getEnv("GOOGLE_VISION_CREDENTIALS", ""),
-			Enabled:         getEnv("GOOGLE_VISION_ENABLED", "true") == "true",
+			Enabled:         getEnv("OCR_ENABLED", getEnv("GOOGLE_VISION_ENABLED", "true")) == "true",
+			Tesseract: TesseractConfig{
+				Path:      getEnv("TESSERACT_PATH", "tesseract"),
+				Languages: getEnv("TESSERACT_LANGUAGES", "eng"),
+				PSM:       tesseractPSM,
+				Timeout:   30 * time.Second,
+			},
+			Digits: DigitsConfig{
+				Templates: getEnv("DIGITS_TEMPLATES", ""),
+			},
+			Hybrid: HybridConfig{
+				Strategy:           getEnv("HYBRID_STRATEGY", "sequential"),
+				AgreementThreshold: agreementThreshold,
+				DigitVote:          getEnv("HYBRID_DIGIT_VOTE", "false") == "true",
+				RegionWorkers:      regionWorkers,
+			},
+		},
+		Pricing: PricingConfig{
+			File: getEnv("PRICING_FILE", ""),
+		},
+		Admin: AdminConfig{
+			Token: getEnv("ADMIN_TOKEN", ""),
+		},
+		Prompt: PromptConfig{
+			Version:    getEnv("PROMPT_VERSION", "v1"),
+			Experiment: getEnv("PROMPT_EXPERIMENT", ""),
+		},
+		Preprocess: PreprocessConfig{
+			Enabled:      getEnv("PREPROCESS_ENABLED", "false") == "true",
+			MaxDimension: maxDimension,
+			MaxPixels:    maxPixels,
+			Steps:        splitList(getEnv("PREPROCESS_STEPS", "orient,resize,contrast,deskew,crop")),
+			PDFRenderer:  getEnv("PDF_RENDERER", "pdftoppm"),
+		},
+		Batch: BatchConfig{
+			Workers:       batchWorkers,
+			RatePerMinute: batchRate,
+			MaxImages:     batchMax,
+			Retention:     time.Duration(batchRetention) * time.Hour,
+		},
+		RateLimit: RateLimitConfig{
+			Enabled:   getEnv("RATE_LIMIT_ENABLED", "true") == "true",
+			Store:     getEnv("RATE_LIMIT_STORE", "memory"),
+			IP:        rateFromEnv("RATE_LIMIT_IP", "60", "20"),
+			User:      rateFromEnv("RATE_LIMIT_USER", "20", "10"),
+			Key:       rateFromEnv("RATE_LIMIT_KEY", "120", "30"),
+			IPQuota:   quotaFromEnv("SCAN_QUOTA_IP", "200", "0"),
+			UserQuota: quotaFromEnv("SCAN_QUOTA_USER", "50", "500"),
+			KeyQuota:  quotaFromEnv("SCAN_QUOTA_KEY", "0", "0"),
+		},
+		Auth: AuthConfig{
+			JWTSecret:  getEnv("JWT_SECRET", ""),
+			AccessTTL:  time.Duration(accessTTL) * time.Minute,
+			RefreshTTL: time.Duration(refreshTTL) * 24 * time.Hour,
 		},
 	}, nil
 }
@@ -102,3 +293,27 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+// rateFromEnv reads <prefix>_PER_MINUTE and <prefix>_BURST.
+func rateFromEnv(prefix, perMinute, burst string) Rate {
+	r, _ := strconv.ParseFloat(getEnv(prefix+"_PER_MINUTE", perMinute), 64)
+	b, _ := strconv.Atoi(getEnv(prefix+"_BURST", burst))
+	return Rate{PerMinute: r, Burst: b}
+}
+
+// quotaFromEnv reads <prefix>_DAILY and <prefix>_MONTHLY.
+func quotaFromEnv(prefix, daily, monthly string) Quota {
+	d, _ := strconv.ParseInt(getEnv(prefix+"_DAILY", daily), 10, 64)
+	m, _ := strconv.ParseInt(getEnv(prefix+"_MONTHLY", monthly), 10, 64)
+	return Quota{Daily: d, Monthly: m}
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"loto/internal/model"
+)
+
+// CreateAPIKey creates a partner key. The key is in the response only once.
+func (h *Handler) CreateAPIKey(c *gin.Context) {
+	var req model.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.fail(c, invalidRequest(err))
+		return
+	}
+
+	key, err := h.svc.CreateAPIKey(c.Request.Context(), req)
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, key)
+}
+
+func (h *Handler) ListAPIKeys(c *gin.Context) {
+	keys, err := h.svc.ListAPIKeys(c.Request.Context())
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, model.APIKeyList{Keys: keys})
+}
+
+func (h *Handler) RotateAPIKey(c *gin.Context) {
+	var req model.RotateAPIKeyRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			h.fail(c, invalidRequest(err))
+			return
+		}
+	}
+
+	key, err := h.svc.RotateAPIKey(c.Request.Context(), c.Param("id"), req)
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, key)
+}
+
+func (h *Handler) RevokeAPIKey(c *gin.Context) {
+	err := h.svc.RevokeAPIKey(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) GetAPIKeyUsage(c *gin.Context) {
+	from, to, ok := dateRange(c)
+	if !ok {
+		return
+	}
+
+	usage, err := h.svc.GetAPIKeyUsage(c.Request.Context(), c.Param("id"), from, to)
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+
+	resp := model.APIKeyUsageResponse{Usage: usage}
+	for _, u := range usage {
+		resp.Total.Requests += u.Requests
+		resp.Total.Errors += u.Errors
+		resp.Total.Scans += u.Scans
+		resp.Total.CostUSD += u.CostUSD
+	}
+	c.JSON(http.StatusOK, resp)
+}
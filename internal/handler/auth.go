@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"loto/internal/auth"
+	"loto/internal/model"
+)
+
+// Context keys set by RequireAuth.
+const (
+	userKey   = "user_id"
+	scopesKey = "scopes"
+	apiKeyKey = "api_key_id"
+)
+
+// RequireAuth accepts requests carrying a valid access token in
+// "Authorization: Bearer <token>" or a partner key in X-API-Key, and stores
+// the caller's user and scopes for the handlers. Requests made with a key
+// are counted in its usage once handled.
+func (h *Handler) RequireAuth(tokens *auth.Tokens) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if key := c.GetHeader("X-API-Key"); key != "" {
+			k, err := h.svc.VerifyAPIKey(c.Request.Context(), key)
+			if err != nil {
+				h.fail(c, err)
+				return
+			}
+			c.Set(userKey, k.UserID)
+			c.Set(scopesKey, k.Scopes)
+			c.Set(apiKeyKey, k.ID)
+			c.Next()
+			h.svc.RecordAPIKeyUse(context.WithoutCancel(c.Request.Context()), k.ID, c.Writer.Status() >= http.StatusBadRequest)
+			return
+		}
+
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok {
+			c.Header("WWW-Authenticate", "Bearer")
+			abortWithError(c, errAuthRequired)
+			return
+		}
+		claims, err := tokens.Verify(strings.TrimSpace(token))
+		if err != nil {
+			c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+			abortWithError(c, errInvalidToken.Wrap(err))
+			return
+		}
+		c.Set(userKey, claims.Subject)
+		c.Set(scopesKey, model.UserScopes)
+		c.Next()
+	}
+}
+
+// RequireScope rejects callers whose credentials lack scope.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !slices.Contains(c.GetStringSlice(scopesKey), scope) {
+			abortWithError(c, errMissingScope.Withf("missing scope %s", scope))
+			return
+		}
+		c.Next()
+	}
+}
+
+// currentUser returns the user authenticated by RequireAuth.
+func currentUser(c *gin.Context) string {
+	return c.GetString(userKey)
+}
+
+// currentAPIKey returns the key the request was made with, or "" for user
+// sessions.
+func currentAPIKey(c *gin.Context) string {
+	return c.GetString(apiKeyKey)
+}
+
+func (h *Handler) Register(c *gin.Context) {
+	var req model.RegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.fail(c, invalidRequest(err))
+		return
+	}
+	resp, err := h.svc.Register(c.Request.Context(), req)
+	h.authResponse(c, resp, err)
+}
+
+func (h *Handler) Login(c *gin.Context) {
+	var req model.LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.fail(c, invalidRequest(err))
+		return
+	}
+	resp, err := h.svc.Login(c.Request.Context(), req)
+	h.authResponse(c, resp, err)
+}
+
+// DeviceLogin logs in, or creates, the anonymous account of an app install.
+func (h *Handler) DeviceLogin(c *gin.Context) {
+	var req model.DeviceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.fail(c, invalidRequest(err))
+		return
+	}
+	resp, err := h.svc.DeviceLogin(c.Request.Context(), req)
+	h.authResponse(c, resp, err)
+}
+
+func (h *Handler) Refresh(c *gin.Context) {
+	var req model.RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.fail(c, invalidRequest(err))
+		return
+	}
+	resp, err := h.svc.Refresh(c.Request.Context(), req)
+	h.authResponse(c, resp, err)
+}
+
+func (h *Handler) Logout(c *gin.Context) {
+	var req model.RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.fail(c, invalidRequest(err))
+		return
+	}
+	if err := h.svc.Logout(c.Request.Context(), req); err != nil {
+		h.fail(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// UpgradeAccount adds an email and password to the caller's device account.
+func (h *Handler) UpgradeAccount(c *gin.Context) {
+	var req model.RegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.fail(c, invalidRequest(err))
+		return
+	}
+	resp, err := h.svc.UpgradeAccount(c.Request.Context(), currentUser(c), req)
+	h.authResponse(c, resp, err)
+}
+
+func (h *Handler) Me(c *gin.Context) {
+	user, err := h.svc.GetUser(c.Request.Context(), currentUser(c))
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+func (h *Handler) authResponse(c *gin.Context, resp *model.AuthResponse, err error) {
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
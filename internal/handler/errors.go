@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"loto/internal/model"
+	"loto/internal/service"
+)
+
+const requestIDKey = "request_id"
+
+// validRequestID limits the request IDs accepted from clients and proxies,
+// since they end up in logs and response bodies.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// RequestID tags each request with the X-Request-ID it came with, or a new
+// one, and echoes it in the response.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader("X-Request-ID")
+		if !validRequestID.MatchString(id) {
+			id = uuid.NewString()
+		}
+		c.Set(requestIDKey, id)
+		c.Header("X-Request-ID", id)
+		c.Next()
+	}
+}
+
+// Errors raised by the handlers themselves rather than the service.
+var (
+	errInvalidRequest    = service.NewError(service.ErrInvalidInput, "invalid_request", "invalid request")
+	errInvalidDate       = service.NewError(service.ErrInvalidInput, "invalid_date", "dates must be YYYY-MM-DD")
+	errImageRequired     = service.NewError(service.ErrInvalidInput, "image_required", "image file is required")
+	errMultipartRequired = service.NewError(service.ErrInvalidInput, "multipart_required", "multipart form is required")
+	errAuthRequired      = service.NewError(service.ErrUnauthenticated, "authorization_required", "authorization required")
+	errInvalidToken      = service.NewError(service.ErrUnauthenticated, "invalid_token", "invalid access token")
+	errForbidden         = service.NewError(service.ErrForbidden, "forbidden", "forbidden")
+	errMissingScope      = service.NewError(service.ErrForbidden, "missing_scope", "missing scope")
+	errRateLimited       = service.NewError(service.ErrQuotaExceeded, "rate_limited", "rate limit exceeded")
+	errScanQuota         = service.NewError(service.ErrQuotaExceeded, "scan_quota_exceeded", "scan quota exceeded")
+	errRouteNotFound     = service.NewError(service.ErrNotFound, "route_not_found", "route not found")
+)
+
+// errorKinds maps each kind of service error to its status, and to the code
+// whose message is used when an error's own code has none.
+var errorKinds = []struct {
+	kind   error
+	status int
+	code   string
+}{
+	{service.ErrNotFound, http.StatusNotFound, "not_found"},
+	{service.ErrInvalidInput, http.StatusBadRequest, "invalid_input"},
+	{service.ErrUnauthenticated, http.StatusUnauthorized, "unauthenticated"},
+	{service.ErrForbidden, http.StatusForbidden, "forbidden"},
+	{service.ErrConflict, http.StatusConflict, "conflict"},
+	{service.ErrQuotaExceeded, http.StatusTooManyRequests, "quota_exceeded"},
+	{service.ErrProviderUnavailable, http.StatusServiceUnavailable, "provider_unavailable"},
+	{service.ErrDBDisabled, http.StatusServiceUnavailable, "database_disabled"},
+	{service.ErrDBUnavailable, http.StatusServiceUnavailable, "database_unavailable"},
+}
+
+// errorMessages holds the English and Vietnamese message of each code.
+var errorMessages = map[string]map[string]string{
+	"internal":             {"en": "Something went wrong, please try again", "vi": "Đã xảy ra lỗi, vui lòng thử lại"},
+	"not_found":            {"en": "Not found", "vi": "Không tìm thấy"},
+	"invalid_input":        {"en": "Invalid input", "vi": "Dữ liệu không hợp lệ"},
+	"unauthenticated":      {"en": "Please log in", "vi": "Vui lòng đăng nhập"},
+	"forbidden":            {"en": "Access denied", "vi": "Không có quyền truy cập"},
+	"conflict":             {"en": "Conflicts with existing data", "vi": "Xung đột với dữ liệu hiện có"},
+	"quota_exceeded":       {"en": "Limit exceeded", "vi": "Đã vượt quá giới hạn"},
+	"provider_unavailable": {"en": "Service temporarily unavailable, please try again", "vi": "Dịch vụ tạm thời không khả dụng, vui lòng thử lại"},
+	"database_disabled":    {"en": "History is not available on this server", "vi": "Máy chủ này không lưu lịch sử"},
+	"database_unavailable": {"en": "Your data is temporarily unavailable, please try again", "vi": "Dữ liệu của bạn tạm thời không khả dụng, vui lòng thử lại"},
+
+	"route_not_found":         {"en": "Route not found", "vi": "Không tìm thấy đường dẫn"},
+	"invalid_request":         {"en": "Invalid request", "vi": "Yêu cầu không hợp lệ"},
+	"invalid_date":            {"en": "Dates must be YYYY-MM-DD", "vi": "Ngày phải có dạng YYYY-MM-DD"},
+	"invalid_cursor":          {"en": "Invalid page cursor, please reload the list", "vi": "Con trỏ trang không hợp lệ, vui lòng tải lại danh sách"},
+	"image_required":          {"en": "Please attach a photo of the card", "vi": "Vui lòng đính kèm ảnh vé dò"},
+	"multipart_required":      {"en": "Upload must be a multipart form", "vi": "Dữ liệu tải lên phải là multipart form"},
+	"unsupported_file_type":   {"en": "Unsupported image format", "vi": "Định dạng ảnh không được hỗ trợ"},
+	"unreadable_image":        {"en": "The image could not be read", "vi": "Không đọc được ảnh"},
+	"image_too_large":         {"en": "The image has too many pixels", "vi": "Ảnh có quá nhiều điểm ảnh"},
+	"ai_unavailable":          {"en": "Scanning is temporarily unavailable, please try again", "vi": "Tạm thời không quét được vé, vui lòng thử lại"},
+	"invalid_batch":           {"en": "Invalid batch of images", "vi": "Lô ảnh không hợp lệ"},
+	"batch_id_in_use":         {"en": "This batch ID is already in use", "vi": "Mã lô đã được sử dụng"},
+	"batch_not_found":         {"en": "Batch not found", "vi": "Không tìm thấy lô ảnh"},
+	"scan_not_found":          {"en": "Scan not found", "vi": "Không tìm thấy lượt quét"},
+	"user_not_found":          {"en": "User not found", "vi": "Không tìm thấy người dùng"},
+	"authorization_required":  {"en": "Please log in", "vi": "Vui lòng đăng nhập"},
+	"invalid_token":           {"en": "Session expired, please log in again", "vi": "Phiên đăng nhập đã hết hạn, vui lòng đăng nhập lại"},
+	"invalid_credentials":     {"en": "Wrong email or password", "vi": "Sai email hoặc mật khẩu"},
+	"invalid_refresh_token":   {"en": "Session expired, please log in again", "vi": "Phiên đăng nhập đã hết hạn, vui lòng đăng nhập lại"},
+	"email_taken":             {"en": "This email is already registered", "vi": "Email này đã được đăng ký"},
+	"account_registered":      {"en": "This account already has an email", "vi": "Tài khoản này đã có email"},
+	"missing_scope":           {"en": "Your credentials do not allow this", "vi": "Thông tin xác thực không có quyền thực hiện thao tác này"},
+	"invalid_api_key":         {"en": "Invalid API key", "vi": "API key không hợp lệ"},
+	"invalid_api_key_request": {"en": "Invalid API key request", "vi": "Yêu cầu API key không hợp lệ"},
+	"api_key_not_found":       {"en": "API key not found", "vi": "Không tìm thấy API key"},
+	"rate_limited":            {"en": "Too many requests, please slow down", "vi": "Quá nhiều yêu cầu, vui lòng thử lại sau"},
+	"scan_quota_exceeded":     {"en": "You have used up your scans for now", "vi": "Bạn đã dùng hết lượt quét hiện có"},
+}
+
+// errorResponse maps err to a status and body. Other errors that are not
+// service errors, or a kind of one, are internal: their text is not shown
+// to the client.
+func errorResponse(c *gin.Context, err error) (int, model.ErrorResponse) {
+	status, code, fallback := http.StatusInternalServerError, "internal", "internal"
+	var svcErr *service.Error
+	if errors.As(err, &svcErr) {
+		for _, k := range errorKinds {
+			if errors.Is(svcErr.Kind, k.kind) {
+				status, code, fallback = k.status, svcErr.Code, k.code
+				break
+			}
+		}
+	} else {
+		for _, k := range errorKinds {
+			if errors.Is(err, k.kind) {
+				status, code, fallback = k.status, k.code, k.code
+				break
+			}
+		}
+	}
+
+	messages, ok := errorMessages[code]
+	if !ok {
+		messages = errorMessages[fallback]
+	}
+	locale := preferredLocale(c.GetHeader("Accept-Language"))
+	if locale == "" {
+		locale = "en"
+	}
+
+	body := model.ErrorResponse{Error: model.APIError{
+		Code:      code,
+		Message:   messages[locale],
+		RequestID: c.GetString(requestIDKey),
+	}}
+	if status < http.StatusInternalServerError {
+		body.Error.Detail = err.Error()
+	}
+	return status, body
+}
+
+// abortWithError writes err as the response and stops the handler chain.
+func abortWithError(c *gin.Context, err error) int {
+	status, body := errorResponse(c, err)
+	c.AbortWithStatusJSON(status, body)
+	return status
+}
+
+// fail writes err as the response, logging server errors.
+func (h *Handler) fail(c *gin.Context, err error) {
+	if status := abortWithError(c, err); status >= http.StatusInternalServerError {
+		h.logger.Error("request failed",
+			zap.String("request_id", c.GetString(requestIDKey)),
+			zap.String("route", c.FullPath()),
+			zap.Int("status", status),
+			zap.Error(err),
+		)
+	}
+}
+
+// invalidRequest reports a request that failed binding or validation.
+func invalidRequest(err error) error {
+	return errInvalidRequest.Wrap(err)
+}
+
+// RouteNotFound answers requests to unknown routes in the common error format.
+func RouteNotFound(c *gin.Context) {
+	abortWithError(c, errRouteNotFound.Withf("no route for %s %s", c.Request.Method, c.Request.URL.Path))
+}
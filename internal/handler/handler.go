@@ -1,17 +1,30 @@
 package handler
 
 import (
+	"archive/zip"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"mime/multipart"
 	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 
+	"loto/internal/model"
+	"loto/internal/openapi"
+	"loto/internal/ratelimit"
 	"loto/internal/service"
 )
 
 type Handler struct {
-	svc    *service.Service
-	logger *zap.Logger
+	svc     *service.Service
+	limiter *ratelimit.Limiter
+	logger  *zap.Logger
 }
 
 func New(svc *service.Service, logger *zap.Logger) *Handler {
@@ -19,62 +32,370 @@ func New(svc *service.Service, logger *zap.Logger) *Handler {
 }
 
 func (h *Handler) ScanTicket(c *gin.Context) {
-	file, header, err := c.Request.FormFile("image")
+	file, header, req, ok := h.bindScan(c)
+	if !ok {
+		return
+	}
+	defer file.Close()
+	if !h.useScans(c, 1) {
+		return
+	}
+
+	resp, err := h.svc.ScanTicket(c.Request.Context(), file, header, req)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "image file is required"})
+		h.fail(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// ScanTickets returns every card found in the photo.
+func (h *Handler) ScanTickets(c *gin.Context) {
+	file, header, req, ok := h.bindScan(c)
+	if !ok {
 		return
 	}
 	defer file.Close()
+	if !h.useScans(c, 1) {
+		return
+	}
+
+	resp, err := h.svc.ScanTickets(c.Request.Context(), file, header, req)
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// maxBatchImageBytes caps each image of a batch, including zip entries, so a
+// crafted archive cannot expand without bound.
+const maxBatchImageBytes = 20 << 20
+
+// StartBatch accepts images as repeated "images" form files and/or a zip in
+// "archive", and starts scanning them in the background.
+func (h *Handler) StartBatch(c *gin.Context) {
+	var req model.ScanRequest
+	if err := c.ShouldBind(&req); err != nil {
+		h.fail(c, invalidRequest(err))
+		return
+	}
+	if req.Locale == "" {
+		req.Locale = preferredLocale(c.GetHeader("Accept-Language"))
+	}
+	req.UserID = currentUser(c)
+	req.APIKeyID = currentAPIKey(c)
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		h.fail(c, errMultipartRequired)
+		return
+	}
+	// A resent batch is returned without scanning, or counting, it again,
+	// and a batch_id that cannot be used is refused before counting.
+	batchID := c.PostForm("batch_id")
+	if batchID != "" {
+		existing, err := h.svc.ResentBatch(c.Request.Context(), req.UserID, batchID)
+		if err != nil {
+			h.fail(c, err)
+			return
+		}
+		if existing != nil {
+			c.JSON(http.StatusAccepted, existing)
+			return
+		}
+	}
+	images, err := batchImages(form)
+	if err != nil {
+		h.fail(c, service.ErrInvalidBatch.Wrap(err))
+		return
+	}
+	if !h.useScans(c, len(images)) {
+		return
+	}
 
-	var userID *string
-	if uid := c.PostForm("user_id"); uid != "" {
-		userID = &uid
+	resp, err := h.svc.StartBatch(c.Request.Context(), batchID, images, req)
+	if err != nil {
+		h.fail(c, err)
+		return
 	}
 
-	resp, err := h.svc.ScanTicket(c.Request.Context(), file, header, userID)
+	c.JSON(http.StatusAccepted, resp)
+}
+
+func (h *Handler) GetBatch(c *gin.Context) {
+	resp, err := h.svc.GetBatch(c.Request.Context(), currentUser(c), c.Param("id"))
 	if err != nil {
-		h.logger.Error("scan failed", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		h.fail(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, resp)
 }
 
+func batchImages(form *multipart.Form) ([]service.BatchImage, error) {
+	var images []service.BatchImage
+	for _, fh := range form.File["images"] {
+		data, err := readFormFile(fh)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, service.BatchImage{Filename: fh.Filename, Data: data})
+	}
+
+	for _, fh := range form.File["archive"] {
+		f, err := fh.Open()
+		if err != nil {
+			return nil, err
+		}
+		entries, err := zipImages(f, fh.Size)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fh.Filename, err)
+		}
+		images = append(images, entries...)
+	}
+
+	if len(images) == 0 {
+		return nil, fmt.Errorf("no images: send files as \"images\" or a zip as \"archive\"")
+	}
+	return images, nil
+}
+
+func readFormFile(fh *multipart.FileHeader) ([]byte, error) {
+	if fh.Size > maxBatchImageBytes {
+		return nil, fmt.Errorf("%s is larger than %d MB", fh.Filename, maxBatchImageBytes>>20)
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// zipImages reads the files of a zip archive in name order, skipping
+// directories and macOS metadata.
+func zipImages(r io.ReaderAt, size int64) ([]service.BatchImage, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("invalid zip: %w", err)
+	}
+
+	files := append([]*zip.File(nil), zr.File...)
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+
+	var images []service.BatchImage
+	for _, zf := range files {
+		name := path.Base(zf.Name)
+		if zf.FileInfo().IsDir() || strings.HasPrefix(zf.Name, "__MACOSX/") || strings.HasPrefix(name, ".") {
+			continue
+		}
+		if zf.UncompressedSize64 > maxBatchImageBytes {
+			return nil, fmt.Errorf("%s is larger than %d MB", zf.Name, maxBatchImageBytes>>20)
+		}
+
+		rc, err := zf.Open()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", zf.Name, err)
+		}
+		data, err := io.ReadAll(io.LimitReader(rc, maxBatchImageBytes+1))
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", zf.Name, err)
+		}
+		if len(data) > maxBatchImageBytes {
+			return nil, fmt.Errorf("%s is larger than %d MB", zf.Name, maxBatchImageBytes>>20)
+		}
+		images = append(images, service.BatchImage{Filename: name, Data: data})
+	}
+	return images, nil
+}
+
+func (h *Handler) bindScan(c *gin.Context) (multipart.File, *multipart.FileHeader, model.ScanRequest, bool) {
+	var req model.ScanRequest
+	file, header, err := c.Request.FormFile("image")
+	if err != nil {
+		h.fail(c, errImageRequired)
+		return nil, nil, req, false
+	}
+
+	if err := c.ShouldBind(&req); err != nil {
+		file.Close()
+		h.fail(c, invalidRequest(err))
+		return nil, nil, req, false
+	}
+	if req.Locale == "" {
+		req.Locale = preferredLocale(c.GetHeader("Accept-Language"))
+	}
+	req.UserID = currentUser(c)
+	req.APIKeyID = currentAPIKey(c)
+	return file, header, req, true
+}
+
+// GetScanHistory returns a page of the caller's own scans.
 func (h *Handler) GetScanHistory(c *gin.Context) {
-	userID := c.Query("user_id")
-	if userID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
+	var q model.ScanHistoryQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		h.fail(c, invalidRequest(err))
+		return
+	}
+
+	history, err := h.svc.GetScanHistory(c.Request.Context(), currentUser(c), q)
+	if err != nil {
+		h.fail(c, err)
 		return
 	}
 
-	history, err := h.svc.GetScanHistory(c.Request.Context(), userID)
+	c.JSON(http.StatusOK, history)
+}
+
+// GetScan returns one of the caller's scans.
+func (h *Handler) GetScan(c *gin.Context) {
+	scan, err := h.svc.GetScan(c.Request.Context(), currentUser(c), c.Param("id"))
 	if err != nil {
-		h.logger.Error("failed to get scan history", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get scan history"})
+		h.fail(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"scans": history})
+	c.JSON(http.StatusOK, scan)
+}
+
+// GetAdminScan returns any scan as stored, cost and usage included.
+func (h *Handler) GetAdminScan(c *gin.Context) {
+	scan, err := h.svc.GetScanByID(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, scan)
 }
 
 func (h *Handler) CheckResult(c *gin.Context) {
 	scanID := c.Query("scan_id")
 	if scanID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "scan_id is required"})
+		h.fail(c, errInvalidRequest.Withf("scan_id is required"))
 		return
 	}
 
-	result, err := h.svc.CheckResult(c.Request.Context(), scanID)
+	result, err := h.svc.CheckResult(c.Request.Context(), currentUser(c), scanID)
 	if err != nil {
-		h.logger.Error("failed to check result", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check result"})
+		h.fail(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, result)
 }
 
+func (h *Handler) GetDailyUsage(c *gin.Context) {
+	from, to, ok := dateRange(c)
+	if !ok {
+		return
+	}
+
+	usage, err := h.svc.GetDailyUsage(c.Request.Context(), from, to)
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+
+	var total float64
+	for _, u := range usage {
+		total += u.CostUSD
+	}
+
+	c.JSON(http.StatusOK, model.UsageResponse{Usage: usage, TotalCostUSD: total})
+}
+
+func (h *Handler) GetPromptStats(c *gin.Context) {
+	from, to, ok := dateRange(c)
+	if !ok {
+		return
+	}
+
+	stats, err := h.svc.GetPromptStats(c.Request.Context(), from, to)
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, model.PromptStatsResponse{Prompts: stats})
+}
+
+func (h *Handler) GetSuspiciousCards(c *gin.Context) {
+	from, to, ok := dateRange(c)
+	if !ok {
+		return
+	}
+
+	cards, err := h.svc.GetSuspiciousCards(c.Request.Context(), from, to)
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, model.SuspiciousCardsResponse{Cards: cards})
+}
+
+// dateRange reads inclusive from/to query dates (YYYY-MM-DD), defaulting to
+// the last 30 days. It writes a 400 and returns ok=false on bad input.
+func dateRange(c *gin.Context) (time.Time, time.Time, bool) {
+	to := time.Now().UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+	from := to.AddDate(0, 0, -30)
+
+	if v := c.Query("from"); v != "" {
+		t, err := time.Parse(time.DateOnly, v)
+		if err != nil {
+			abortWithError(c, errInvalidDate.Withf("from must be YYYY-MM-DD"))
+			return time.Time{}, time.Time{}, false
+		}
+		from = t
+	}
+	if v := c.Query("to"); v != "" {
+		t, err := time.Parse(time.DateOnly, v)
+		if err != nil {
+			abortWithError(c, errInvalidDate.Withf("to must be YYYY-MM-DD"))
+			return time.Time{}, time.Time{}, false
+		}
+		to = t.Add(24 * time.Hour)
+	}
+	return from, to, true
+}
+
+func preferredLocale(acceptLanguage string) string {
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, _, _ := strings.Cut(strings.TrimSpace(part), ";")
+		lang, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		if lang == "vi" || lang == "en" {
+			return lang
+		}
+	}
+	return ""
+}
+
+// AdminAuth guards admin routes with a shared token sent in X-Admin-Token.
+// An empty token disables the routes entirely.
+func AdminAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		got := c.GetHeader("X-Admin-Token")
+		if token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			abortWithError(c, errForbidden)
+			return
+		}
+		c.Next()
+	}
+}
+
+// OpenAPI serves the API description.
+func OpenAPI(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json", openapi.JSON())
+}
+
+// HealthCheck answers 200 while degraded too: the server still scans, and
+// queues the scans until the database is back.
 func (h *Handler) HealthCheck(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	c.JSON(http.StatusOK, h.svc.Health())
 }
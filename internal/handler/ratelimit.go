@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"loto/internal/ratelimit"
+)
+
+func (h *Handler) SetLimiter(l *ratelimit.Limiter) {
+	h.limiter = l
+}
+
+// RateLimit throttles requests with a token bucket per caller. Placed before
+// RequireAuth it limits by client IP, after it by user or API key, so both
+// can be stacked on one group. Limits are reported in X-RateLimit-Limit,
+// X-RateLimit-Remaining and X-RateLimit-Reset (seconds until the bucket is
+// full). If the store fails the request is let through.
+func (h *Handler) RateLimit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if h.limiter == nil {
+			c.Next()
+			return
+		}
+
+		res, err := h.limiter.Allow(c.Request.Context(), caller(c))
+		if err != nil {
+			h.logger.Error("rate limit check failed", zap.Error(err))
+		}
+		if res.Limit > 0 {
+			c.Header("X-RateLimit-Limit", strconv.FormatInt(res.Limit, 10))
+			c.Header("X-RateLimit-Remaining", strconv.FormatInt(res.Remaining, 10))
+			c.Header("X-RateLimit-Reset", strconv.Itoa(seconds(res.Reset)))
+		}
+		if !res.Allowed {
+			tooManyRequests(c, res, errRateLimited)
+			return
+		}
+		c.Next()
+	}
+}
+
+// useScans counts n scans against the quotas of the caller and its IP. It
+// reports the tightest quota in X-Quota-Limit, X-Quota-Remaining and
+// X-Quota-Reset, and writes a 429 and returns false when a quota is used up.
+func (h *Handler) useScans(c *gin.Context, n int) bool {
+	if h.limiter == nil {
+		return true
+	}
+
+	subjects := []ratelimit.Subject{caller(c)}
+	if subjects[0].Kind != ratelimit.KindIP {
+		subjects = append(subjects, ratelimit.Subject{Kind: ratelimit.KindIP, ID: c.ClientIP()})
+	}
+	res, err := h.limiter.UseScans(c.Request.Context(), n, subjects...)
+	if err != nil {
+		h.logger.Error("scan quota check failed", zap.Error(err))
+	}
+	if res.Limit > 0 {
+		c.Header("X-Quota-Limit", strconv.FormatInt(res.Limit, 10))
+		c.Header("X-Quota-Remaining", strconv.FormatInt(res.Remaining, 10))
+		c.Header("X-Quota-Reset", strconv.Itoa(seconds(res.Reset)))
+	}
+	if !res.Allowed {
+		tooManyRequests(c, res, errScanQuota)
+		return false
+	}
+	return true
+}
+
+// caller identifies the client for limits: its API key, else its user, else
+// its IP.
+func caller(c *gin.Context) ratelimit.Subject {
+	if key := currentAPIKey(c); key != "" {
+		return ratelimit.Subject{Kind: ratelimit.KindKey, ID: key}
+	}
+	if user := currentUser(c); user != "" {
+		return ratelimit.Subject{Kind: ratelimit.KindUser, ID: user}
+	}
+	return ratelimit.Subject{Kind: ratelimit.KindIP, ID: c.ClientIP()}
+}
+
+func tooManyRequests(c *gin.Context, res ratelimit.Result, err error) {
+	retry := seconds(res.RetryAfter)
+	c.Header("Retry-After", strconv.Itoa(retry))
+	status, body := errorResponse(c, err)
+	body.Error.RetryAfter = retry
+	c.AbortWithStatusJSON(status, body)
+}
+
+// seconds rounds d up to whole seconds, at least 1.
+func seconds(d time.Duration) int {
+	return max(1, int(math.Ceil(d.Seconds())))
+}
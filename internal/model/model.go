@@ -8,10 +8,59 @@ type Scan struct {
 	ID               string    `json:"id" db:"id"`
 	UserID           *string   `json:"user_id,omitempty" db:"user_id"`
 	ImageURL         string    `json:"image_url" db:"image_url"`
+	LotteryType      string    `json:"lottery_type" db:"lottery_type"`
+	Blocks           []Block   `json:"blocks" db:"blocks"`
 	ExtractedNumbers []int     `json:"extracted_numbers" db:"extracted_numbers"`
 	Confidence       float64   `json:"confidence" db:"confidence"`
 	Status           string    `json:"status" db:"status"`
+	Notes            string    `json:"notes,omitempty" db:"notes"`
+	Provider         string    `json:"provider" db:"provider"`
+	Model            string    `json:"model" db:"model"`
+	CostUSD          float64   `json:"cost_usd" db:"cost_usd"`
+	PromptVersion    string    `json:"prompt_version" db:"prompt_version"`
+	Path             string    `json:"path" db:"scan_path"`
+	DurationMS       int64     `json:"duration_ms" db:"duration_ms"`
+	Preprocessing    []string  `json:"preprocessing" db:"preprocessing"`
+	UploadID         *string   `json:"upload_id,omitempty" db:"upload_id"`
+	CardIndex        int       `json:"card_index" db:"card_index"`
+	Fingerprint      *string   `json:"fingerprint,omitempty" db:"card_fingerprint"`
+	TicketID         *string   `json:"ticket_id,omitempty" db:"ticket_id"`
+	APIKeyID         *string   `json:"api_key_id,omitempty" db:"api_key_id"`
+	Usage            []Usage   `json:"usage,omitempty" db:"-"`
 	CreatedAt        time.Time `json:"created_at" db:"created_at"`
+
+	// The raw OCR tokens and model output are kept for debugging and are
+	// not served.
+	OCRTokens   []OCRToken `json:"-" db:"ocr_tokens"`
+	RawResponse string     `json:"-" db:"raw_response"`
+}
+
+type Usage struct {
+	Provider       string  `json:"provider" db:"provider"`
+	Model          string  `json:"model" db:"model"`
+	InputTokens    int64   `json:"input_tokens" db:"input_tokens"`
+	OutputTokens   int64   `json:"output_tokens" db:"output_tokens"`
+	ThinkingTokens int64   `json:"thinking_tokens" db:"thinking_tokens"`
+	Units          int64   `json:"units" db:"units"`
+	CostUSD        float64 `json:"cost_usd" db:"cost_usd"`
+}
+
+type UsageAggregate struct {
+	Day            time.Time `json:"day"`
+	Provider       string    `json:"provider"`
+	Model          string    `json:"model"`
+	Calls          int64     `json:"calls"`
+	Scans          int64     `json:"scans"`
+	InputTokens    int64     `json:"input_tokens"`
+	OutputTokens   int64     `json:"output_tokens"`
+	ThinkingTokens int64     `json:"thinking_tokens"`
+	Units          int64     `json:"units"`
+	CostUSD        float64   `json:"cost_usd"`
+}
+
+type UsageResponse struct {
+	Usage        []UsageAggregate `json:"usage"`
+	TotalCostUSD float64          `json:"total_cost_usd"`
 }
 
 type LotteryResult struct {
@@ -28,6 +77,80 @@ type Block struct {
 	Row3 []int `json:"row3"`
 }
 
+// CellViolation is a structural problem on a LOTO card. Row and Index are
+// 1-based; Row is 0 for block-level problems and Index is 0 for row-level ones.
+type CellViolation struct {
+	Block    int    `json:"block"`
+	Row      int    `json:"row,omitempty"`
+	Index    int    `json:"index,omitempty"`
+	Number   int    `json:"number,omitempty"`
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+type Correction struct {
+	Block  int    `json:"block"`
+	Row    int    `json:"row"`
+	From   int    `json:"from"`
+	To     int    `json:"to"`
+	Reason string `json:"reason"`
+}
+
+const (
+	CellSourceOCR       = "ocr"
+	CellSourceAI        = "ai"
+	CellSourceBoth      = "both"
+	CellSourceCorrected = "corrected"
+)
+
+// CellDetail describes one number on a LOTO card. It parallels Blocks so
+// existing clients keep working: Block and Row are 1-based, Index is the
+// 1-based position within Block.RowN and Col the 1-based card column.
+type CellDetail struct {
+	Block      int     `json:"block"`
+	Row        int     `json:"row"`
+	Index      int     `json:"index"`
+	Col        int     `json:"col"`
+	Number     int     `json:"number"`
+	Confidence float64 `json:"confidence"`
+	Source     string  `json:"source"`
+}
+
+// ReconcileDecision records how the hybrid scanner settled one card cell
+// where OCR and AI did not simply agree. OCR and AI are 0 when that side saw
+// nothing, Digits when the digit classifier did not vote; Chosen is 0 when
+// the cell was left empty, and for an AI number dropped because another AI
+// number was kept in the same column.
+type ReconcileDecision struct {
+	Block  int    `json:"block"`
+	Row    int    `json:"row"`
+	Col    int    `json:"col"`
+	OCR    int    `json:"ocr"`
+	AI     int    `json:"ai"`
+	Digits int    `json:"digits,omitempty"`
+	Chosen int    `json:"chosen"`
+	Source string `json:"source"`
+	Reason string `json:"reason"`
+}
+
+const (
+	ModeAI     = "ai"
+	ModeOCR    = "ocr"
+	ModeHybrid = "hybrid"
+)
+
+// Scan paths record which route through the pipeline produced a result.
+const (
+	PathAI                = "ai"
+	PathSequential        = "sequential"
+	PathOCRFailed         = "ocr_failed"
+	PathAIFailed          = "ai_failed"
+	PathParallelAgreed    = "parallel_agreed"
+	PathParallelEscalated = "parallel_escalated"
+	PathParallelFallback  = "parallel_fallback"
+)
+
 type GPTScanResponse struct {
 	LotteryType string  `json:"lottery_type"`
 	Blocks      []Block `json:"blocks"`
@@ -35,6 +158,30 @@ type GPTScanResponse struct {
 	TicketID    string  `json:"ticket_id"`
 	Confidence  float64 `json:"confidence"`
 	Notes       string  `json:"notes"`
+	Usage       []Usage `json:"-"`
+
+	Violations  []CellViolation `json:"-"`
+	Corrections []Correction    `json:"-"`
+	Cells       []CellDetail    `json:"-"`
+
+	Reconciliation []ReconcileDecision `json:"-"`
+
+	// Mode is how the result was produced (ModeAI, ModeOCR or ModeHybrid);
+	// OCRLayout is kept for per-cell scoring after reconciliation.
+	Mode      string     `json:"-"`
+	Path      string     `json:"-"`
+	Region    *Region    `json:"-"`
+	OCRLayout *OCRLayout `json:"-"`
+
+	PromptVersion string `json:"-"`
+
+	// Provider and Model name the source of the result: the AI model, or
+	// the OCR engine for OCR-only scans. RawResponse is the model's text
+	// before parsing and OCRTokens what OCR read, both kept for debugging.
+	Provider    string     `json:"-"`
+	Model       string     `json:"-"`
+	RawResponse string     `json:"-"`
+	OCRTokens   []OCRToken `json:"-"`
 }
 
 type OCRToken struct {
@@ -52,10 +199,68 @@ type OCRScanResult struct {
 	Numbers    []int      `json:"numbers"`
 	Confidence float64    `json:"confidence"`
 	Provider   string     `json:"provider"`
+	Layout     *OCRLayout `json:"layout,omitempty"`
+	Usage      *Usage     `json:"-"`
 }
 
+// GridCell is an OCR number placed on the card grid. Block, Row and Col are
+// 1-based; Col follows the token's horizontal position.
+type GridCell struct {
+	Block      int     `json:"block"`
+	Row        int     `json:"row"`
+	Col        int     `json:"col"`
+	Number     int     `json:"number"`
+	Text       string  `json:"text"`
+	Confidence float64 `json:"confidence"`
+	X          int     `json:"x"`
+	Y          int     `json:"y"`
+	Width      int     `json:"width"`
+	Height     int     `json:"height"`
+	// Digits is the digit classifier's reading of the cell's box, 0 when
+	// the classifier is off or read nothing.
+	Digits int `json:"digits,omitempty"`
+}
+
+type OCRLayout struct {
+	Blocks int        `json:"blocks"`
+	Cells  []GridCell `json:"cells"`
+}
+
+// ScanRequest holds the form fields of a scan upload. UserID and APIKeyID are
+// taken from the caller's credentials, never from the form.
 type ScanRequest struct {
-	UserID string `form:"user_id"`
+	UserID      string `form:"-"`
+	APIKeyID    string `form:"-"`
+	LotteryType string `form:"lottery_type"`
+	Locale      string `form:"locale"`
+}
+
+type PromptStats struct {
+	PromptVersion     string  `json:"prompt_version"`
+	Scans             int64   `json:"scans"`
+	Confirmed         int64   `json:"confirmed"`
+	NeedsConfirmation int64   `json:"needs_confirmation"`
+	Rejected          int64   `json:"rejected"`
+	AvgConfidence     float64 `json:"avg_confidence"`
+	AvgNumbers        float64 `json:"avg_numbers"`
+}
+
+type PromptStatsResponse struct {
+	Prompts []PromptStats `json:"prompts"`
+}
+
+// Region is the part of the uploaded photo a card was read from, in pixels.
+type Region struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// UploadResponse holds one result per card found in an uploaded photo.
+type UploadResponse struct {
+	UploadID string         `json:"upload_id"`
+	Cards    []ScanResponse `json:"cards"`
 }
 
 type ScanResponse struct {
@@ -67,6 +272,94 @@ type ScanResponse struct {
 	Confidence  float64 `json:"confidence"`
 	Status      string  `json:"status"`
 	Notes       string  `json:"notes,omitempty"`
+
+	PromptVersion string          `json:"prompt_version,omitempty"`
+	Path          string          `json:"path,omitempty"`
+	Preprocessing []string        `json:"preprocessing,omitempty"`
+	Violations    []CellViolation `json:"violations,omitempty"`
+	Corrections   []Correction    `json:"corrections,omitempty"`
+	Cells         []CellDetail    `json:"cells,omitempty"`
+
+	Reconciliation []ReconcileDecision `json:"reconciliation,omitempty"`
+
+	UploadID  string  `json:"upload_id,omitempty"`
+	CardIndex int     `json:"card_index,omitempty"`
+	CardCount int     `json:"card_count,omitempty"`
+	Region    *Region `json:"region,omitempty"`
+
+	Fingerprint string   `json:"fingerprint,omitempty"`
+	Duplicates  []string `json:"duplicates,omitempty"`
+}
+
+// Reasons a card registration is reported as suspicious.
+const (
+	DuplicateLayout   = "duplicate_layout"
+	DuplicateTicketID = "duplicate_ticket_id"
+)
+
+// SuspiciousCard groups the scans sharing one card fingerprint or ticket ID
+// that were registered by more than one user, or, for a ticket ID, that
+// carry more than one card layout. Registrants counts distinct users, with
+// all anonymous scans counted as one.
+type SuspiciousCard struct {
+	Reason      string           `json:"reason"`
+	Key         string           `json:"key"`
+	Registrants int              `json:"registrants"`
+	Layouts     int              `json:"layouts"`
+	Scans       []SuspiciousScan `json:"scans"`
+}
+
+type SuspiciousCardsResponse struct {
+	Cards []SuspiciousCard `json:"cards"`
+}
+
+type SuspiciousScan struct {
+	ScanID      string    `json:"scan_id"`
+	UserID      *string   `json:"user_id,omitempty"`
+	TicketID    *string   `json:"ticket_id,omitempty"`
+	Fingerprint *string   `json:"fingerprint,omitempty"`
+	Status      string    `json:"status"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Batch and batch item states.
+const (
+	BatchPending   = "pending"
+	BatchRunning   = "running"
+	BatchDone      = "done"
+	BatchFailed    = "failed"
+	BatchCompleted = "completed"
+)
+
+// BatchItem is the outcome of one image in a batch.
+type BatchItem struct {
+	Index    int             `json:"index"`
+	Filename string          `json:"filename"`
+	Status   string          `json:"status"`
+	Error    string          `json:"error,omitempty"`
+	Result   *UploadResponse `json:"result,omitempty"`
+}
+
+type BatchSummary struct {
+	Total             int `json:"total"`
+	Pending           int `json:"pending"`
+	Running           int `json:"running"`
+	Done              int `json:"done"`
+	Failed            int `json:"failed"`
+	Cards             int `json:"cards"`
+	Confirmed         int `json:"confirmed"`
+	NeedsConfirmation int `json:"needs_confirmation"`
+	Rejected          int `json:"rejected"`
+}
+
+type BatchResponse struct {
+	BatchID     string       `json:"batch_id"`
+	UserID      *string      `json:"user_id,omitempty"`
+	Status      string       `json:"status"`
+	Summary     BatchSummary `json:"summary"`
+	Items       []BatchItem  `json:"items"`
+	CreatedAt   time.Time    `json:"created_at"`
+	CompletedAt *time.Time   `json:"completed_at,omitempty"`
 }
 
 type CheckResultResponse struct {
@@ -82,10 +375,209 @@ type MatchResult struct {
 	Region        string `json:"region,omitempty"`
 }
 
+// ErrorResponse is the body of every error response. Code is stable and
+// machine-readable; Message is localized from Accept-Language; Detail is an
+// English description of client errors for developers.
+type ErrorResponse struct {
+	Error APIError `json:"error"`
+}
+
+type APIError struct {
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+	Detail     string `json:"detail,omitempty"`
+	RequestID  string `json:"request_id"`
+	RetryAfter int    `json:"retry_after,omitempty"`
+}
+
+// ScanDetail is one scan as its owner sees it: the stored scan without its
+// cost, provider usage, API key and fingerprint, which only admins see.
+type ScanDetail struct {
+	ID               string    `json:"id"`
+	UserID           *string   `json:"user_id,omitempty"`
+	ImageURL         string    `json:"image_url"`
+	LotteryType      string    `json:"lottery_type"`
+	Blocks           []Block   `json:"blocks"`
+	ExtractedNumbers []int     `json:"extracted_numbers"`
+	Confidence       float64   `json:"confidence"`
+	Status           string    `json:"status"`
+	Notes            string    `json:"notes,omitempty"`
+	Provider         string    `json:"provider"`
+	Model            string    `json:"model"`
+	PromptVersion    string    `json:"prompt_version"`
+	Path             string    `json:"path"`
+	DurationMS       int64     `json:"duration_ms"`
+	Preprocessing    []string  `json:"preprocessing"`
+	UploadID         *string   `json:"upload_id,omitempty"`
+	CardIndex        int       `json:"card_index"`
+	TicketID         *string   `json:"ticket_id,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
 type ScanHistoryItem struct {
 	ID               string    `json:"id"`
+	LotteryType      string    `json:"lottery_type"`
+	TicketID         *string   `json:"ticket_id,omitempty"`
+	Blocks           []Block   `json:"blocks"`
 	ExtractedNumbers []int     `json:"extracted_numbers"`
 	Confidence       float64   `json:"confidence"`
 	Status           string    `json:"status"`
 	CreatedAt        time.Time `json:"created_at"`
 }
+
+// ScanHistoryQuery filters and pages the caller's scans. From and To are
+// inclusive days (YYYY-MM-DD); Cursor is the NextCursor of the previous
+// page.
+type ScanHistoryQuery struct {
+	From          string   `form:"from" binding:"omitempty,datetime=2006-01-02"`
+	To            string   `form:"to" binding:"omitempty,datetime=2006-01-02"`
+	Status        string   `form:"status" binding:"omitempty,oneof=confirmed needs_confirmation rejected"`
+	LotteryType   string   `form:"lottery_type" binding:"max=50"`
+	MinConfidence *float64 `form:"min_confidence" binding:"omitempty,min=0,max=1"`
+	Cursor        string   `form:"cursor" binding:"max=200"`
+	Limit         int      `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+// ScanHistoryResponse is one page of scans, newest first. NextCursor is
+// empty on the last page.
+type ScanHistoryResponse struct {
+	Scans      []ScanHistoryItem `json:"scans"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+}
+
+// HealthResponse is "ok", or "degraded" while the database cannot be
+// reached; scans are then queued and written once it is back.
+type HealthResponse struct {
+	Status   string          `json:"status"`
+	Database *DatabaseHealth `json:"database,omitempty"`
+}
+
+// Database connection states.
+const (
+	DatabaseUp         = "up"
+	DatabaseConnecting = "connecting"
+	DatabaseDown       = "down"
+)
+
+// DatabaseHealth is the state of the database connection since Since, and
+// the number of scans waiting in the outbox to be written to it.
+type DatabaseHealth struct {
+	Status string    `json:"status"`
+	Since  time.Time `json:"since"`
+	Queued int       `json:"queued"`
+}
+
+// User is an account. Device accounts are created anonymously for an app
+// install and can later be upgraded with an email and password.
+type User struct {
+	ID           string    `json:"id"`
+	Email        *string   `json:"email,omitempty"`
+	Anonymous    bool      `json:"anonymous"`
+	CreatedAt    time.Time `json:"created_at"`
+	PasswordHash *string   `json:"-"`
+	DeviceID     *string   `json:"-"`
+}
+
+type RegisterRequest struct {
+	Email    string `json:"email" binding:"required,email,max=254"`
+	Password string `json:"password" binding:"required,min=8,max=72"`
+}
+
+type LoginRequest struct {
+	Email    string `json:"email" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// DeviceRequest logs in an app install by a random ID it generated and
+// stored on first launch.
+type DeviceRequest struct {
+	DeviceID string `json:"device_id" binding:"required,min=16,max=200"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type AuthResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	User         *User  `json:"user"`
+}
+
+// Scopes grant access to groups of routes. Partner API keys hold a subset of
+// APIKeyScopes; user sessions hold UserScopes.
+const (
+	ScopeScanWrite   = "scan:write"
+	ScopeResultsRead = "results:read"
+	// ScopeAccount covers the caller's own account and is never given to
+	// API keys.
+	ScopeAccount = "account"
+)
+
+var (
+	APIKeyScopes = []string{ScopeScanWrite, ScopeResultsRead}
+	UserScopes   = []string{ScopeScanWrite, ScopeResultsRead, ScopeAccount}
+)
+
+// APIKey is a partner integration key. It acts as UserID, which owns the
+// scans made with it. The key itself is stored only as a hash.
+type APIKey struct {
+	ID          string     `json:"id"`
+	UserID      string     `json:"user_id"`
+	Name        string     `json:"name"`
+	Prefix      string     `json:"prefix"`
+	Scopes      []string   `json:"scopes"`
+	RotatedFrom *string    `json:"rotated_from,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+}
+
+type APIKeyList struct {
+	Keys []APIKey `json:"keys"`
+}
+
+// CreateAPIKeyRequest creates a key for UserID, or for a new account of its
+// own when UserID is empty.
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name" binding:"required,max=100"`
+	Scopes []string `json:"scopes" binding:"required,min=1"`
+	UserID string   `json:"user_id"`
+}
+
+// RotateAPIKeyRequest replaces a key; the old key keeps working for
+// GraceHours so partners can roll the new one out.
+type RotateAPIKeyRequest struct {
+	GraceHours int `json:"grace_hours" binding:"min=0,max=720"`
+}
+
+// APIKeySecret is returned when a key is created or rotated; Key is shown
+// only this once.
+type APIKeySecret struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+type APIKeyUsage struct {
+	Day      time.Time `json:"day"`
+	Requests int64     `json:"requests"`
+	Errors   int64     `json:"errors"`
+	Scans    int64     `json:"scans"`
+	CostUSD  float64   `json:"cost_usd"`
+}
+
+// APIKeyUsageResponse reports a key's usage per day and in total.
+type APIKeyUsageResponse struct {
+	Usage []APIKeyUsage    `json:"usage"`
+	Total APIKeyUsageTotal `json:"total"`
+}
+
+type APIKeyUsageTotal struct {
+	Requests int64   `json:"requests"`
+	Errors   int64   `json:"errors"`
+	Scans    int64   `json:"scans"`
+	CostUSD  float64 `json:"cost_usd"`
+}
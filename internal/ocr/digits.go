@@ -0,0 +1,395 @@
+package ocr
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"loto/internal/config"
+	"loto/internal/model"
+)
+
+// Glyphs are compared as templateWidth x templateHeight ink-coverage
+// bitmaps, stretched to fill the frame so condensed and regular fonts line
+// up; the aspect ratio is compared separately.
+const (
+	templateWidth  = 12
+	templateHeight = 20
+)
+
+//go:embed digits.json
+var defaultTemplates []byte
+
+// DigitTemplates holds the mean bitmap and aspect ratio of each digit 0-9,
+// learned from labelled scans by cmd/train-digits. Source records how and
+// from which photos.
+type DigitTemplates struct {
+	Source  string        `json:"source,omitempty"`
+	Width   int           `json:"width"`
+	Height  int           `json:"height"`
+	Digits  [10][]float64 `json:"digits"`
+	Aspect  [10]float64   `json:"aspect"`
+	Samples [10]int       `json:"samples"`
+}
+
+// LoadDigitTemplates reads templates from path, or the embedded defaults when
+// path is empty.
+func LoadDigitTemplates(path string) (*DigitTemplates, error) {
+	data := defaultTemplates
+	if path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("reading digit templates: %w", err)
+		}
+	}
+
+	var t DigitTemplates
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("parsing digit templates: %w", err)
+	}
+	if t.Width != templateWidth || t.Height != templateHeight {
+		return nil, fmt.Errorf("digit templates are %dx%d, want %dx%d", t.Width, t.Height, templateWidth, templateHeight)
+	}
+	for d, bitmap := range t.Digits {
+		if len(bitmap) != templateWidth*templateHeight || t.Aspect[d] <= 0 {
+			return nil, fmt.Errorf("digit templates: no template for %d", d)
+		}
+	}
+	return &t, nil
+}
+
+// Write stores the templates as JSON, rounded to keep the file small, with
+// one line per field and per digit bitmap.
+func (t *DigitTemplates) Write(w io.Writer) error {
+	var aspect [10]float64
+	rows := make([]any, len(t.Digits))
+	for d := range t.Digits {
+		bitmap := make([]float64, len(t.Digits[d]))
+		for i, v := range t.Digits[d] {
+			bitmap[i] = math.Round(v*1000) / 1000
+		}
+		rows[d] = bitmap
+		aspect[d] = math.Round(t.Aspect[d]*1000) / 1000
+	}
+
+	fields := []struct {
+		name  string
+		value any
+	}{
+		{"source", t.Source},
+		{"width", t.Width},
+		{"height", t.Height},
+		{"aspect", aspect},
+		{"samples", t.Samples},
+	}
+	var buf bytes.Buffer
+	buf.WriteString("{\n")
+	for _, f := range fields {
+		data, err := json.Marshal(f.value)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&buf, " %q: %s,\n", f.name, data)
+	}
+	buf.WriteString(" \"digits\": [\n")
+	for d, row := range rows {
+		data, err := json.Marshal(row)
+		if err != nil {
+			return err
+		}
+		buf.WriteString("  ")
+		buf.Write(data)
+		if d < len(rows)-1 {
+			buf.WriteByte(',')
+		}
+		buf.WriteByte('\n')
+	}
+	buf.WriteString(" ]\n}\n")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// TemplateTrainer averages labelled glyphs into DigitTemplates.
+type TemplateTrainer struct {
+	sums   [10][]float64
+	aspect [10]float64
+	n      [10]int
+}
+
+func NewTemplateTrainer() *TemplateTrainer {
+	t := &TemplateTrainer{}
+	for d := range t.sums {
+		t.sums[d] = make([]float64, templateWidth*templateHeight)
+	}
+	return t
+}
+
+func (t *TemplateTrainer) Add(digit int, g Glyph) {
+	for i, v := range normalizeGlyph(g) {
+		t.sums[digit][i] += v
+	}
+	t.aspect[digit] += aspectRatio(g)
+	t.n[digit]++
+}
+
+// Samples returns the number of glyphs added per digit.
+func (t *TemplateTrainer) Samples() [10]int {
+	return t.n
+}
+
+// Templates returns the learned templates. Digits without samples keep the
+// template from base, which may be nil only when every digit was seen.
+func (t *TemplateTrainer) Templates(base *DigitTemplates) (*DigitTemplates, error) {
+	out := &DigitTemplates{Width: templateWidth, Height: templateHeight, Samples: t.n}
+	for d := range t.sums {
+		if t.n[d] == 0 {
+			if base == nil {
+				return nil, fmt.Errorf("no samples of digit %d", d)
+			}
+			out.Digits[d] = base.Digits[d]
+			out.Aspect[d] = base.Aspect[d]
+			continue
+		}
+		out.Digits[d] = make([]float64, len(t.sums[d]))
+		for i, v := range t.sums[d] {
+			out.Digits[d][i] = v / float64(t.n[d])
+		}
+		out.Aspect[d] = t.aspect[d] / float64(t.n[d])
+	}
+	return out, nil
+}
+
+// DigitClassifier reads printed digits by normalized cross-correlation
+// against DigitTemplates.
+type DigitClassifier struct {
+	templates [10][]float64
+	aspect    [10]float64
+}
+
+func NewDigitClassifier(t *DigitTemplates) *DigitClassifier {
+	c := &DigitClassifier{aspect: t.Aspect}
+	for d, bitmap := range t.Digits {
+		c.templates[d] = standardize(bitmap)
+	}
+	return c
+}
+
+// Classify returns the best matching digit and a 0-1 confidence: the
+// correlation with its template, less a penalty for a differing aspect ratio.
+func (c *DigitClassifier) Classify(g Glyph) (int, float64) {
+	v := standardize(normalizeGlyph(g))
+	aspect := aspectRatio(g)
+
+	best, bestScore := 0, math.Inf(-1)
+	for d, tmpl := range c.templates {
+		var ncc float64
+		for i := range v {
+			ncc += v[i] * tmpl[i]
+		}
+		score := ncc - 0.5*math.Abs(math.Log(aspect/c.aspect[d]))
+		if score > bestScore {
+			best, bestScore = d, score
+		}
+	}
+	return best, max(0, min(1, bestScore))
+}
+
+// Read classifies the digits inside r, typically an OCR token's box. It
+// returns "" when r holds no digit-shaped ink.
+func (c *DigitClassifier) Read(img image.Image, r image.Rectangle) (string, float64) {
+	glyphs := CellGlyphs(img, r)
+	if len(glyphs) == 0 {
+		return "", 0
+	}
+	return c.readRun(glyphs)
+}
+
+func (c *DigitClassifier) readRun(run []Glyph) (string, float64) {
+	var sb strings.Builder
+	var total float64
+	for _, g := range run {
+		d, conf := c.Classify(g)
+		sb.WriteByte(byte('0' + d))
+		total += conf
+	}
+	return sb.String(), total / float64(len(run))
+}
+
+// Tokens finds the printed numbers in img and reads them.
+func (c *DigitClassifier) Tokens(img image.Image) []model.OCRToken {
+	var tokens []model.OCRToken
+	for _, run := range groupNumbers(findGlyphs(img)) {
+		text, conf := c.readRun(run)
+		r := runBounds(run)
+		tokens = append(tokens, model.OCRToken{
+			Text:       text,
+			Confidence: conf,
+			X:          r.Min.X,
+			Y:          r.Min.Y,
+			Width:      r.Dx(),
+			Height:     r.Dy(),
+		})
+	}
+	return tokens
+}
+
+// CellGlyphs returns the digit-shaped ink components inside r, left to
+// right. r is padded slightly, since OCR boxes are often tight; grid lines
+// running through the padded box are erased, and components much shorter
+// than the tallest one (specks, underlines) are dropped.
+func CellGlyphs(img image.Image, r image.Rectangle) []Glyph {
+	pad := max(2, r.Dy()/10)
+	r = r.Inset(-pad).Intersect(img.Bounds())
+	if r.Empty() {
+		return nil
+	}
+
+	mask, w, h := inkMask(subImage(img, r))
+	digit := r.Dy() - 2*pad
+	removeLines(mask, w, h, int(0.8*float64(digit)), int(1.1*float64(digit)))
+
+	glyphs := digitComponents(mask, w, h, h)
+	tallest := 0
+	for i := range glyphs {
+		glyphs[i].Bounds = glyphs[i].Bounds.Add(r.Min)
+		tallest = max(tallest, glyphs[i].Bounds.Dy())
+	}
+
+	var out []Glyph
+	for _, g := range glyphs {
+		if float64(g.Bounds.Dy()) >= 0.6*float64(tallest) {
+			out = append(out, g)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Bounds.Min.X < out[j].Bounds.Min.X })
+	return out
+}
+
+func subImage(img image.Image, r image.Rectangle) image.Image {
+	if s, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return s.SubImage(r)
+	}
+	dst := image.NewRGBA(r)
+	draw.Draw(dst, r, img, r.Min, draw.Src)
+	return dst
+}
+
+// normalizeGlyph stretches the glyph's mask to the template frame, each cell
+// holding the fraction of its source area covered by ink.
+func normalizeGlyph(g Glyph) []float64 {
+	w, h := g.Bounds.Dx(), g.Bounds.Dy()
+	out := make([]float64, templateWidth*templateHeight)
+	for ty := 0; ty < templateHeight; ty++ {
+		y0, y1 := float64(ty)*float64(h)/templateHeight, float64(ty+1)*float64(h)/templateHeight
+		for tx := 0; tx < templateWidth; tx++ {
+			x0, x1 := float64(tx)*float64(w)/templateWidth, float64(tx+1)*float64(w)/templateWidth
+			var ink, area float64
+			for y := int(y0); float64(y) < y1 && y < h; y++ {
+				oy := math.Min(float64(y+1), y1) - math.Max(float64(y), y0)
+				for x := int(x0); float64(x) < x1 && x < w; x++ {
+					a := oy * (math.Min(float64(x+1), x1) - math.Max(float64(x), x0))
+					if g.Mask[y*w+x] {
+						ink += a
+					}
+					area += a
+				}
+			}
+			if area > 0 {
+				out[ty*templateWidth+tx] = ink / area
+			}
+		}
+	}
+	return out
+}
+
+func aspectRatio(g Glyph) float64 {
+	return float64(g.Bounds.Dx()) / float64(g.Bounds.Dy())
+}
+
+// standardize returns v shifted to zero mean and scaled to unit length, so a
+// dot product of two standardized vectors is their correlation.
+func standardize(v []float64) []float64 {
+	var mean float64
+	for _, x := range v {
+		mean += x
+	}
+	mean /= float64(len(v))
+	out := make([]float64, len(v))
+	var norm float64
+	for i, x := range v {
+		out[i] = x - mean
+		norm += out[i] * out[i]
+	}
+	if norm = math.Sqrt(norm); norm > 0 {
+		for i := range out {
+			out[i] /= norm
+		}
+	}
+	return out
+}
+
+// DigitScanner is an OCR backend built on DigitClassifier: it finds printed
+// digits by connected components, groups them into numbers and classifies
+// each digit against learned templates. It needs no network or external
+// binary and is tuned for the black bold numerals of LOTO cards.
+type DigitScanner struct {
+	classifier *DigitClassifier
+	logger     *zap.Logger
+}
+
+func NewDigitScanner(cfg config.DigitsConfig, logger *zap.Logger) (*DigitScanner, error) {
+	t, err := LoadDigitTemplates(cfg.Templates)
+	if err != nil {
+		return nil, err
+	}
+	return &DigitScanner{classifier: NewDigitClassifier(t), logger: logger}, nil
+}
+
+func (s *DigitScanner) Close() error {
+	return nil
+}
+
+func (s *DigitScanner) Scan(ctx context.Context, imgBytes []byte, mimeType string) (*model.OCRScanResult, error) {
+	img, _, err := image.Decode(bytes.NewReader(imgBytes))
+	if err != nil {
+		return nil, fmt.Errorf("decode image: %w", err)
+	}
+
+	result := &model.OCRScanResult{
+		Provider: "digits",
+		Tokens:   s.classifier.Tokens(img),
+		Usage:    &model.Usage{Provider: "digits", Model: "digits", Units: 1},
+	}
+	var texts []string
+	for _, t := range result.Tokens {
+		result.Numbers = append(result.Numbers, SplitLOTONumbers(t.Text)...)
+		texts = append(texts, t.Text)
+		result.Confidence += t.Confidence
+	}
+	if len(result.Tokens) > 0 {
+		result.Confidence /= float64(len(result.Tokens))
+	}
+	result.FullText = strings.Join(texts, " ")
+	sort.Ints(result.Numbers)
+
+	s.logger.Debug("digit scan",
+		zap.Int("tokens", len(result.Tokens)),
+		zap.Float64("confidence", result.Confidence),
+	)
+	return result, nil
+}
@@ -63,6 +63,7 @@ func (s *GoogleVisionScanner) Scan(ctx context.Context, imgBytes []byte, mimeTyp
 
 	result := &model.OCRScanResult{
 		Provider: "google_vision",
+		Usage:    &model.Usage{Provider: "google_vision", Model: "DOCUMENT_TEXT_DETECTION", Units: 1},
 	}
 
 	if len(resp.Responses) == 0 {
@@ -111,7 +112,7 @@ func (s *GoogleVisionScanner) Scan(ctx context.Context, imgBytes []byte, mimeTyp
 					totalConfidence += float64(word.Confidence)
 					wordCount++
 
-					result.Numbers = append(result.Numbers, splitLOTONumbers(wordText)...)
+					result.Numbers = append(result.Numbers, SplitLOTONumbers(wordText)...)
 				}
 			}
 		}
@@ -126,7 +127,9 @@ func (s *GoogleVisionScanner) Scan(ctx context.Context, imgBytes []byte, mimeTyp
 	return result, nil
 }
 
-func splitLOTONumbers(s string) []int {
+// SplitLOTONumbers parses an OCR word into LOTO numbers, splitting words where
+// OCR merged two adjacent cells (e.g. "324" -> 3, 24).
+func SplitLOTONumbers(s string) []int {
 	n, err := strconv.Atoi(s)
 	if err != nil {
 		return nil
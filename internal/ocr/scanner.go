@@ -2,10 +2,41 @@ package ocr
 
 import (
 	"context"
+	"fmt"
 
+	"go.uber.org/zap"
+
+	"loto/internal/config"
 	"loto/internal/model"
 )
 
 type Scanner interface {
 	Scan(ctx context.Context, imgBytes []byte, mimeType string) (*model.OCRScanResult, error)
 }
+
+// Backend is a Scanner holding resources that are released by Close.
+type Backend interface {
+	Scanner
+	Close() error
+}
+
+// Provider names accepted in OCR_PROVIDER.
+const (
+	ProviderGoogleVision = "google_vision"
+	ProviderTesseract    = "tesseract"
+	ProviderDigits       = "digits"
+)
+
+// New creates the OCR backend selected by cfg.Provider.
+func New(cfg config.VisionConfig, logger *zap.Logger) (Backend, error) {
+	switch cfg.Provider {
+	case ProviderGoogleVision, "google", "":
+		return NewGoogleVisionScanner(cfg.CredentialsFile, logger)
+	case ProviderTesseract:
+		return NewTesseractScanner(cfg.Tesseract, logger)
+	case ProviderDigits:
+		return NewDigitScanner(cfg.Digits, logger)
+	default:
+		return nil, fmt.Errorf("unknown OCR provider %q", cfg.Provider)
+	}
+}
@@ -0,0 +1,358 @@
+package ocr
+
+import (
+	"image"
+	"sort"
+)
+
+// Ink is printed black: dark and nearly grey. The chroma limit keeps the
+// coloured cell fills, decorations and skin of LOTO card photos out of the
+// mask even where they are as dark as the digits.
+const inkMaxChroma = 60
+
+// Glyph is one connected ink component that may be a digit. Mask holds the
+// component's own pixels within Bounds, row by row, so a neighbouring digit
+// or grid line inside the same rectangle does not leak into it.
+type Glyph struct {
+	Bounds image.Rectangle
+	Mask   []bool
+}
+
+// inkMask marks the ink pixels of img. The dark/light split is the Otsu
+// threshold of the luminance of the grey pixels.
+func inkMask(img image.Image) ([]bool, int, int) {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	lum := make([]uint8, w*h)
+	grey := make([]bool, w*h)
+	var hist [256]int
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			r, g, bl, _ := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
+			r8, g8, b8 := int(r>>8), int(g>>8), int(bl>>8)
+			i := y*w + x
+			lum[i] = uint8((299*r8 + 587*g8 + 114*b8) / 1000)
+			if max(r8, g8, b8)-min(r8, g8, b8) < inkMaxChroma {
+				grey[i] = true
+				hist[lum[i]]++
+			}
+		}
+	}
+
+	t := otsu(hist)
+	mask := make([]bool, w*h)
+	for i := range mask {
+		mask[i] = grey[i] && int(lum[i]) <= t
+	}
+	return mask, w, h
+}
+
+// otsu returns the threshold maximising the between-class variance.
+func otsu(hist [256]int) int {
+	var total, sum float64
+	for i, n := range hist {
+		total += float64(n)
+		sum += float64(i * n)
+	}
+	var sumB, wB, best float64
+	threshold := 127
+	for i, n := range hist {
+		wB += float64(n)
+		if wB == 0 {
+			continue
+		}
+		wF := total - wB
+		if wF == 0 {
+			break
+		}
+		sumB += float64(i * n)
+		mB := sumB / wB
+		mF := (sum - sumB) / wF
+		if v := wB * wF * (mB - mF) * (mB - mF); v > best {
+			best, threshold = v, i
+		}
+	}
+	return threshold
+}
+
+// components labels the 8-connected ink regions of mask.
+func components(mask []bool, w, h int) []Glyph {
+	label := make([]int32, len(mask))
+	var glyphs []Glyph
+	var stack, pixels []int
+	for start, ink := range mask {
+		if !ink || label[start] != 0 {
+			continue
+		}
+		id := int32(len(glyphs) + 1)
+		label[start] = id
+		stack = append(stack[:0], start)
+		pixels = pixels[:0]
+		r := image.Rect(start%w, start/w, start%w+1, start/w+1)
+		for len(stack) > 0 {
+			p := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			pixels = append(pixels, p)
+			x, y := p%w, p/w
+			r = r.Union(image.Rect(x, y, x+1, y+1))
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					nx, ny := x+dx, y+dy
+					if nx < 0 || ny < 0 || nx >= w || ny >= h {
+						continue
+					}
+					if q := ny*w + nx; mask[q] && label[q] == 0 {
+						label[q] = id
+						stack = append(stack, q)
+					}
+				}
+			}
+		}
+
+		g := Glyph{Bounds: r, Mask: make([]bool, r.Dx()*r.Dy())}
+		for _, p := range pixels {
+			g.Mask[(p/w-r.Min.Y)*r.Dx()+p%w-r.Min.X] = true
+		}
+		glyphs = append(glyphs, g)
+	}
+	return glyphs
+}
+
+// digitShaped reports whether a component could be a printed digit: taller
+// than wide but not a sliver of grid line, neither a speck nor a solid
+// block, and smaller than maxHeight.
+func digitShaped(g Glyph, maxHeight int) bool {
+	w, h := g.Bounds.Dx(), g.Bounds.Dy()
+	if h < 8 || h > maxHeight || w > h || 8*w < h {
+		return false
+	}
+	fill := float64(inkCount(g)) / float64(w*h)
+	return fill >= 0.15 && fill <= 0.95
+}
+
+// splitTouching cuts a component that is too wide for one digit, usually
+// two digits printed close enough to touch, at its thinnest column near the
+// middle. The parts are split again while still too wide.
+func splitTouching(g Glyph) []Glyph {
+	w, h := g.Bounds.Dx(), g.Bounds.Dy()
+	if h < 8 || w <= h*4/5 || w > 3*h {
+		return []Glyph{g}
+	}
+
+	cut, least := 0, h+1
+	for x := w * 3 / 10; x <= w*7/10; x++ {
+		n := 0
+		for y := 0; y < h; y++ {
+			if g.Mask[y*w+x] {
+				n++
+			}
+		}
+		if n < least {
+			cut, least = x, n
+		}
+	}
+
+	var parts []Glyph
+	for _, span := range [][2]int{{0, cut}, {cut, w}} {
+		part, ok := subGlyph(g, span[0], span[1])
+		if ok {
+			parts = append(parts, splitTouching(part)...)
+		}
+	}
+	return parts
+}
+
+// subGlyph returns the ink of g between columns x0 and x1, trimmed to its
+// bounds.
+func subGlyph(g Glyph, x0, x1 int) (Glyph, bool) {
+	w := g.Bounds.Dx()
+	r := image.Rectangle{}
+	for y := 0; y < g.Bounds.Dy(); y++ {
+		for x := x0; x < x1; x++ {
+			if g.Mask[y*w+x] {
+				r = r.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	if r.Empty() {
+		return Glyph{}, false
+	}
+	part := Glyph{Bounds: r.Add(g.Bounds.Min), Mask: make([]bool, r.Dx()*r.Dy())}
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			part.Mask[(y-r.Min.Y)*r.Dx()+x-r.Min.X] = g.Mask[y*w+x]
+		}
+	}
+	return part, true
+}
+
+func inkCount(g Glyph) int {
+	n := 0
+	for _, ink := range g.Mask {
+		if ink {
+			n++
+		}
+	}
+	return n
+}
+
+// findGlyphs returns the digit-shaped components of img whose height is
+// close to the median, which drops decorations and text of another size.
+// Digits touching the card's grid lines would merge with them, so once the
+// digit height is known the lines are erased and the components found again.
+func findGlyphs(img image.Image) []Glyph {
+	mask, w, h := inkMask(img)
+	med := medianHeight(digitComponents(mask, w, h, h/4))
+	if med == 0 {
+		return nil
+	}
+	removeLines(mask, w, h, int(1.2*med), int(1.3*med))
+
+	var glyphs []Glyph
+	for _, g := range digitComponents(mask, w, h, h/4) {
+		if h := float64(g.Bounds.Dy()); h >= 0.7*med && h <= 1.4*med {
+			g.Bounds = g.Bounds.Add(img.Bounds().Min)
+			glyphs = append(glyphs, g)
+		}
+	}
+	return glyphs
+}
+
+func digitComponents(mask []bool, w, h, maxHeight int) []Glyph {
+	var out []Glyph
+	for _, c := range components(mask, w, h) {
+		for _, g := range splitTouching(c) {
+			if digitShaped(g, maxHeight) {
+				out = append(out, g)
+			}
+		}
+	}
+	return out
+}
+
+// medianHeight is the ink-weighted median height of glyphs, so the many
+// specks of a decorated border do not outvote the digits.
+func medianHeight(glyphs []Glyph) float64 {
+	if len(glyphs) == 0 {
+		return 0
+	}
+	type weighted struct{ h, ink int }
+	ws := make([]weighted, len(glyphs))
+	total := 0
+	for i, g := range glyphs {
+		ws[i] = weighted{g.Bounds.Dy(), inkCount(g)}
+		total += ws[i].ink
+	}
+	sort.Slice(ws, func(i, j int) bool { return ws[i].h < ws[j].h })
+	acc := 0
+	for _, w := range ws {
+		if acc += w.ink; 2*acc >= total {
+			return float64(w.h)
+		}
+	}
+	return float64(ws[len(ws)-1].h)
+}
+
+// removeLines erases horizontal ink runs longer than maxH and vertical runs
+// longer than maxV. Runs are measured on the original mask, so crossing
+// lines are both removed.
+func removeLines(mask []bool, w, h, maxH, maxV int) {
+	erase := make([]bool, len(mask))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; {
+			end := x
+			for end < w && mask[y*w+end] {
+				end++
+			}
+			if end-x > maxH {
+				for i := x; i < end; i++ {
+					erase[y*w+i] = true
+				}
+			}
+			x = end + 1
+		}
+	}
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; {
+			end := y
+			for end < h && mask[end*w+x] {
+				end++
+			}
+			if end-y > maxV {
+				for i := y; i < end; i++ {
+					erase[i*w+x] = true
+				}
+			}
+			y = end + 1
+		}
+	}
+	for i, e := range erase {
+		if e {
+			mask[i] = false
+		}
+	}
+}
+
+// groupNumbers joins glyphs standing side by side on one line into numbers.
+// A run of more than two digits (neighbouring cells printed close together)
+// is split into pairs, led by a single digit when its length is odd: LOTO
+// numbers have at most two digits and only the first column holds one-digit
+// numbers. Gaps are no guide here, since a narrow 1 leaves a wider gap to its
+// neighbour inside a number than between cells.
+func groupNumbers(glyphs []Glyph) [][]Glyph {
+	sorted := append([]Glyph(nil), glyphs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Bounds.Min.X < sorted[j].Bounds.Min.X })
+
+	var runs [][]Glyph
+	used := make([]bool, len(sorted))
+	for i := range sorted {
+		if used[i] {
+			continue
+		}
+		used[i] = true
+		run := []Glyph{sorted[i]}
+		for j := i + 1; j < len(sorted); j++ {
+			last := run[len(run)-1].Bounds
+			next := sorted[j].Bounds
+			if next.Min.X-last.Max.X > last.Dy()/2 {
+				break
+			}
+			if used[j] || !sameLine(last, next) {
+				continue
+			}
+			used[j] = true
+			run = append(run, sorted[j])
+		}
+		runs = append(runs, splitRun(run)...)
+	}
+	return runs
+}
+
+// sameLine reports whether a and b overlap vertically by most of the shorter
+// height and have similar heights.
+func sameLine(a, b image.Rectangle) bool {
+	overlap := min(a.Max.Y, b.Max.Y) - max(a.Min.Y, b.Min.Y)
+	shorter, taller := min(a.Dy(), b.Dy()), max(a.Dy(), b.Dy())
+	return float64(overlap) >= 0.6*float64(shorter) && float64(taller) <= 1.35*float64(shorter)
+}
+
+func splitRun(run []Glyph) [][]Glyph {
+	var parts [][]Glyph
+	if len(run) > 2 && len(run)%2 == 1 {
+		parts = append(parts, run[:1])
+		run = run[1:]
+	}
+	for len(run) > 2 {
+		parts = append(parts, run[:2])
+		run = run[2:]
+	}
+	return append(parts, run)
+}
+
+func runBounds(run []Glyph) image.Rectangle {
+	r := run[0].Bounds
+	for _, g := range run[1:] {
+		r = r.Union(g.Bounds)
+	}
+	return r
+}
@@ -0,0 +1,134 @@
+package ocr
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"loto/internal/config"
+	"loto/internal/model"
+)
+
+// TesseractScanner runs the tesseract CLI locally, so hybrid mode works
+// on-prem and offline. Recognition is restricted to digits and uses sparse
+// text segmentation, which suits the isolated numbers of a LOTO grid better
+// than the default page layout analysis.
+type TesseractScanner struct {
+	path   string
+	cfg    config.TesseractConfig
+	logger *zap.Logger
+}
+
+func NewTesseractScanner(cfg config.TesseractConfig, logger *zap.Logger) (*TesseractScanner, error) {
+	path, err := exec.LookPath(cfg.Path)
+	if err != nil {
+		return nil, fmt.Errorf("tesseract not found: %w", err)
+	}
+	return &TesseractScanner{path: path, cfg: cfg, logger: logger}, nil
+}
+
+func (s *TesseractScanner) Close() error {
+	return nil
+}
+
+func (s *TesseractScanner) Scan(ctx context.Context, imgBytes []byte, mimeType string) (*model.OCRScanResult, error) {
+	if s.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.cfg.Timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, s.path, "stdin", "stdout",
+		"-l", s.cfg.Languages,
+		"--psm", strconv.Itoa(s.cfg.PSM),
+		"-c", "tessedit_char_whitelist=0123456789",
+		"tsv",
+	)
+	cmd.Stdin = bytes.NewReader(imgBytes)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s: %w: %s", filepath.Base(s.path), err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	result, err := parseTesseractTSV(stdout.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Debug("tesseract scan",
+		zap.Int("tokens", len(result.Tokens)),
+		zap.Float64("confidence", result.Confidence),
+	)
+	return result, nil
+}
+
+// tsvWordLevel is the level column of word rows in tesseract's TSV output;
+// lower levels are pages, blocks, paragraphs and lines.
+const tsvWordLevel = 5
+
+// parseTesseractTSV turns tesseract TSV output (level, page_num, block_num,
+// par_num, line_num, word_num, left, top, width, height, conf, text) into an
+// OCR result. Confidence is reported 0-100 and scaled to 0-1 as for Vision.
+func parseTesseractTSV(data []byte) (*model.OCRScanResult, error) {
+	result := &model.OCRScanResult{
+		Provider: "tesseract",
+		Usage:    &model.Usage{Provider: "tesseract", Model: "tesseract", Units: 1},
+	}
+
+	var texts []string
+	var totalConfidence float64
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for line := 0; sc.Scan(); line++ {
+		if line == 0 {
+			continue
+		}
+		fields := strings.Split(sc.Text(), "\t")
+		if len(fields) < 12 {
+			continue
+		}
+		level, _ := strconv.Atoi(fields[0])
+		text := strings.TrimSpace(fields[11])
+		conf, err := strconv.ParseFloat(fields[10], 64)
+		if level != tsvWordLevel || text == "" || err != nil || conf < 0 {
+			continue
+		}
+
+		var box [4]int
+		for i := range box {
+			if box[i], err = strconv.Atoi(fields[6+i]); err != nil {
+				return nil, fmt.Errorf("tesseract tsv line %d: %w", line+1, err)
+			}
+		}
+
+		result.Tokens = append(result.Tokens, model.OCRToken{
+			Text:       text,
+			Confidence: conf / 100,
+			X:          box[0],
+			Y:          box[1],
+			Width:      box[2],
+			Height:     box[3],
+		})
+		result.Numbers = append(result.Numbers, SplitLOTONumbers(text)...)
+		texts = append(texts, text)
+		totalConfidence += conf / 100
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("reading tesseract output: %w", err)
+	}
+
+	if len(result.Tokens) > 0 {
+		result.Confidence = totalConfidence / float64(len(result.Tokens))
+	}
+	result.FullText = strings.Join(texts, " ")
+	sort.Ints(result.Numbers)
+	return result, nil
+}
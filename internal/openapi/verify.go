@@ -0,0 +1,280 @@
+package openapi
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"loto/internal/model"
+)
+
+// models are the types the handlers read and write as JSON, one per
+// component schema of the same name.
+var models = []any{
+	model.APIError{},
+	model.APIKey{},
+	model.APIKeyList{},
+	model.APIKeySecret{},
+	model.APIKeyUsage{},
+	model.APIKeyUsageResponse{},
+	model.APIKeyUsageTotal{},
+	model.AuthResponse{},
+	model.BatchItem{},
+	model.BatchResponse{},
+	model.BatchSummary{},
+	model.Block{},
+	model.CellDetail{},
+	model.CellViolation{},
+	model.CheckResultResponse{},
+	model.Correction{},
+	model.CreateAPIKeyRequest{},
+	model.DatabaseHealth{},
+	model.DeviceRequest{},
+	model.ErrorResponse{},
+	model.HealthResponse{},
+	model.LoginRequest{},
+	model.MatchResult{},
+	model.PromptStats{},
+	model.PromptStatsResponse{},
+	model.ReconcileDecision{},
+	model.RefreshRequest{},
+	model.Region{},
+	model.RegisterRequest{},
+	model.RotateAPIKeyRequest{},
+	model.Scan{},
+	model.ScanDetail{},
+	model.ScanHistoryItem{},
+	model.ScanHistoryResponse{},
+	model.ScanResponse{},
+	model.SuspiciousCard{},
+	model.SuspiciousCardsResponse{},
+	model.SuspiciousScan{},
+	model.UploadResponse{},
+	model.Usage{},
+	model.UsageAggregate{},
+	model.UsageResponse{},
+	model.User{},
+}
+
+// Verify reports every difference between the document and the routes
+// registered on the router or the model structs.
+func Verify(routes gin.RoutesInfo) error {
+	doc, err := Load()
+	if err != nil {
+		return fmt.Errorf("parse openapi.json: %w", err)
+	}
+	return errors.Join(append(VerifyRoutes(doc, routes), VerifyModels(doc)...)...)
+}
+
+// VerifyRoutes checks that every route is documented and every documented
+// operation is routed. Gin's :param segments match OpenAPI's {param}.
+func VerifyRoutes(doc *Document, routes gin.RoutesInfo) []error {
+	routed := make(map[string]bool)
+	for _, r := range routes {
+		routed[r.Method+" "+openAPIPath(r.Path)] = true
+	}
+	documented := make(map[string]bool)
+	for path, item := range doc.Paths {
+		for method := range item {
+			documented[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+
+	var errs []error
+	for _, key := range sortedKeys(routed) {
+		if !documented[key] {
+			errs = append(errs, fmt.Errorf("route %s is not documented", key))
+		}
+	}
+	for _, key := range sortedKeys(documented) {
+		if !routed[key] {
+			errs = append(errs, fmt.Errorf("operation %s has no route", key))
+		}
+	}
+	return errs
+}
+
+func openAPIPath(path string) string {
+	parts := strings.Split(path, "/")
+	for i, p := range parts {
+		if name, ok := strings.CutPrefix(p, ":"); ok {
+			parts[i] = "{" + name + "}"
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// VerifyModels checks that each component schema has a model of the same
+// name with the same JSON properties, types and required fields, and that
+// every $ref resolves. Fields of request structs, which have binding tags,
+// are required when bound as required; fields of responses are required
+// unless omitempty.
+func VerifyModels(doc *Document) []error {
+	types := make(map[string]reflect.Type)
+	for _, m := range models {
+		t := reflect.TypeOf(m)
+		types[t.Name()] = t
+	}
+
+	var errs []error
+	for _, name := range sortedKeys(doc.Components.Schemas) {
+		t, ok := types[name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("schema %s has no model", name))
+			continue
+		}
+		errs = append(errs, compareStruct(name, doc.Components.Schemas[name], t)...)
+	}
+	for _, name := range sortedKeys(types) {
+		if _, ok := doc.Components.Schemas[name]; !ok {
+			errs = append(errs, fmt.Errorf("model %s has no schema", name))
+		}
+	}
+
+	for path, item := range doc.Paths {
+		for method, op := range item {
+			where := strings.ToUpper(method) + " " + path
+			var schemas []*Schema
+			if op.RequestBody != nil {
+				for _, mt := range op.RequestBody.Content {
+					schemas = append(schemas, mt.Schema)
+				}
+			}
+			for _, resp := range op.Responses {
+				for _, mt := range resp.Content {
+					schemas = append(schemas, mt.Schema)
+				}
+			}
+			for _, s := range schemas {
+				if name := s.RefName(); name != "" && doc.Components.Schemas[name] == nil {
+					errs = append(errs, fmt.Errorf("%s refers to missing schema %s", where, name))
+				}
+			}
+		}
+	}
+	return errs
+}
+
+type jsonField struct {
+	typ      reflect.Type
+	required bool
+}
+
+// jsonFields lists the fields encoding/json writes for t, including those of
+// embedded structs.
+func jsonFields(t reflect.Type) map[string]jsonField {
+	request := false
+	for i := range t.NumField() {
+		if _, ok := t.Field(i).Tag.Lookup("binding"); ok {
+			request = true
+		}
+	}
+
+	fields := make(map[string]jsonField)
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			for k, v := range jsonFields(f.Type) {
+				fields[k] = v
+			}
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		required := !slices.Contains(strings.Split(opts, ","), "omitempty")
+		if request {
+			required = slices.Contains(strings.Split(f.Tag.Get("binding"), ","), "required")
+		}
+		fields[name] = jsonField{typ: f.Type, required: required}
+	}
+	return fields
+}
+
+func compareStruct(name string, s *Schema, t reflect.Type) []error {
+	var errs []error
+	fields := jsonFields(t)
+	for _, prop := range sortedKeys(fields) {
+		f := fields[prop]
+		ps, ok := s.Properties[prop]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s.%s is missing from the schema", name, prop))
+			continue
+		}
+		if err := compareType(ps, f.typ); err != nil {
+			errs = append(errs, fmt.Errorf("%s.%s: %w", name, prop, err))
+		}
+		if required := slices.Contains(s.Required, prop); required != f.required {
+			errs = append(errs, fmt.Errorf("%s.%s: schema required is %t, model %t", name, prop, required, f.required))
+		}
+	}
+	for _, prop := range sortedKeys(s.Properties) {
+		if _, ok := fields[prop]; !ok {
+			errs = append(errs, fmt.Errorf("%s.%s is not in the model", name, prop))
+		}
+	}
+	return errs
+}
+
+var timeType = reflect.TypeFor[time.Time]()
+
+func compareType(s *Schema, t reflect.Type) error {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	want := ""
+	switch {
+	case t == timeType:
+		if s.Type != "string" || s.Format != "date-time" {
+			return fmt.Errorf("want string date-time for %s", t)
+		}
+		return nil
+	case t.Kind() == reflect.Struct:
+		if s.RefName() != t.Name() {
+			return fmt.Errorf("want $ref to %s, got %q", t.Name(), s.Ref)
+		}
+		return nil
+	case t.Kind() == reflect.Slice:
+		if s.Type != "array" || s.Items == nil {
+			return fmt.Errorf("want array for %s", t)
+		}
+		if err := compareType(s.Items, t.Elem()); err != nil {
+			return fmt.Errorf("items: %w", err)
+		}
+		return nil
+	case t.Kind() == reflect.String:
+		want = "string"
+	case t.Kind() == reflect.Bool:
+		want = "boolean"
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		want = "integer"
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		want = "number"
+	default:
+		return fmt.Errorf("unsupported model type %s", t)
+	}
+	if s.Type != want {
+		return fmt.Errorf("want %s for %s, got %q", want, t, s.Type)
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,331 @@
+package preprocess
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+const (
+	detectDimension = 1000
+	edgeThreshold   = 100
+	maxTiltDegrees  = 15.0
+	minTiltDegrees  = 0.3
+	// A grid line must cover this share of the card to count as its border.
+	minLineCoverage = 0.25
+	// Lines at least this share of the strongest line count as grid lines
+	// when looking for the outermost one.
+	outerLineRatio = 0.35
+	cropMargin     = 0.03
+	// Borders closer than this share of the card to the image edge are not
+	// trusted as the card's outer edge when cropping.
+	edgeGap = 0.15
+)
+
+type edgePoint struct{ x, y float64 }
+
+// line is y = offset + (x-cx)·slope for horizontal lines and
+// x = offset + (y-cy)·slope for vertical ones.
+type line struct{ slope, offset float64 }
+
+// card is the grid found in an image: its tilt in degrees and, when all four
+// outer grid lines were found, their corners (top-left, top-right,
+// bottom-right, bottom-left).
+type card struct {
+	angle    float64
+	keystone float64
+	found    bool
+	corners  [4][2]float64
+}
+
+func (c card) rotated() bool {
+	return math.Abs(c.angle) >= minTiltDegrees || (c.found && c.keystone >= minTiltDegrees)
+}
+
+// findCard locates the printed grid from its edges: the dominant direction of
+// horizontal edges gives the tilt, and the outermost horizontal and vertical
+// grid lines, each fitted with its own slope, give the corners.
+func findCard(img *image.RGBA) card {
+	b := img.Bounds()
+	det, k := img, 1.0
+	if longest := max(b.Dx(), b.Dy()); longest > detectDimension {
+		k = float64(longest) / detectDimension
+		det = resize(img, int(float64(b.Dx())/k), int(float64(b.Dy())/k))
+	}
+	w, h := det.Bounds().Dx(), det.Bounds().Dy()
+	horiz, vert := edges(det)
+	if len(horiz) < w || len(vert) < h {
+		return card{}
+	}
+
+	cx, cy := float64(w)/2, float64(h)/2
+	angle := dominantAngle(horiz, cx, h, false)
+	c := card{angle: angle}
+
+	top, okT := outerLine(horiz, cx, h, false, angle, false, float64(w)*minLineCoverage)
+	bottom, okB := outerLine(horiz, cx, h, false, angle, true, float64(w)*minLineCoverage)
+	left, okL := outerLine(vert, cy, w, true, -angle, false, float64(h)*minLineCoverage)
+	right, okR := outerLine(vert, cy, w, true, -angle, true, float64(h)*minLineCoverage)
+	if !okT || !okB || !okL || !okR {
+		return c
+	}
+	if bottom.offset-top.offset < 0.3*float64(h) || right.offset-left.offset < 0.3*float64(w) {
+		return c
+	}
+
+	c.keystone = max(
+		math.Abs(degrees(top.slope)-degrees(bottom.slope)),
+		math.Abs(degrees(left.slope)-degrees(right.slope)),
+	)
+	c.corners = [4][2]float64{
+		intersect(top, left, cx, cy),
+		intersect(top, right, cx, cy),
+		intersect(bottom, right, cx, cy),
+		intersect(bottom, left, cx, cy),
+	}
+	for i := range c.corners {
+		c.corners[i][0] *= k
+		c.corners[i][1] *= k
+	}
+	if quadArea(c.corners) < 0.25*float64(b.Dx()*b.Dy()) {
+		return card{angle: angle}
+	}
+	c.found = true
+	return c
+}
+
+// edges returns Sobel edge points split by orientation: points on horizontal
+// edges (strong vertical gradient) and points on vertical edges.
+func edges(img *image.RGBA) (horiz, vert []edgePoint) {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	lum := make([]int, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			lum[y*w+x] = luminance(img.Pix, img.PixOffset(x, y))
+		}
+	}
+	at := func(x, y int) int { return lum[y*w+x] }
+
+	for y := 1; y < h-1; y++ {
+		for x := 1; x < w-1; x++ {
+			gx := at(x+1, y-1) + 2*at(x+1, y) + at(x+1, y+1) - at(x-1, y-1) - 2*at(x-1, y) - at(x-1, y+1)
+			gy := at(x-1, y+1) + 2*at(x, y+1) + at(x+1, y+1) - at(x-1, y-1) - 2*at(x, y-1) - at(x+1, y-1)
+			ax, ay := abs(gx), abs(gy)
+			switch {
+			case ay > edgeThreshold && ay > 2*ax:
+				horiz = append(horiz, edgePoint{float64(x), float64(y)})
+			case ax > edgeThreshold && ax > 2*ay:
+				vert = append(vert, edgePoint{float64(x), float64(y)})
+			}
+		}
+	}
+	return horiz, vert
+}
+
+// profile counts edge points by their offset along lines with the given
+// slope. Index i holds offset i-n/2, so lines leaving the image still land in
+// range.
+func profile(pts []edgePoint, slope, center float64, n int, vertical bool) []int {
+	hist := make([]int, 2*n)
+	pad := n / 2
+	for _, p := range pts {
+		var r float64
+		if vertical {
+			r = p.x - (p.y-center)*slope
+		} else {
+			r = p.y - (p.x-center)*slope
+		}
+		if i := int(math.Round(r)) + pad; i >= 0 && i < len(hist) {
+			hist[i]++
+		}
+	}
+	// Edges of printed lines are a few pixels thick.
+	smooth := make([]int, len(hist))
+	for i := range hist {
+		for j := max(0, i-1); j <= min(len(hist)-1, i+1); j++ {
+			smooth[i] += hist[j]
+		}
+	}
+	return smooth
+}
+
+// dominantAngle is the tilt in degrees at which the edge profile is most
+// peaked, i.e. the most edge points fall on common lines.
+func dominantAngle(pts []edgePoint, center float64, n int, vertical bool) float64 {
+	score := func(deg float64) float64 {
+		var s float64
+		for _, v := range profile(pts, math.Tan(deg*math.Pi/180), center, n, vertical) {
+			s += float64(v) * float64(v)
+		}
+		return s
+	}
+
+	best, bestScore := 0.0, score(0)
+	for d := -maxTiltDegrees; d <= maxTiltDegrees; d += 0.5 {
+		if s := score(d); s > bestScore {
+			best, bestScore = d, s
+		}
+	}
+	coarse := best
+	for d := coarse - 0.5; d <= coarse+0.5; d += 0.1 {
+		if s := score(d); s > bestScore {
+			best, bestScore = d, s
+		}
+	}
+	return best
+}
+
+// outerLine finds the first (or, with last, the final) grid line across the
+// image, trying slopes within 3° of around so that each border gets its own
+// angle under perspective. The line must collect at least minPeak points.
+func outerLine(pts []edgePoint, center float64, n int, vertical bool, around float64, last bool, minPeak float64) (line, bool) {
+	var best line
+	bestPeak := 0
+	for d := around - 3; d <= around+3; d += 0.25 {
+		slope := math.Tan(d * math.Pi / 180)
+		hist := profile(pts, slope, center, n, vertical)
+
+		top := 0
+		for _, v := range hist {
+			top = max(top, v)
+		}
+		threshold := int(float64(top) * outerLineRatio)
+
+		idx := -1
+		if last {
+			for i := len(hist) - 1; i >= 0; i-- {
+				if hist[i] >= threshold {
+					idx = i
+					break
+				}
+			}
+		} else {
+			for i := range hist {
+				if hist[i] >= threshold {
+					idx = i
+					break
+				}
+			}
+		}
+		if idx < 0 {
+			continue
+		}
+
+		// Climb to the peak of this line.
+		step := 1
+		if last {
+			step = -1
+		}
+		for j := 0; j < 4; j++ {
+			next := idx + step
+			if next < 0 || next >= len(hist) || hist[next] < hist[idx] {
+				break
+			}
+			idx = next
+		}
+
+		if hist[idx] > bestPeak {
+			bestPeak = hist[idx]
+			best = line{slope: slope, offset: float64(idx - n/2)}
+		}
+	}
+	return best, float64(bestPeak) >= minPeak
+}
+
+func intersect(h, v line, cx, cy float64) [2]float64 {
+	x := (v.offset + (h.offset-cx*h.slope-cy)*v.slope) / (1 - h.slope*v.slope)
+	y := h.offset + (x-cx)*h.slope
+	return [2]float64{x, y}
+}
+
+// rectify removes tilt and perspective. With corners it maps the card
+// quadrilateral onto an upright rectangle at the card's position; otherwise
+// it rotates the whole image about its centre. The returned card is in the
+// new image's coordinates.
+func rectify(img *image.RGBA, c card) (*image.RGBA, card, string) {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+
+	if c.found {
+		q := c.corners
+		cw := max(dist(q[0], q[1]), dist(q[3], q[2]))
+		ch := max(dist(q[0], q[3]), dist(q[1], q[2]))
+		x0 := max(0, min(q[0][0], q[3][0]))
+		y0 := max(0, min(q[0][1], q[1][1]))
+		rect := [4][2]float64{{x0, y0}, {x0 + cw, y0}, {x0 + cw, y0 + ch}, {x0, y0 + ch}}
+		if m, ok := homography(rect, q); ok {
+			out := warp(img, max(w, int(math.Ceil(x0+cw))), max(h, int(math.Ceil(y0+ch))), m)
+			detail := fmt.Sprintf("%.1fdeg,keystone=%.1fdeg", c.angle, c.keystone)
+			return out, card{found: true, corners: rect}, detail
+		}
+	}
+
+	rad := c.angle * math.Pi / 180
+	sin, cos := math.Sin(rad), math.Cos(rad)
+	cx, cy := float64(w)/2, float64(h)/2
+	out := warp(img, w, h, func(u, v float64) (float64, float64) {
+		du, dv := u-cx, v-cy
+		return cx + du*cos - dv*sin, cy + du*sin + dv*cos
+	})
+	return out, card{}, fmt.Sprintf("%.1fdeg", c.angle)
+}
+
+// cropToCard crops to the card's bounding box plus a small margin. A border
+// line close to the image edge is usually an inner line of a card that runs
+// off the photo, so that side is kept to the edge rather than cutting a row.
+// It reports false when the card already fills the image.
+func cropToCard(img *image.RGBA, c card) (*image.RGBA, bool) {
+	b := img.Bounds()
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, p := range c.corners {
+		minX, maxX = min(minX, p[0]), max(maxX, p[0])
+		minY, maxY = min(minY, p[1]), max(maxY, p[1])
+	}
+	margin := cropMargin * max(maxX-minX, maxY-minY)
+	keepX := edgeGap * (maxX - minX)
+	keepY := edgeGap * (maxY - minY)
+	if minX < keepX {
+		minX = 0
+	}
+	if minY < keepY {
+		minY = 0
+	}
+	if float64(b.Dx())-maxX < keepX {
+		maxX = float64(b.Dx())
+	}
+	if float64(b.Dy())-maxY < keepY {
+		maxY = float64(b.Dy())
+	}
+	r := image.Rect(
+		max(0, int(minX-margin)), max(0, int(minY-margin)),
+		min(b.Dx(), int(math.Ceil(maxX+margin))), min(b.Dy(), int(math.Ceil(maxY+margin))),
+	)
+	if r.Empty() || r.Dx()*r.Dy() >= b.Dx()*b.Dy()*9/10 {
+		return nil, false
+	}
+	return toRGBA(img.SubImage(r)), true
+}
+
+func quadArea(q [4][2]float64) float64 {
+	var s float64
+	for i := range q {
+		j := (i + 1) % len(q)
+		s += q[i][0]*q[j][1] - q[j][0]*q[i][1]
+	}
+	return math.Abs(s) / 2
+}
+
+func dist(a, b [2]float64) float64 {
+	return math.Hypot(a[0]-b[0], a[1]-b[1])
+}
+
+func degrees(slope float64) float64 {
+	return math.Atan(slope) * 180 / math.Pi
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
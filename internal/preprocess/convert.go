@@ -0,0 +1,171 @@
+package preprocess
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/gen2brain/heic"
+	"golang.org/x/image/webp"
+)
+
+const (
+	MimeHEIC = "image/heic"
+	MimeWebP = "image/webp"
+	MimePDF  = "application/pdf"
+
+	// pdfMaxSide is the longest side a PDF page is rendered at, whatever
+	// its declared page size.
+	pdfMaxSide       = 3000
+	pdfRenderTimeout = 20 * time.Second
+)
+
+// heicBrands are the ISO BMFF major brands used by HEIF stills.
+var heicBrands = map[string]bool{
+	"heic": true, "heix": true, "hevc": true, "hevx": true,
+	"heim": true, "heis": true, "mif1": true, "msf1": true,
+}
+
+// DetectContentType extends http.DetectContentType with HEIC, which the
+// standard sniffer reports as application/octet-stream.
+func DetectContentType(data []byte) string {
+	if len(data) >= 12 && string(data[4:8]) == "ftyp" && heicBrands[string(data[8:12])] {
+		return MimeHEIC
+	}
+	return http.DetectContentType(data)
+}
+
+// Normalize converts WebP, HEIC and PDF uploads to JPEG so OCR and the AI
+// only ever see JPEG or PNG. JPEG and PNG are returned unchanged. A PDF is
+// reduced to its first page, rendered with pdftoppm when it is installed at
+// no more than pdfMaxSide pixels; otherwise the largest JPEG embedded in the
+// file is used, which covers scanned and photographed cards. Images above
+// the pixel limit are rejected with ErrTooLarge before they are decoded.
+func (p *Preprocessor) Normalize(data []byte, mimeType string) ([]byte, string, error) {
+	var img image.Image
+	var err error
+
+	switch mimeType {
+	case "image/jpeg", "image/png":
+		return data, mimeType, nil
+	case MimeWebP:
+		img, err = decodeChecked(data, p.maxPixels, webp.DecodeConfig, webp.Decode)
+	case MimeHEIC:
+		img, err = decodeChecked(data, p.maxPixels, heic.DecodeConfig, heic.Decode)
+	case MimePDF:
+		img, err = p.rasterizePDF(data)
+	default:
+		return nil, "", fmt.Errorf("cannot convert %s", mimeType)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("convert %s: %w", mimeType, err)
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return nil, "", fmt.Errorf("encode image: %w", err)
+	}
+	return buf.Bytes(), "image/jpeg", nil
+}
+
+// decodeChecked decodes with a format's decoder after checking the size its
+// header declares against maxPixels.
+func decodeChecked(data []byte, maxPixels int, config func(io.Reader) (image.Config, error), decode func(io.Reader) (image.Image, error)) (image.Image, error) {
+	cfg, err := config(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSize(cfg.Width, cfg.Height, maxPixels); err != nil {
+		return nil, err
+	}
+	return decode(bytes.NewReader(data))
+}
+
+func (p *Preprocessor) rasterizePDF(data []byte) (image.Image, error) {
+	if path, err := exec.LookPath(p.pdfRenderer); err == nil {
+		return renderPDFPage(path, data, p.maxPixels)
+	}
+	jpg := largestEmbeddedJPEG(data)
+	if jpg == nil {
+		return nil, fmt.Errorf("no PDF renderer (%s) installed and no embedded JPEG found", p.pdfRenderer)
+	}
+	return decodeChecked(jpg, p.maxPixels, jpeg.DecodeConfig, jpeg.Decode)
+}
+
+// renderPDFPage renders page 1 alone with pdftoppm, scaled so that its
+// longest side is pdfMaxSide pixels.
+func renderPDFPage(renderer string, data []byte, maxPixels int) (image.Image, error) {
+	dir, err := os.MkdirTemp("", "loto-pdf-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	in := filepath.Join(dir, "upload.pdf")
+	if err := os.WriteFile(in, data, 0o600); err != nil {
+		return nil, err
+	}
+	out := filepath.Join(dir, "page")
+
+	ctx, cancel := context.WithTimeout(context.Background(), pdfRenderTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, renderer,
+		"-png", "-scale-to", fmt.Sprint(pdfMaxSide), "-f", "1", "-l", "1", "-singlefile", in, out)
+	if msg, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("%s: %w: %s", filepath.Base(renderer), err, bytes.TrimSpace(msg))
+	}
+
+	png, err := os.ReadFile(out + ".png")
+	if err != nil {
+		return nil, err
+	}
+	return Decode(png, maxPixels)
+}
+
+// largestEmbeddedJPEG returns the biggest DCTDecode image stream in a PDF, or
+// nil. Streams are located by their "stream"/"endstream" keywords, so
+// compressed object streams are not searched.
+func largestEmbeddedJPEG(pdf []byte) []byte {
+	var best []byte
+	pos := 0
+	for {
+		i := bytes.Index(pdf[pos:], []byte("stream"))
+		if i < 0 {
+			return best
+		}
+		start := pos + i
+		pos = start + len("stream")
+		if start >= 3 && string(pdf[start-3:start]) == "end" {
+			continue
+		}
+
+		objStart := bytes.LastIndex(pdf[:start], []byte(" obj"))
+		if objStart < 0 {
+			continue
+		}
+		dict := pdf[objStart:start]
+		if !bytes.Contains(dict, []byte("/DCTDecode")) || !bytes.Contains(dict, []byte("/Image")) {
+			continue
+		}
+
+		body := pdf[pos:]
+		body = bytes.TrimPrefix(body, []byte("\r"))
+		body = bytes.TrimPrefix(body, []byte("\n"))
+		end := bytes.Index(body, []byte("endstream"))
+		if end < 0 {
+			return best
+		}
+		stream := bytes.TrimRight(body[:end], "\r\n")
+		if len(stream) > 2 && stream[0] == 0xFF && stream[1] == 0xD8 && len(stream) > len(best) {
+			best = stream
+		}
+	}
+}
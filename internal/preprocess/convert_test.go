@@ -0,0 +1,35 @@
+package preprocess
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"loto/internal/config"
+)
+
+// webpHeader returns a WebP holding only an extended-format header that
+// declares a w×h canvas.
+func webpHeader(w, h uint32) []byte {
+	var vp8x [10]byte
+	put24 := func(b []byte, v uint32) { b[0], b[1], b[2] = byte(v), byte(v>>8), byte(v>>16) }
+	put24(vp8x[4:], w-1)
+	put24(vp8x[7:], h-1)
+
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(4+8+len(vp8x)))
+	buf.WriteString("WEBPVP8X")
+	binary.Write(&buf, binary.LittleEndian, uint32(len(vp8x)))
+	buf.Write(vp8x[:])
+	return buf.Bytes()
+}
+
+func TestNormalizeRejectsOversizedWebP(t *testing.T) {
+	p := New(config.PreprocessConfig{})
+	_, _, err := p.Normalize(webpHeader(1<<24, 1<<24), MimeWebP)
+	if !errors.Is(err, ErrTooLarge) {
+		t.Errorf("got %v, want ErrTooLarge", err)
+	}
+}
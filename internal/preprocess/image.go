@@ -0,0 +1,159 @@
+package preprocess
+
+import (
+	"image"
+	"math"
+)
+
+// resize downscales src to w×h by averaging the source pixels under each
+// destination pixel.
+func resize(src *image.RGBA, w, h int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	sx := float64(sw) / float64(w)
+	sy := float64(sh) / float64(h)
+
+	for y := 0; y < h; y++ {
+		y0 := int(float64(y) * sy)
+		y1 := max(y0+1, min(sh, int(math.Ceil(float64(y+1)*sy))))
+		for x := 0; x < w; x++ {
+			x0 := int(float64(x) * sx)
+			x1 := max(x0+1, min(sw, int(math.Ceil(float64(x+1)*sx))))
+
+			var r, g, b, a, n int
+			for yy := y0; yy < y1; yy++ {
+				i := src.PixOffset(x0, yy)
+				for xx := x0; xx < x1; xx++ {
+					r += int(src.Pix[i])
+					g += int(src.Pix[i+1])
+					b += int(src.Pix[i+2])
+					a += int(src.Pix[i+3])
+					n++
+					i += 4
+				}
+			}
+			di := dst.PixOffset(x, y)
+			dst.Pix[di] = uint8(r / n)
+			dst.Pix[di+1] = uint8(g / n)
+			dst.Pix[di+2] = uint8(b / n)
+			dst.Pix[di+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+func luminance(pix []uint8, i int) int {
+	return (299*int(pix[i]) + 587*int(pix[i+1]) + 114*int(pix[i+2])) / 1000
+}
+
+// stretchContrast maps the 1st–99th luminance percentiles to the full range,
+// applying the same linear map to every channel so colours keep their hue.
+// It reports false and leaves the image alone when the range is already
+// near full or too narrow to stretch safely.
+func stretchContrast(img *image.RGBA) (int, int, bool) {
+	var hist [256]int
+	for i := 0; i < len(img.Pix); i += 4 {
+		hist[luminance(img.Pix, i)]++
+	}
+	total := len(img.Pix) / 4
+	lo, hi := percentile(hist, total, 0.01), percentile(hist, total, 0.99)
+	if hi-lo < 32 || (lo <= 8 && hi >= 247) {
+		return lo, hi, false
+	}
+
+	var lut [256]uint8
+	for v := range lut {
+		s := (v - lo) * 255 / (hi - lo)
+		lut[v] = uint8(max(0, min(255, s)))
+	}
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i] = lut[img.Pix[i]]
+		img.Pix[i+1] = lut[img.Pix[i+1]]
+		img.Pix[i+2] = lut[img.Pix[i+2]]
+	}
+	return lo, hi, true
+}
+
+func percentile(hist [256]int, total int, p float64) int {
+	target := int(float64(total) * p)
+	seen := 0
+	for v, n := range hist {
+		seen += n
+		if seen > target {
+			return v
+		}
+	}
+	return 255
+}
+
+// warp renders a w×h image whose pixel (u, v) is sampled bilinearly from src
+// at m(u, v). Points outside src are white, matching the card stock.
+func warp(src *image.RGBA, w, h int, m func(u, v float64) (float64, float64)) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for v := 0; v < h; v++ {
+		for u := 0; u < w; u++ {
+			x, y := m(float64(u)+0.5, float64(v)+0.5)
+			x -= 0.5
+			y -= 0.5
+			di := dst.PixOffset(u, v)
+			if x < 0 || y < 0 || x > float64(sw-1) || y > float64(sh-1) {
+				dst.Pix[di], dst.Pix[di+1], dst.Pix[di+2], dst.Pix[di+3] = 255, 255, 255, 255
+				continue
+			}
+			x0, y0 := int(x), int(y)
+			x1, y1 := min(x0+1, sw-1), min(y0+1, sh-1)
+			fx, fy := x-float64(x0), y-float64(y0)
+			i00, i10 := src.PixOffset(x0, y0), src.PixOffset(x1, y0)
+			i01, i11 := src.PixOffset(x0, y1), src.PixOffset(x1, y1)
+			for c := 0; c < 4; c++ {
+				top := float64(src.Pix[i00+c])*(1-fx) + float64(src.Pix[i10+c])*fx
+				bot := float64(src.Pix[i01+c])*(1-fx) + float64(src.Pix[i11+c])*fx
+				dst.Pix[di+c] = uint8(top*(1-fy) + bot*fy + 0.5)
+			}
+		}
+	}
+	return dst
+}
+
+// homography returns the projective map sending each from[i] to to[i].
+func homography(from, to [4][2]float64) (func(u, v float64) (float64, float64), bool) {
+	var a [8][9]float64
+	for i := 0; i < 4; i++ {
+		u, v := from[i][0], from[i][1]
+		x, y := to[i][0], to[i][1]
+		a[2*i] = [9]float64{u, v, 1, 0, 0, 0, -u * x, -v * x, x}
+		a[2*i+1] = [9]float64{0, 0, 0, u, v, 1, -u * y, -v * y, y}
+	}
+
+	for col := 0; col < 8; col++ {
+		pivot := col
+		for r := col + 1; r < 8; r++ {
+			if math.Abs(a[r][col]) > math.Abs(a[pivot][col]) {
+				pivot = r
+			}
+		}
+		if math.Abs(a[pivot][col]) < 1e-12 {
+			return nil, false
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		for r := 0; r < 8; r++ {
+			if r == col {
+				continue
+			}
+			f := a[r][col] / a[col][col]
+			for c := col; c < 9; c++ {
+				a[r][c] -= f * a[col][c]
+			}
+		}
+	}
+
+	var h [8]float64
+	for i := range h {
+		h[i] = a[i][8] / a[i][i]
+	}
+	return func(u, v float64) (float64, float64) {
+		d := h[6]*u + h[7]*v + 1
+		return (h[0]*u + h[1]*v + h[2]) / d, (h[3]*u + h[4]*v + h[5]) / d
+	}, true
+}
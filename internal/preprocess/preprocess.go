@@ -0,0 +1,196 @@
+// Package preprocess normalizes ticket photos before they are sent to OCR and
+// the AI: it fixes EXIF orientation, downscales, stretches contrast, removes
+// tilt and perspective using the card's grid lines and crops to the card.
+package preprocess
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	_ "image/png"
+	"slices"
+
+	"loto/internal/config"
+)
+
+// Step names accepted in PREPROCESS_STEPS, in the order they run.
+const (
+	StepOrient   = "orient"
+	StepResize   = "resize"
+	StepContrast = "contrast"
+	StepDeskew   = "deskew"
+	StepCrop     = "crop"
+)
+
+const jpegQuality = 92
+
+// DefaultMaxPixels is the largest image decoded when no limit is configured:
+// 40 megapixels, about 160 MB once decoded.
+const DefaultMaxPixels = 40_000_000
+
+// ErrTooLarge is returned for an image whose header declares more pixels
+// than the limit, before it is decoded.
+var ErrTooLarge = errors.New("image too large")
+
+// Result is the processed image. Steps lists the steps that changed the
+// image, each with a short detail, e.g. "resize:4032x3024>2000x1500".
+type Result struct {
+	Data     []byte
+	MimeType string
+	Width    int
+	Height   int
+	Steps    []string
+}
+
+type Preprocessor struct {
+	enabled      bool
+	maxDimension int
+	maxPixels    int
+	steps        []string
+	pdfRenderer  string
+}
+
+func New(cfg config.PreprocessConfig) *Preprocessor {
+	return &Preprocessor{
+		enabled:      cfg.Enabled,
+		maxDimension: cfg.MaxDimension,
+		maxPixels:    cmp.Or(cfg.MaxPixels, DefaultMaxPixels),
+		steps:        cfg.Steps,
+		pdfRenderer:  cmp.Or(cfg.PDFRenderer, "pdftoppm"),
+	}
+}
+
+// Decode decodes an image after checking from its header that it holds at
+// most maxPixels pixels, or DefaultMaxPixels when maxPixels is 0, so that a
+// small file declaring a huge size cannot exhaust memory.
+func Decode(data []byte, maxPixels int) (image.Image, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSize(cfg.Width, cfg.Height, maxPixels); err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err
+}
+
+func checkSize(width, height, maxPixels int) error {
+	maxPixels = cmp.Or(maxPixels, DefaultMaxPixels)
+	if width <= 0 || height <= 0 || int64(width)*int64(height) > int64(maxPixels) {
+		return fmt.Errorf("%w: %dx%d, at most %d pixels", ErrTooLarge, width, height, maxPixels)
+	}
+	return nil
+}
+
+func (p *Preprocessor) runs(step string) bool {
+	return p.enabled && slices.Contains(p.steps, step)
+}
+
+// Process runs the configured steps. When preprocessing is disabled or no
+// step changes the image the original bytes are returned untouched, so
+// already clean uploads are not re-encoded. Either way an image above the
+// pixel limit is rejected with ErrTooLarge.
+func (p *Preprocessor) Process(data []byte, mimeType string) (*Result, error) {
+	if !p.enabled {
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("decode image: %w", err)
+		}
+		if err := checkSize(cfg.Width, cfg.Height, p.maxPixels); err != nil {
+			return nil, err
+		}
+		return &Result{Data: data, MimeType: mimeType}, nil
+	}
+
+	decoded, err := Decode(data, p.maxPixels)
+	if err != nil {
+		return nil, fmt.Errorf("decode image: %w", err)
+	}
+	img := toRGBA(decoded)
+
+	var steps []string
+
+	if p.runs(StepOrient) && mimeType == "image/jpeg" {
+		if o := exifOrientation(data); o > 1 && o <= 8 {
+			img = orient(img, o)
+			steps = append(steps, fmt.Sprintf("%s:%d", StepOrient, o))
+		}
+	}
+
+	if p.runs(StepResize) && p.maxDimension > 0 {
+		b := img.Bounds()
+		if longest := max(b.Dx(), b.Dy()); longest > p.maxDimension {
+			scale := float64(p.maxDimension) / float64(longest)
+			img = resize(img, max(1, int(float64(b.Dx())*scale)), max(1, int(float64(b.Dy())*scale)))
+			steps = append(steps, fmt.Sprintf("%s:%dx%d>%dx%d", StepResize, b.Dx(), b.Dy(), img.Bounds().Dx(), img.Bounds().Dy()))
+		}
+	}
+
+	if p.runs(StepContrast) {
+		if lo, hi, ok := stretchContrast(img); ok {
+			steps = append(steps, fmt.Sprintf("%s:%d-%d", StepContrast, lo, hi))
+		}
+	}
+
+	if p.runs(StepDeskew) || p.runs(StepCrop) {
+		card := findCard(img)
+		if p.runs(StepDeskew) && card.rotated() {
+			var detail string
+			img, card, detail = rectify(img, card)
+			steps = append(steps, StepDeskew+":"+detail)
+		}
+		if p.runs(StepCrop) && card.found {
+			if cropped, ok := cropToCard(img, card); ok {
+				img = cropped
+				steps = append(steps, fmt.Sprintf("%s:%dx%d", StepCrop, img.Bounds().Dx(), img.Bounds().Dy()))
+			}
+		}
+	}
+
+	b := img.Bounds()
+	if len(steps) == 0 {
+		return &Result{Data: data, MimeType: mimeType, Width: b.Dx(), Height: b.Dy()}, nil
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return nil, fmt.Errorf("encode image: %w", err)
+	}
+	return &Result{Data: buf.Bytes(), MimeType: "image/jpeg", Width: b.Dx(), Height: b.Dy(), Steps: steps}, nil
+}
+
+func toRGBA(src image.Image) *image.RGBA {
+	if rgba, ok := src.(*image.RGBA); ok && rgba.Bounds().Min == (image.Point{}) {
+		return rgba
+	}
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), src, b.Min, draw.Src)
+	return dst
+}
+
+// Crop cuts r out of an encoded image of at most maxPixels pixels (see
+// Decode) and returns it as JPEG together with the region actually cut,
+// which is r clipped to the image.
+func Crop(data []byte, r image.Rectangle, maxPixels int) ([]byte, image.Rectangle, error) {
+	decoded, err := Decode(data, maxPixels)
+	if err != nil {
+		return nil, r, fmt.Errorf("decode image: %w", err)
+	}
+	img := toRGBA(decoded)
+	r = r.Intersect(img.Bounds())
+	if r.Empty() {
+		return nil, r, fmt.Errorf("crop region outside image")
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img.SubImage(r), &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return nil, r, fmt.Errorf("encode image: %w", err)
+	}
+	return buf.Bytes(), r, nil
+}
@@ -0,0 +1,66 @@
+package preprocess
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"testing"
+
+	"loto/internal/config"
+)
+
+// pngHeader returns a PNG holding only a header that declares a w×h image:
+// a few dozen bytes that would take w*h*4 bytes to decode.
+func pngHeader(w, h uint32) []byte {
+	var ihdr [13]byte
+	binary.BigEndian.PutUint32(ihdr[0:], w)
+	binary.BigEndian.PutUint32(ihdr[4:], h)
+	ihdr[8] = 8 // bit depth
+	ihdr[9] = 6 // RGBA
+
+	var buf bytes.Buffer
+	buf.WriteString("\x89PNG\r\n\x1a\n")
+	binary.Write(&buf, binary.BigEndian, uint32(len(ihdr)))
+	chunk := append([]byte("IHDR"), ihdr[:]...)
+	buf.Write(chunk)
+	binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(chunk))
+	return buf.Bytes()
+}
+
+func TestOversizedHeaderIsRejected(t *testing.T) {
+	data := pngHeader(100_000, 100_000)
+
+	if _, err := Decode(data, 0); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Decode: got %v, want ErrTooLarge", err)
+	}
+	if _, _, err := Crop(data, image.Rect(0, 0, 10, 10), 0); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Crop: got %v, want ErrTooLarge", err)
+	}
+	for _, enabled := range []bool{true, false} {
+		p := New(config.PreprocessConfig{Enabled: enabled, Steps: []string{StepResize}, MaxDimension: 2000})
+		if _, err := p.Process(data, "image/png"); !errors.Is(err, ErrTooLarge) {
+			t.Errorf("Process (enabled=%v): got %v, want ErrTooLarge", enabled, err)
+		}
+	}
+}
+
+func TestMaxPixelsAllowsSmallerImages(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 40, 30))); err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := Decode(buf.Bytes(), 1200)
+	if err != nil {
+		t.Fatalf("Decode at the limit: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 40 || b.Dy() != 30 {
+		t.Errorf("decoded %v, want 40x30", b)
+	}
+	if _, err := Decode(buf.Bytes(), 1199); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Decode above the limit: got %v, want ErrTooLarge", err)
+	}
+}
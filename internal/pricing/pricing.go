@@ -0,0 +1,83 @@
+package pricing
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"loto/internal/model"
+)
+
+type ModelPrice struct {
+	InputPerMillion  float64 `json:"input_per_million"`
+	OutputPerMillion float64 `json:"output_per_million"`
+}
+
+type Table struct {
+	Models            map[string]ModelPrice `json:"models"`
+	VisionPerThousand float64               `json:"vision_per_thousand"`
+}
+
+// Default prices in USD. Thinking tokens are billed at the output rate by both
+// OpenAI and Gemini.
+func Default() *Table {
+	return &Table{
+		Models: map[string]ModelPrice{
+			"gpt-5.2":                {InputPerMillion: 1.75, OutputPerMillion: 14.00},
+			"gpt-5-mini":             {InputPerMillion: 0.25, OutputPerMillion: 2.00},
+			"gemini-3-flash-preview": {InputPerMillion: 0.50, OutputPerMillion: 3.00},
+			"gemini-2.5-flash":       {InputPerMillion: 0.30, OutputPerMillion: 2.50},
+			"gemini-2.5-pro":         {InputPerMillion: 1.25, OutputPerMillion: 10.00},
+		},
+		VisionPerThousand: 1.50,
+	}
+}
+
+// Load reads a JSON price table from path and merges it over the defaults.
+func Load(path string) (*Table, error) {
+	t := Default()
+	if path == "" {
+		return t, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading price table: %w", err)
+	}
+
+	var override Table
+	if err := json.Unmarshal(data, &override); err != nil {
+		return nil, fmt.Errorf("parsing price table: %w", err)
+	}
+
+	for name, price := range override.Models {
+		t.Models[name] = price
+	}
+	if override.VisionPerThousand > 0 {
+		t.VisionPerThousand = override.VisionPerThousand
+	}
+	return t, nil
+}
+
+func (t *Table) Cost(u model.Usage) float64 {
+	if u.Provider == "google_vision" {
+		return float64(u.Units) * t.VisionPerThousand / 1000
+	}
+
+	price, ok := t.Models[u.Model]
+	if !ok {
+		return 0
+	}
+	return (float64(u.InputTokens)*price.InputPerMillion +
+		float64(u.OutputTokens+u.ThinkingTokens)*price.OutputPerMillion) / 1_000_000
+}
+
+// Apply fills CostUSD on every usage entry and returns the total.
+func (t *Table) Apply(usage []model.Usage) float64 {
+	var total float64
+	for i := range usage {
+		usage[i].CostUSD = t.Cost(usage[i])
+		total += usage[i].CostUSD
+	}
+	return total
+}
@@ -0,0 +1,224 @@
+package prompt
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+//go:embed templates
+var templatesFS embed.FS
+
+type Kind string
+
+const (
+	KindScan   Kind = "scan"
+	KindHybrid Kind = "hybrid"
+)
+
+const maxFullTextRunes = 500
+
+type Input struct {
+	OCRProvider     string
+	OCRNumbers      []int
+	OCRConfidence   float64
+	FullText        string
+	LotteryTypeHint string
+	Locale          string
+	GridRows        []GridRow
+}
+
+// GridRow is one card row as OCR positioned it; Cells has one entry per
+// column, empty when OCR saw nothing there.
+type GridRow struct {
+	Block int
+	Row   int
+	Cells []string
+}
+
+// Options are per-request prompt settings carried through the context so the
+// ai.Scanner interface stays unchanged.
+type Options struct {
+	Version         string
+	LotteryTypeHint string
+	Locale          string
+}
+
+type ctxKey struct{}
+
+func NewContext(ctx context.Context, opts Options) context.Context {
+	return context.WithValue(ctx, ctxKey{}, opts)
+}
+
+func FromContext(ctx context.Context) Options {
+	opts, _ := ctx.Value(ctxKey{}).(Options)
+	return opts
+}
+
+type Arm struct {
+	Version string
+	Weight  int
+}
+
+type Registry struct {
+	versions   map[string]*template.Template
+	defaultVer string
+	arms       []Arm
+	totalW     int
+}
+
+var funcs = template.FuncMap{
+	"join": func(nums []int, sep string) string {
+		parts := make([]string, len(nums))
+		for i, n := range nums {
+			parts[i] = strconv.Itoa(n)
+		}
+		return strings.Join(parts, sep)
+	},
+	"cells": func(cells []string) string {
+		out := make([]string, len(cells))
+		for i, c := range cells {
+			if c == "" {
+				c = "--"
+			}
+			out[i] = fmt.Sprintf("%5s", c)
+		}
+		return strings.Join(out, " |")
+	},
+}
+
+// Load parses every templates/<version>/*.tmpl directory. defaultVersion is
+// used when no experiment is configured or a request does not pick a version.
+func Load(defaultVersion string, experiment string) (*Registry, error) {
+	r := &Registry{versions: make(map[string]*template.Template)}
+
+	entries, err := fs.ReadDir(templatesFS, "templates")
+	if err != nil {
+		return nil, fmt.Errorf("reading prompt templates: %w", err)
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		tmpl, err := template.New(e.Name()).Funcs(funcs).Option("missingkey=error").
+			ParseFS(templatesFS, "templates/"+e.Name()+"/*.tmpl")
+		if err != nil {
+			return nil, fmt.Errorf("parsing prompt %s: %w", e.Name(), err)
+		}
+		for _, k := range []Kind{KindScan, KindHybrid} {
+			if tmpl.Lookup(string(k)+".tmpl") == nil {
+				return nil, fmt.Errorf("prompt %s: missing %s.tmpl", e.Name(), k)
+			}
+		}
+		r.versions[e.Name()] = tmpl
+	}
+
+	if defaultVersion == "" {
+		defaultVersion = "v1"
+	}
+	if _, ok := r.versions[defaultVersion]; !ok {
+		return nil, fmt.Errorf("unknown prompt version %q", defaultVersion)
+	}
+	r.defaultVer = defaultVersion
+
+	arms, err := parseExperiment(experiment)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range arms {
+		if _, ok := r.versions[a.Version]; !ok {
+			return nil, fmt.Errorf("prompt experiment: unknown version %q", a.Version)
+		}
+		r.totalW += a.Weight
+	}
+	r.arms = arms
+
+	return r, nil
+}
+
+// parseExperiment parses "v1:50,v2:50".
+func parseExperiment(s string) ([]Arm, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	var arms []Arm
+	for _, part := range strings.Split(s, ",") {
+		name, weight, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok {
+			return nil, fmt.Errorf("prompt experiment: expected version:weight, got %q", part)
+		}
+		w, err := strconv.Atoi(weight)
+		if err != nil || w < 0 {
+			return nil, fmt.Errorf("prompt experiment: invalid weight in %q", part)
+		}
+		arms = append(arms, Arm{Version: name, Weight: w})
+	}
+	return arms, nil
+}
+
+func (r *Registry) Versions() []string {
+	out := make([]string, 0, len(r.versions))
+	for v := range r.versions {
+		out = append(out, v)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (r *Registry) Default() string {
+	return r.defaultVer
+}
+
+// Assign picks a version for key (a user or upload ID). The same key always
+// lands in the same arm so a user sees consistent behaviour.
+func (r *Registry) Assign(key string) string {
+	if r.totalW == 0 {
+		return r.defaultVer
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	bucket := int(h.Sum32() % uint32(r.totalW))
+	for _, a := range r.arms {
+		if bucket < a.Weight {
+			return a.Version
+		}
+		bucket -= a.Weight
+	}
+	return r.defaultVer
+}
+
+// Render returns the prompt text and the version actually used.
+func (r *Registry) Render(version string, kind Kind, in Input) (string, string, error) {
+	if version == "" {
+		version = r.defaultVer
+	}
+	tmpl, ok := r.versions[version]
+	if !ok {
+		return "", "", fmt.Errorf("unknown prompt version %q", version)
+	}
+
+	in.FullText = truncateRunes(in.FullText, maxFullTextRunes)
+	if in.OCRProvider == "" {
+		in.OCRProvider = "OCR"
+	}
+
+	var b strings.Builder
+	if err := tmpl.ExecuteTemplate(&b, string(kind)+".tmpl", in); err != nil {
+		return "", "", fmt.Errorf("rendering prompt %s/%s: %w", version, kind, err)
+	}
+	return strings.TrimSpace(b.String()), version, nil
+}
+
+func truncateRunes(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n])
+}
@@ -0,0 +1,118 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepEvery bounds how often the memory store drops idle buckets and
+// expired counters.
+const sweepEvery = time.Minute
+
+// MemoryStore keeps limits in process memory. Each instance of the server
+// has its own limits.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*memBucket
+	counters  map[string]*memCounter
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type memBucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time // when the bucket is full again and can be dropped
+}
+
+type memCounter struct {
+	used    int64
+	expires time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets:  make(map[string]*memBucket),
+		counters: make(map[string]*memCounter),
+		now:      time.Now,
+	}
+}
+
+func (m *MemoryStore) Take(ctx context.Context, buckets []Bucket) ([]float64, int, time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	m.sweep(now)
+
+	state := make([]*memBucket, len(buckets))
+	remaining := make([]float64, len(buckets))
+	for i, b := range buckets {
+		st, ok := m.buckets[b.Key]
+		if !ok {
+			st = &memBucket{tokens: float64(b.Burst), updated: now}
+			m.buckets[b.Key] = st
+		}
+		st.tokens = math.Min(float64(b.Burst), st.tokens+now.Sub(st.updated).Seconds()*b.Rate)
+		st.updated = now
+		if st.tokens < 1 {
+			return nil, i, time.Duration((1 - st.tokens) / b.Rate * float64(time.Second)), nil
+		}
+		state[i] = st
+	}
+
+	for i, b := range buckets {
+		st := state[i]
+		st.tokens--
+		st.full = now.Add(time.Duration((float64(b.Burst) - st.tokens) / b.Rate * float64(time.Second)))
+		remaining[i] = st.tokens
+	}
+	return remaining, -1, 0, nil
+}
+
+func (m *MemoryStore) Add(ctx context.Context, counters []Counter, n int64) ([]int64, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	m.sweep(now)
+
+	used := make([]int64, len(counters))
+	for i, c := range counters {
+		if st, ok := m.counters[c.Key]; ok {
+			used[i] = st.used
+		}
+		if used[i]+n > c.Limit {
+			return used, i, nil
+		}
+	}
+	for i, c := range counters {
+		st, ok := m.counters[c.Key]
+		if !ok {
+			st = &memCounter{expires: c.Expires}
+			m.counters[c.Key] = st
+		}
+		st.used += n
+		used[i] = st.used
+	}
+	return used, -1, nil
+}
+
+// sweep drops full buckets, which behave the same as missing ones, and
+// counters of past periods. Callers hold m.mu.
+func (m *MemoryStore) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < sweepEvery {
+		return
+	}
+	m.lastSweep = now
+	for key, b := range m.buckets {
+		if now.After(b.full) {
+			delete(m.buckets, key)
+		}
+	}
+	for key, c := range m.counters {
+		if now.After(c.expires) {
+			delete(m.counters, key)
+		}
+	}
+}
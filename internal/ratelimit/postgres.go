@@ -0,0 +1,107 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PostgresStore keeps limits in the rate_buckets and quota_counters tables,
+// so all instances behind a load balancer share them. Rows are locked for
+// the duration of a check, which serialises requests of the same caller.
+type PostgresStore struct {
+	db *pgxpool.Pool
+}
+
+func NewPostgresStore(db *pgxpool.Pool) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (p *PostgresStore) Take(ctx context.Context, buckets []Bucket) ([]float64, int, time.Duration, error) {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	remaining := make([]float64, len(buckets))
+	for i, b := range buckets {
+		var tokens float64
+		err := tx.QueryRow(ctx,
+			`INSERT INTO rate_buckets (key, tokens, updated_at, expires_at)
+			 VALUES ($1, $2, NOW(), NOW())
+			 ON CONFLICT (key) DO UPDATE
+			 SET tokens = LEAST($2, rate_buckets.tokens + EXTRACT(EPOCH FROM NOW() - rate_buckets.updated_at) * $3),
+			     updated_at = NOW()
+			 RETURNING tokens`,
+			b.Key, float64(b.Burst), b.Rate,
+		).Scan(&tokens)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		if tokens < 1 {
+			if err := tx.Commit(ctx); err != nil {
+				return nil, 0, 0, err
+			}
+			return nil, i, time.Duration((1 - tokens) / b.Rate * float64(time.Second)), nil
+		}
+		remaining[i] = tokens - 1
+	}
+
+	for i, b := range buckets {
+		full := time.Duration((float64(b.Burst) - remaining[i]) / b.Rate * float64(time.Second))
+		if _, err := tx.Exec(ctx,
+			`UPDATE rate_buckets SET tokens = $2, expires_at = NOW() + $3 * INTERVAL '1 second' WHERE key = $1`,
+			b.Key, remaining[i], math.Ceil(full.Seconds()),
+		); err != nil {
+			return nil, 0, 0, err
+		}
+	}
+	return remaining, -1, 0, tx.Commit(ctx)
+}
+
+func (p *PostgresStore) Add(ctx context.Context, counters []Counter, n int64) ([]int64, int, error) {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	used := make([]int64, len(counters))
+	for i, c := range counters {
+		err := tx.QueryRow(ctx,
+			`INSERT INTO quota_counters (key, used, expires_at)
+			 VALUES ($1, 0, $2)
+			 ON CONFLICT (key) DO UPDATE SET key = EXCLUDED.key
+			 RETURNING used`,
+			c.Key, c.Expires,
+		).Scan(&used[i])
+		if err != nil {
+			return nil, 0, err
+		}
+		if used[i]+n > c.Limit {
+			return used, i, nil
+		}
+	}
+
+	for i, c := range counters {
+		if err := tx.QueryRow(ctx,
+			`UPDATE quota_counters SET used = used + $2 WHERE key = $1 RETURNING used`,
+			c.Key, n,
+		).Scan(&used[i]); err != nil {
+			return nil, 0, err
+		}
+	}
+	return used, -1, tx.Commit(ctx)
+}
+
+// Cleanup deletes full buckets and counters of past periods.
+func (p *PostgresStore) Cleanup(ctx context.Context) error {
+	batch := &pgx.Batch{}
+	batch.Queue(`DELETE FROM rate_buckets WHERE expires_at < NOW()`)
+	batch.Queue(`DELETE FROM quota_counters WHERE expires_at < NOW()`)
+	return p.db.SendBatch(ctx, batch).Close()
+}
@@ -0,0 +1,211 @@
+// Package ratelimit throttles callers with token buckets and caps their scans
+// with daily and monthly quotas. Callers are identified by IP, user or API
+// key; state lives in a Store, in memory for a single instance or in
+// Postgres when several instances share the limits.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"loto/internal/config"
+)
+
+// Kinds of subject a limit applies to.
+const (
+	KindIP   = "ip"
+	KindUser = "user"
+	KindKey  = "key"
+)
+
+// Subject is one identity of a caller.
+type Subject struct {
+	Kind string
+	ID   string
+}
+
+// Bucket is a token bucket holding at most Burst tokens, refilled at Rate
+// tokens per second.
+type Bucket struct {
+	Key   string
+	Rate  float64
+	Burst int
+}
+
+// Counter counts usage of Key up to Limit until Expires, when the period
+// ends.
+type Counter struct {
+	Key     string
+	Limit   int64
+	Expires time.Time
+}
+
+// Store keeps buckets and counters. Both operations are all-or-nothing, so a
+// request refused by one limit does not use up the others.
+type Store interface {
+	// Take removes one token from every bucket if each has one. Otherwise it
+	// takes nothing and returns the index of the first empty bucket and how
+	// long until it holds a token. remaining is the tokens left per bucket.
+	Take(ctx context.Context, buckets []Bucket) (remaining []float64, empty int, wait time.Duration, err error)
+	// Add adds n to every counter if none would exceed its limit. Otherwise it
+	// adds nothing and returns the index of the first full counter. used is
+	// the count per counter afterwards.
+	Add(ctx context.Context, counters []Counter, n int64) (used []int64, full int, err error)
+}
+
+// Result describes the tightest limit a request was checked against, for the
+// X-RateLimit-* headers. RetryAfter is set when the request was refused.
+type Result struct {
+	Allowed    bool
+	Limit      int64
+	Remaining  int64
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+type Limiter struct {
+	store Store
+	cfg   config.RateLimitConfig
+	now   func() time.Time
+}
+
+func New(store Store, cfg config.RateLimitConfig) *Limiter {
+	return &Limiter{store: store, cfg: cfg, now: time.Now}
+}
+
+// Allow takes a token from the bucket of every subject. Subjects without a
+// configured rate are not limited.
+func (l *Limiter) Allow(ctx context.Context, subjects ...Subject) (Result, error) {
+	var buckets []Bucket
+	for _, s := range subjects {
+		rate := l.rate(s.Kind)
+		if rate.PerMinute <= 0 || s.ID == "" {
+			continue
+		}
+		buckets = append(buckets, Bucket{
+			Key:   "rate:" + s.Kind + ":" + s.ID,
+			Rate:  rate.PerMinute / 60,
+			Burst: max(1, rate.Burst),
+		})
+	}
+	if len(buckets) == 0 {
+		return Result{Allowed: true}, nil
+	}
+
+	remaining, empty, wait, err := l.store.Take(ctx, buckets)
+	if err != nil {
+		return Result{Allowed: true}, err
+	}
+	if empty >= 0 {
+		b := buckets[empty]
+		return Result{
+			Limit:      int64(b.Burst),
+			Reset:      wait,
+			RetryAfter: wait,
+		}, nil
+	}
+
+	// Report the bucket closest to empty.
+	tightest := 0
+	for i := range buckets {
+		if remaining[i] < remaining[tightest] {
+			tightest = i
+		}
+	}
+	b := buckets[tightest]
+	left := remaining[tightest]
+	return Result{
+		Allowed:   true,
+		Limit:     int64(b.Burst),
+		Remaining: int64(math.Floor(left)),
+		Reset:     time.Duration((float64(b.Burst) - left) / b.Rate * float64(time.Second)),
+	}, nil
+}
+
+// UseScans counts n scans against the daily and monthly quota of every
+// subject. Quotas of 0 are unlimited. Periods are UTC calendar days and
+// months.
+func (l *Limiter) UseScans(ctx context.Context, n int, subjects ...Subject) (Result, error) {
+	now := l.now().UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	var counters []Counter
+	for _, s := range subjects {
+		if s.ID == "" {
+			continue
+		}
+		q := l.quota(s.Kind)
+		if q.Daily > 0 {
+			counters = append(counters, Counter{
+				Key:     fmt.Sprintf("quota:%s:%s:%s", s.Kind, s.ID, day.Format(time.DateOnly)),
+				Limit:   q.Daily,
+				Expires: day.AddDate(0, 0, 1),
+			})
+		}
+		if q.Monthly > 0 {
+			counters = append(counters, Counter{
+				Key:     fmt.Sprintf("quota:%s:%s:%s", s.Kind, s.ID, month.Format("2006-01")),
+				Limit:   q.Monthly,
+				Expires: month.AddDate(0, 1, 0),
+			})
+		}
+	}
+	if len(counters) == 0 {
+		return Result{Allowed: true}, nil
+	}
+
+	used, full, err := l.store.Add(ctx, counters, int64(n))
+	if err != nil {
+		return Result{Allowed: true}, err
+	}
+	if full >= 0 {
+		c := counters[full]
+		return Result{
+			Limit:      c.Limit,
+			Remaining:  max(0, c.Limit-used[full]),
+			Reset:      c.Expires.Sub(now),
+			RetryAfter: c.Expires.Sub(now),
+		}, nil
+	}
+
+	tightest := 0
+	for i, c := range counters {
+		if c.Limit-used[i] < counters[tightest].Limit-used[tightest] {
+			tightest = i
+		}
+	}
+	c := counters[tightest]
+	return Result{
+		Allowed:   true,
+		Limit:     c.Limit,
+		Remaining: c.Limit - used[tightest],
+		Reset:     c.Expires.Sub(now),
+	}, nil
+}
+
+func (l *Limiter) rate(kind string) config.Rate {
+	switch kind {
+	case KindIP:
+		return l.cfg.IP
+	case KindUser:
+		return l.cfg.User
+	case KindKey:
+		return l.cfg.Key
+	}
+	return config.Rate{}
+}
+
+func (l *Limiter) quota(kind string) config.Quota {
+	switch kind {
+	case KindIP:
+		return l.cfg.IPQuota
+	case KindUser:
+		return l.cfg.UserQuota
+	case KindKey:
+		return l.cfg.KeyQuota
+	}
+	return config.Quota{}
+}
@@ -0,0 +1,183 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"loto/internal/model"
+)
+
+const apiKeyColumns = `id, user_id, name, prefix, scopes, rotated_from, created_at, last_used_at, expires_at, revoked_at`
+
+func scanAPIKey(row pgx.Row) (*model.APIKey, error) {
+	var k model.APIKey
+	err := row.Scan(&k.ID, &k.UserID, &k.Name, &k.Prefix, &k.Scopes, &k.RotatedFrom,
+		&k.CreatedAt, &k.LastUsedAt, &k.ExpiresAt, &k.RevokedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+// execer is satisfied by both the pool and a transaction.
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+func (r *Repository) CreateAPIKey(ctx context.Context, key *model.APIKey, keyHash string) error {
+	return createAPIKey(ctx, r.db, key, keyHash)
+}
+
+func createAPIKey(ctx context.Context, db execer, key *model.APIKey, keyHash string) error {
+	key.ID = uuid.NewString()
+	key.CreatedAt = time.Now().UTC()
+	_, err := db.Exec(ctx,
+		`INSERT INTO api_keys (id, user_id, name, prefix, key_hash, scopes, rotated_from, created_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		key.ID, key.UserID, key.Name, key.Prefix, keyHash, key.Scopes, key.RotatedFrom, key.CreatedAt,
+	)
+	return err
+}
+
+// ListAPIKeys returns all keys, newest first, including revoked ones.
+func (r *Repository) ListAPIKeys(ctx context.Context) ([]model.APIKey, error) {
+	rows, err := r.db.Query(ctx,
+		`SELECT `+apiKeyColumns+` FROM api_keys ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []model.APIKey
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *k)
+	}
+	return keys, rows.Err()
+}
+
+func (r *Repository) GetAPIKey(ctx context.Context, keyID string) (*model.APIKey, error) {
+	return scanAPIKey(r.db.QueryRow(ctx,
+		`SELECT `+apiKeyColumns+` FROM api_keys WHERE id = $1`, keyID))
+}
+
+// GetActiveAPIKey looks a key up by its hash, ignoring revoked and expired
+// keys.
+func (r *Repository) GetActiveAPIKey(ctx context.Context, keyHash string) (*model.APIKey, error) {
+	return scanAPIKey(r.db.QueryRow(ctx,
+		`SELECT `+apiKeyColumns+` FROM api_keys
+		 WHERE key_hash = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())`,
+		keyHash,
+	))
+}
+
+// RotateAPIKey stores next as the replacement of the active key oldID and
+// lets oldID expire after grace. It returns ErrNotFound when oldID is not
+// active.
+func (r *Repository) RotateAPIKey(ctx context.Context, oldID string, next *model.APIKey, keyHash string, grace time.Duration) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx,
+		`UPDATE api_keys
+		 SET expires_at = LEAST(COALESCE(expires_at, 'infinity'), $2)
+		 WHERE id = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())`,
+		oldID, time.Now().UTC().Add(grace),
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	next.RotatedFrom = &oldID
+	if err := createAPIKey(ctx, tx, next, keyHash); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// RevokeAPIKey disables a key immediately. It returns ErrNotFound when the
+// key does not exist or was already revoked.
+func (r *Repository) RevokeAPIKey(ctx context.Context, keyID string) error {
+	tag, err := r.db.Exec(ctx,
+		`UPDATE api_keys SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL`, keyID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RecordAPIKeyUse counts one request of a key in today's usage.
+func (r *Repository) RecordAPIKeyUse(ctx context.Context, keyID string, failed bool) error {
+	failures := 0
+	if failed {
+		failures = 1
+	}
+	_, err := r.db.Exec(ctx,
+		`WITH touched AS (
+		     UPDATE api_keys SET last_used_at = NOW() WHERE id = $1
+		 )
+		 INSERT INTO api_key_usage (key_id, day, requests, errors)
+		 VALUES ($1, (NOW() AT TIME ZONE 'UTC')::date, 1, $2)
+		 ON CONFLICT (key_id, day) DO UPDATE
+		 SET requests = api_key_usage.requests + 1, errors = api_key_usage.errors + EXCLUDED.errors`,
+		keyID, failures,
+	)
+	return err
+}
+
+// GetAPIKeyUsage returns a key's daily requests, failed requests, saved
+// scans and their cost in [from, to), newest day first.
+func (r *Repository) GetAPIKeyUsage(ctx context.Context, keyID string, from, to time.Time) ([]model.APIKeyUsage, error) {
+	rows, err := r.db.Query(ctx,
+		`WITH requests AS (
+		     SELECT day, requests, errors FROM api_key_usage
+		     WHERE key_id = $1
+		       AND day >= ($2::timestamptz AT TIME ZONE 'UTC')::date
+		       AND day < ($3::timestamptz AT TIME ZONE 'UTC')::date
+		 ), scanned AS (
+		     SELECT (created_at AT TIME ZONE 'UTC')::date AS day, COUNT(*) AS scans, SUM(cost_usd) AS cost
+		     FROM scans
+		     WHERE api_key_id = $1 AND created_at >= $2::timestamptz AND created_at < $3::timestamptz
+		     GROUP BY 1
+		 )
+		 SELECT COALESCE(r.day, s.day), COALESCE(r.requests, 0), COALESCE(r.errors, 0),
+		        COALESCE(s.scans, 0), COALESCE(s.cost, 0)
+		 FROM requests r FULL OUTER JOIN scanned s ON r.day = s.day
+		 ORDER BY 1 DESC`,
+		keyID, from, to,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []model.APIKeyUsage
+	for rows.Next() {
+		var u model.APIKeyUsage
+		if err := rows.Scan(&u.Day, &u.Requests, &u.Errors, &u.Scans, &u.CostUSD); err != nil {
+			return nil, err
+		}
+		items = append(items, u)
+	}
+	return items, rows.Err()
+}
@@ -0,0 +1,688 @@
+// Package conformance checks that a repository.Store behaves like the
+// Postgres one, so that the backends stay interchangeable. Each backend's
+// tests run it, as does the server with -check-storage. Every record it writes has fresh IDs, emails,
+// prompt versions and models, so it is safe to run against a scratch
+// database that is not empty; it never deletes anything.
+package conformance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"loto/internal/model"
+	"loto/internal/repository"
+)
+
+type check struct {
+	name string
+	fn   func(ctx context.Context, s repository.Store) error
+}
+
+var checks = []check{
+	{"users", checkUsers},
+	{"refresh tokens", checkRefreshTokens},
+	{"scans", checkScans},
+	{"scan history", checkHistory},
+	{"duplicates", checkDuplicates},
+	{"stats", checkStats},
+	{"batches", checkBatches},
+	{"api keys", checkAPIKeys},
+	{"lottery results", checkLotteryResults},
+}
+
+// Run runs every check against s and returns their failures joined.
+func Run(ctx context.Context, s repository.Store) error {
+	var errs []error
+	for _, c := range checks {
+		if err := c.fn(ctx, s); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", c.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func unique(prefix string) string {
+	return prefix + "-" + uuid.NewString()
+}
+
+// sameTime compares at the microsecond precision every backend keeps.
+func sameTime(a, b time.Time) bool {
+	return a.Truncate(time.Microsecond).Equal(b.Truncate(time.Microsecond))
+}
+
+func expectErr(what string, got, want error) error {
+	if !errors.Is(got, want) {
+		return fmt.Errorf("%s: got error %v, want %v", what, got, want)
+	}
+	return nil
+}
+
+func newUser(ctx context.Context, s repository.Store) (*model.User, error) {
+	u := &model.User{Email: ptr(unique("conformance") + "@example.com"), PasswordHash: ptr("hash")}
+	if err := s.CreateUser(ctx, u); err != nil {
+		return nil, fmt.Errorf("create user: %w", err)
+	}
+	return u, nil
+}
+
+func checkUsers(ctx context.Context, s repository.Store) error {
+	email := unique("Conformance") + "@Example.com"
+	u := &model.User{Email: ptr(email), PasswordHash: ptr("hash")}
+	if err := s.CreateUser(ctx, u); err != nil {
+		return fmt.Errorf("create: %w", err)
+	}
+	if u.ID == "" || u.CreatedAt.IsZero() || u.Anonymous {
+		return fmt.Errorf("create did not fill ID, CreatedAt and Anonymous: %+v", u)
+	}
+	if err := expectErr("duplicate email", s.CreateUser(ctx, &model.User{Email: ptr(email)}), repository.ErrConflict); err != nil {
+		return err
+	}
+
+	got, err := s.GetUserByEmail(ctx, email)
+	if err != nil {
+		return fmt.Errorf("get by email: %w", err)
+	}
+	if got.ID != u.ID || !sameTime(got.CreatedAt, u.CreatedAt) || got.PasswordHash == nil || *got.PasswordHash != "hash" {
+		return fmt.Errorf("get by email: got %+v, want %+v", got, u)
+	}
+	if _, err := s.GetUserByID(ctx, u.ID); err != nil {
+		return fmt.Errorf("get by id: %w", err)
+	}
+	if err := expectErr("missing user", func() error { _, err := s.GetUserByID(ctx, uuid.NewString()); return err }(), repository.ErrNotFound); err != nil {
+		return err
+	}
+
+	device := unique("device")
+	anon := &model.User{DeviceID: ptr(device)}
+	if err := s.CreateUser(ctx, anon); err != nil {
+		return fmt.Errorf("create anonymous: %w", err)
+	}
+	if err := expectErr("duplicate device", s.CreateUser(ctx, &model.User{DeviceID: ptr(device)}), repository.ErrConflict); err != nil {
+		return err
+	}
+	got, err = s.GetUserByDeviceID(ctx, device)
+	if err != nil {
+		return fmt.Errorf("get by device: %w", err)
+	}
+	if got.ID != anon.ID || !got.Anonymous {
+		return fmt.Errorf("get by device: got %+v, want %+v", got, anon)
+	}
+
+	if _, err := s.UpgradeUser(ctx, anon.ID, email, "hash"); !errors.Is(err, repository.ErrConflict) {
+		return fmt.Errorf("upgrade to a taken email: got error %v, want %v", err, repository.ErrConflict)
+	}
+	upgraded, err := s.UpgradeUser(ctx, anon.ID, unique("upgraded")+"@example.com", "hash")
+	if err != nil {
+		return fmt.Errorf("upgrade: %w", err)
+	}
+	if upgraded.ID != anon.ID || upgraded.Anonymous || upgraded.DeviceID != nil {
+		return fmt.Errorf("upgrade: got %+v", upgraded)
+	}
+	if _, err := s.UpgradeUser(ctx, anon.ID, unique("again")+"@example.com", "hash"); !errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("upgrade a registered user: got error %v, want %v", err, repository.ErrNotFound)
+	}
+	return nil
+}
+
+func checkRefreshTokens(ctx context.Context, s repository.Store) error {
+	u, err := newUser(ctx, s)
+	if err != nil {
+		return err
+	}
+	first, second, expired := unique("token"), unique("token"), unique("token")
+	for _, tok := range []string{first, second} {
+		if err := s.SaveRefreshToken(ctx, u.ID, tok, time.Now().Add(time.Hour)); err != nil {
+			return fmt.Errorf("save: %w", err)
+		}
+	}
+	if err := s.SaveRefreshToken(ctx, u.ID, expired, time.Now().Add(-time.Hour)); err != nil {
+		return fmt.Errorf("save: %w", err)
+	}
+
+	if _, err := s.UseRefreshToken(ctx, expired); !errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("use expired: got error %v, want %v", err, repository.ErrNotFound)
+	}
+	userID, err := s.UseRefreshToken(ctx, first)
+	if err != nil || userID != u.ID {
+		return fmt.Errorf("use: got %q, %v, want %q", userID, err, u.ID)
+	}
+	// Reusing a spent token revokes the rest of the user's tokens.
+	if _, err := s.UseRefreshToken(ctx, first); !errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("reuse: got error %v, want %v", err, repository.ErrNotFound)
+	}
+	if _, err := s.UseRefreshToken(ctx, second); !errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("use after reuse: got error %v, want %v", err, repository.ErrNotFound)
+	}
+
+	third := unique("token")
+	if err := s.SaveRefreshToken(ctx, u.ID, third, time.Now().Add(time.Hour)); err != nil {
+		return fmt.Errorf("save: %w", err)
+	}
+	if err := s.RevokeRefreshToken(ctx, third); err != nil {
+		return fmt.Errorf("revoke: %w", err)
+	}
+	if _, err := s.UseRefreshToken(ctx, third); !errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("use revoked: got error %v, want %v", err, repository.ErrNotFound)
+	}
+	return nil
+}
+
+func checkScans(ctx context.Context, s repository.Store) error {
+	u, err := newUser(ctx, s)
+	if err != nil {
+		return err
+	}
+	scan := &model.Scan{
+		UserID:           &u.ID,
+		ImageURL:         "https://example.com/card.jpg",
+		LotteryType:      "loto",
+		Blocks:           []model.Block{{Row1: []int{1, 12}, Row2: []int{23}, Row3: []int{34, 45}}},
+		ExtractedNumbers: []int{1, 12, 23, 34, 45},
+		Confidence:       0.9,
+		Status:           "confirmed",
+		Notes:            "note",
+		Provider:         "openai",
+		Model:            "gpt-test",
+		CostUSD:          0.0125,
+		PromptVersion:    "v-test",
+		Path:             "hybrid",
+		DurationMS:       1234,
+		Preprocessing:    []string{"deskew"},
+		UploadID:         ptr(uuid.NewString()),
+		CardIndex:        2,
+		Fingerprint:      ptr(unique("fp")),
+		TicketID:         ptr(unique("ticket")),
+		OCRTokens:        []model.OCRToken{{Text: "12", Confidence: 0.8, X: 1, Y: 2, Width: 3, Height: 4}},
+		RawResponse:      `{"numbers":[1]}`,
+		Usage:            []model.Usage{{Provider: "openai", Model: "gpt-test", InputTokens: 10, OutputTokens: 5, CostUSD: 0.0125}},
+	}
+	if err := s.SaveScan(ctx, scan); err != nil {
+		return fmt.Errorf("save: %w", err)
+	}
+	if scan.ID == "" || scan.CreatedAt.IsZero() {
+		return fmt.Errorf("save did not fill ID and CreatedAt")
+	}
+
+	got, err := s.GetScanByID(ctx, scan.ID)
+	if err != nil {
+		return fmt.Errorf("get: %w", err)
+	}
+	if !sameTime(got.CreatedAt, scan.CreatedAt) {
+		return fmt.Errorf("get: created_at %v, want %v", got.CreatedAt, scan.CreatedAt)
+	}
+	want := *scan
+	want.CreatedAt, want.Usage = got.CreatedAt, got.Usage
+	if !reflect.DeepEqual(*got, want) {
+		return fmt.Errorf("get: got %+v, want %+v", *got, want)
+	}
+
+	bare := &model.Scan{ImageURL: "https://example.com/bare.jpg", Status: "rejected", CardIndex: 1}
+	if err := s.SaveScan(ctx, bare); err != nil {
+		return fmt.Errorf("save without optional fields: %w", err)
+	}
+	if got, err = s.GetScanByID(ctx, bare.ID); err != nil {
+		return fmt.Errorf("get without optional fields: %w", err)
+	}
+	if got.UserID != nil || got.Blocks == nil || got.ExtractedNumbers == nil || got.Preprocessing == nil {
+		return fmt.Errorf("get without optional fields: want nil pointers and empty slices, got %+v", *got)
+	}
+
+	// A scan queued while the database was down keeps its ID and time.
+	queued := &model.Scan{ID: uuid.NewString(), ImageURL: "x", Status: "confirmed", CardIndex: 1, CreatedAt: time.Now().Add(-time.Hour).UTC().Truncate(time.Microsecond)}
+	at := queued.CreatedAt
+	if err := s.SaveScan(ctx, queued); err != nil {
+		return fmt.Errorf("save with an ID: %w", err)
+	}
+	if got, err = s.GetScanByID(ctx, queued.ID); err != nil || !sameTime(got.CreatedAt, at) {
+		return fmt.Errorf("save with an ID: got %v, %v, want created_at %v", got, err, at)
+	}
+	if err := expectErr("save an ID twice", s.SaveScan(ctx, queued), repository.ErrConflict); err != nil {
+		return err
+	}
+
+	_, err = s.GetScanByID(ctx, uuid.NewString())
+	return expectErr("missing scan", err, repository.ErrNotFound)
+}
+
+func checkHistory(ctx context.Context, s repository.Store) error {
+	u, err := newUser(ctx, s)
+	if err != nil {
+		return err
+	}
+	specs := []struct {
+		status      string
+		lotteryType string
+		confidence  float64
+	}{
+		{"confirmed", "loto", 0.9},
+		{"needs_confirmation", "loto", 0.5},
+		{"rejected", "keno", 0.2},
+		{"confirmed", "keno", 0.95},
+		{"confirmed", "loto", 0.7},
+	}
+	var ids []string
+	for _, sp := range specs {
+		scan := &model.Scan{UserID: &u.ID, ImageURL: "x", Status: sp.status, LotteryType: sp.lotteryType, Confidence: sp.confidence, CardIndex: 1}
+		if err := s.SaveScan(ctx, scan); err != nil {
+			return fmt.Errorf("save: %w", err)
+		}
+		ids = append(ids, scan.ID)
+		// Keep created_at distinct so that the order is fully determined.
+		time.Sleep(2 * time.Millisecond)
+	}
+	slices.Reverse(ids)
+
+	list := func(f repository.ScanFilter) ([]string, error) {
+		if f.Limit == 0 {
+			f.Limit = 100
+		}
+		items, err := s.GetScansByUserID(ctx, u.ID, f)
+		if err != nil {
+			return nil, err
+		}
+		var got []string
+		for _, item := range items {
+			got = append(got, item.ID)
+		}
+		return got, nil
+	}
+
+	all, err := list(repository.ScanFilter{})
+	if err != nil {
+		return fmt.Errorf("list: %w", err)
+	}
+	if !slices.Equal(all, ids) {
+		return fmt.Errorf("list: got %v, want newest first %v", all, ids)
+	}
+
+	// Page through two at a time with the last item as the cursor.
+	var paged []string
+	f := repository.ScanFilter{Limit: 2}
+	for {
+		items, err := s.GetScansByUserID(ctx, u.ID, f)
+		if err != nil {
+			return fmt.Errorf("page: %w", err)
+		}
+		for _, item := range items {
+			paged = append(paged, item.ID)
+		}
+		if len(items) < f.Limit {
+			break
+		}
+		last := items[len(items)-1]
+		f.AfterTime, f.AfterID = last.CreatedAt, last.ID
+	}
+	if !slices.Equal(paged, ids) {
+		return fmt.Errorf("pages: got %v, want %v", paged, ids)
+	}
+
+	filters := []struct {
+		name string
+		f    repository.ScanFilter
+		want []string
+	}{
+		{"status", repository.ScanFilter{Status: "confirmed"}, []string{ids[0], ids[1], ids[4]}},
+		{"lottery type", repository.ScanFilter{LotteryType: "keno"}, []string{ids[1], ids[2]}},
+		{"min confidence", repository.ScanFilter{MinConfidence: ptr(0.7)}, []string{ids[0], ids[1], ids[4]}},
+		{"future", repository.ScanFilter{From: time.Now().Add(time.Hour)}, nil},
+		{"past", repository.ScanFilter{To: time.Now().Add(-time.Hour)}, nil},
+		{"window", repository.ScanFilter{From: time.Now().Add(-time.Hour), To: time.Now().Add(time.Hour)}, ids},
+	}
+	for _, tc := range filters {
+		got, err := list(tc.f)
+		if err != nil {
+			return fmt.Errorf("filter %s: %w", tc.name, err)
+		}
+		if !slices.Equal(got, tc.want) {
+			return fmt.Errorf("filter %s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+	return nil
+}
+
+func checkDuplicates(ctx context.Context, s repository.Store) error {
+	alice, err := newUser(ctx, s)
+	if err != nil {
+		return err
+	}
+	bob, err := newUser(ctx, s)
+	if err != nil {
+		return err
+	}
+	fp, ticket := unique("fp"), unique("ticket")
+
+	save := func(userID *string, status string, fingerprint, ticketID *string) (*model.Scan, error) {
+		scan := &model.Scan{UserID: userID, ImageURL: "x", Status: status, CardIndex: 1, Fingerprint: fingerprint, TicketID: ticketID}
+		return scan, s.SaveScan(ctx, scan)
+	}
+	first, err := save(&alice.ID, "confirmed", &fp, &ticket)
+	if err != nil {
+		return fmt.Errorf("save: %w", err)
+	}
+	reasons, err := s.FindDuplicates(ctx, first)
+	if err != nil || len(reasons) != 0 {
+		return fmt.Errorf("first scan: got %v, %v, want none", reasons, err)
+	}
+
+	// The same user rescanning a card is not a duplicate.
+	again, err := save(&alice.ID, "confirmed", &fp, &ticket)
+	if err != nil {
+		return fmt.Errorf("save: %w", err)
+	}
+	if reasons, err = s.FindDuplicates(ctx, again); err != nil || len(reasons) != 0 {
+		return fmt.Errorf("same user: got %v, %v, want none", reasons, err)
+	}
+
+	other, err := save(&bob.ID, "confirmed", &fp, &ticket)
+	if err != nil {
+		return fmt.Errorf("save: %w", err)
+	}
+	reasons, err = s.FindDuplicates(ctx, other)
+	if want := []string{model.DuplicateLayout, model.DuplicateTicketID}; err != nil || !slices.Equal(reasons, want) {
+		return fmt.Errorf("other user: got %v, %v, want %v", reasons, err, want)
+	}
+
+	// A ticket ID seen with another layout is a duplicate even for the same
+	// user, as in GetSuspiciousCards.
+	own := unique("ticket")
+	if _, err := save(&alice.ID, "confirmed", ptr(unique("fp")), &own); err != nil {
+		return fmt.Errorf("save: %w", err)
+	}
+	relaid, err := save(&alice.ID, "confirmed", ptr(unique("fp")), &own)
+	if err != nil {
+		return fmt.Errorf("save: %w", err)
+	}
+	reasons, err = s.FindDuplicates(ctx, relaid)
+	if want := []string{model.DuplicateTicketID}; err != nil || !slices.Equal(reasons, want) {
+		return fmt.Errorf("same user, other layout: got %v, %v, want %v", reasons, err, want)
+	}
+
+	// Rejected scans are not evidence of a duplicate.
+	lone := unique("ticket")
+	if _, err := save(&alice.ID, "rejected", nil, &lone); err != nil {
+		return fmt.Errorf("save: %w", err)
+	}
+	anon, err := save(nil, "confirmed", nil, &lone)
+	if err != nil {
+		return fmt.Errorf("save: %w", err)
+	}
+	if reasons, err = s.FindDuplicates(ctx, anon); err != nil || len(reasons) != 0 {
+		return fmt.Errorf("against a rejected scan: got %v, %v, want none", reasons, err)
+	}
+	return nil
+}
+
+func checkStats(ctx context.Context, s repository.Store) error {
+	from := time.Now().Add(-time.Second)
+	version, modelName, fp := unique("prompt"), unique("model"), unique("fp")
+
+	u, err := newUser(ctx, s)
+	if err != nil {
+		return err
+	}
+	scans := []*model.Scan{
+		{UserID: &u.ID, Status: "confirmed", Confidence: 0.9, ExtractedNumbers: []int{1, 2, 3, 4}, Fingerprint: &fp},
+		{Status: "needs_confirmation", Confidence: 0.5, ExtractedNumbers: []int{1, 2}, Fingerprint: &fp},
+		{UserID: &u.ID, Status: "rejected", Confidence: 0.1, ExtractedNumbers: []int{1, 2, 3, 4, 5, 6, 7, 8, 9}},
+	}
+	for _, scan := range scans {
+		scan.ImageURL, scan.CardIndex, scan.PromptVersion = "x", 1, version
+		scan.Usage = []model.Usage{
+			{Provider: "conformance", Model: modelName, InputTokens: 100, OutputTokens: 10, CostUSD: 0.01},
+			{Provider: "conformance", Model: modelName, InputTokens: 50, ThinkingTokens: 5, Units: 1, CostUSD: 0.02},
+		}
+		if err := s.SaveScan(ctx, scan); err != nil {
+			return fmt.Errorf("save: %w", err)
+		}
+	}
+	to := time.Now().Add(time.Second)
+
+	usage, err := s.GetDailyUsage(ctx, from, to)
+	if err != nil {
+		return fmt.Errorf("daily usage: %w", err)
+	}
+	var agg *model.UsageAggregate
+	for i := range usage {
+		if usage[i].Model == modelName {
+			agg = &usage[i]
+		}
+	}
+	if agg == nil {
+		return fmt.Errorf("daily usage: no row for %s", modelName)
+	}
+	if agg.Calls != 6 || agg.Scans != 3 || agg.InputTokens != 450 || agg.OutputTokens != 30 || agg.ThinkingTokens != 15 || agg.Units != 3 || !near(agg.CostUSD, 0.09) {
+		return fmt.Errorf("daily usage: got %+v", *agg)
+	}
+	if since := time.Since(agg.Day); since < 0 || since > 48*time.Hour {
+		return fmt.Errorf("daily usage: day %v is not today", agg.Day)
+	}
+
+	prompts, err := s.GetPromptStats(ctx, from, to)
+	if err != nil {
+		return fmt.Errorf("prompt stats: %w", err)
+	}
+	i := slices.IndexFunc(prompts, func(p model.PromptStats) bool { return p.PromptVersion == version })
+	if i < 0 {
+		return fmt.Errorf("prompt stats: no row for %s", version)
+	}
+	ps := prompts[i]
+	if ps.Scans != 3 || ps.Confirmed != 1 || ps.NeedsConfirmation != 1 || ps.Rejected != 1 || !near(ps.AvgConfidence, 0.5) || !near(ps.AvgNumbers, 3) {
+		return fmt.Errorf("prompt stats: got %+v", ps)
+	}
+
+	cards, err := s.GetSuspiciousCards(ctx, from, to)
+	if err != nil {
+		return fmt.Errorf("suspicious cards: %w", err)
+	}
+	i = slices.IndexFunc(cards, func(c model.SuspiciousCard) bool { return c.Key == fp })
+	if i < 0 {
+		return fmt.Errorf("suspicious cards: %s shared by a user and an anonymous scan is not flagged", fp)
+	}
+	if c := cards[i]; c.Reason != model.DuplicateLayout || c.Registrants != 2 || c.Layouts != 1 || len(c.Scans) != 2 ||
+		c.Scans[0].ScanID != scans[0].ID || c.Scans[1].ScanID != scans[1].ID {
+		return fmt.Errorf("suspicious cards: got %+v", c)
+	}
+
+	later, err := s.GetSuspiciousCards(ctx, to.Add(time.Hour), to.Add(2*time.Hour))
+	if err != nil {
+		return fmt.Errorf("suspicious cards: %w", err)
+	}
+	if slices.ContainsFunc(later, func(c model.SuspiciousCard) bool { return c.Key == fp }) {
+		return fmt.Errorf("suspicious cards: %s flagged outside its window", fp)
+	}
+	return nil
+}
+
+func near(a, b float64) bool {
+	d := a - b
+	return d < 1e-9 && d > -1e-9
+}
+
+func checkBatches(ctx context.Context, s repository.Store) error {
+	u, err := newUser(ctx, s)
+	if err != nil {
+		return err
+	}
+	batch := &model.BatchResponse{
+		BatchID:   uuid.NewString(),
+		UserID:    &u.ID,
+		Status:    model.BatchRunning,
+		Summary:   model.BatchSummary{Total: 2, Pending: 1, Running: 1},
+		Items:     []model.BatchItem{{Index: 0, Filename: "a.jpg", Status: model.BatchRunning}, {Index: 1, Filename: "b.jpg", Status: model.BatchPending}},
+		CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+	}
+	if err := s.SaveBatch(ctx, batch); err != nil {
+		return fmt.Errorf("save: %w", err)
+	}
+
+	batch.Status = model.BatchCompleted
+	batch.Summary = model.BatchSummary{Total: 2, Done: 1, Failed: 1}
+	batch.Items[0].Status, batch.Items[1].Status, batch.Items[1].Error = model.BatchDone, model.BatchFailed, "unreadable"
+	batch.CompletedAt = ptr(time.Now().UTC().Truncate(time.Microsecond))
+	if err := s.SaveBatch(ctx, batch); err != nil {
+		return fmt.Errorf("update: %w", err)
+	}
+
+	got, err := s.GetBatch(ctx, batch.BatchID)
+	if err != nil {
+		return fmt.Errorf("get: %w", err)
+	}
+	if got.CompletedAt == nil || !sameTime(*got.CompletedAt, *batch.CompletedAt) || !sameTime(got.CreatedAt, batch.CreatedAt) {
+		return fmt.Errorf("get: times %v, %v, want %v, %v", got.CreatedAt, got.CompletedAt, batch.CreatedAt, batch.CompletedAt)
+	}
+	want := *batch
+	want.CreatedAt, want.CompletedAt = got.CreatedAt, got.CompletedAt
+	if !reflect.DeepEqual(*got, want) {
+		return fmt.Errorf("get: got %+v, want %+v", *got, want)
+	}
+
+	_, err = s.GetBatch(ctx, uuid.NewString())
+	return expectErr("missing batch", err, repository.ErrNotFound)
+}
+
+func checkAPIKeys(ctx context.Context, s repository.Store) error {
+	u, err := newUser(ctx, s)
+	if err != nil {
+		return err
+	}
+	hash := unique("hash")
+	key := &model.APIKey{UserID: u.ID, Name: "partner", Prefix: "lk_test", Scopes: []string{"scans:write", "results:read"}}
+	if err := s.CreateAPIKey(ctx, key, hash); err != nil {
+		return fmt.Errorf("create: %w", err)
+	}
+	if key.ID == "" || key.CreatedAt.IsZero() {
+		return fmt.Errorf("create did not fill ID and CreatedAt")
+	}
+
+	got, err := s.GetActiveAPIKey(ctx, hash)
+	if err != nil {
+		return fmt.Errorf("get active: %w", err)
+	}
+	if got.ID != key.ID || !slices.Equal(got.Scopes, key.Scopes) || !sameTime(got.CreatedAt, key.CreatedAt) || got.ExpiresAt != nil {
+		return fmt.Errorf("get active: got %+v, want %+v", got, key)
+	}
+	keys, err := s.ListAPIKeys(ctx)
+	if err != nil {
+		return fmt.Errorf("list: %w", err)
+	}
+	if !slices.ContainsFunc(keys, func(k model.APIKey) bool { return k.ID == key.ID }) {
+		return fmt.Errorf("list: %s missing", key.ID)
+	}
+
+	for _, failed := range []bool{false, false, true} {
+		if err := s.RecordAPIKeyUse(ctx, key.ID, failed); err != nil {
+			return fmt.Errorf("record use: %w", err)
+		}
+	}
+	scan := &model.Scan{UserID: &u.ID, APIKeyID: &key.ID, ImageURL: "x", Status: "confirmed", CardIndex: 1, CostUSD: 0.5}
+	if err := s.SaveScan(ctx, scan); err != nil {
+		return fmt.Errorf("save scan: %w", err)
+	}
+	day := time.Now().UTC().Truncate(24 * time.Hour)
+	usage, err := s.GetAPIKeyUsage(ctx, key.ID, day.Add(-24*time.Hour), day.Add(48*time.Hour))
+	if err != nil {
+		return fmt.Errorf("usage: %w", err)
+	}
+	var requests, errs, scans int64
+	var cost float64
+	for _, day := range usage {
+		requests, errs, scans, cost = requests+day.Requests, errs+day.Errors, scans+day.Scans, cost+day.CostUSD
+	}
+	if requests != 3 || errs != 1 || scans != 1 || !near(cost, 0.5) {
+		return fmt.Errorf("usage: got %+v", usage)
+	}
+	if got, err = s.GetAPIKey(ctx, key.ID); err != nil {
+		return fmt.Errorf("get: %w", err)
+	}
+	if got.LastUsedAt == nil {
+		return fmt.Errorf("get: last_used_at not set after use")
+	}
+
+	nextHash := unique("hash")
+	next := &model.APIKey{UserID: u.ID, Name: "partner", Prefix: "lk_next", Scopes: key.Scopes}
+	if err := s.RotateAPIKey(ctx, key.ID, next, nextHash, time.Hour); err != nil {
+		return fmt.Errorf("rotate: %w", err)
+	}
+	if next.RotatedFrom == nil || *next.RotatedFrom != key.ID {
+		return fmt.Errorf("rotate: rotated_from %v, want %s", next.RotatedFrom, key.ID)
+	}
+	if got, err = s.GetActiveAPIKey(ctx, hash); err != nil {
+		return fmt.Errorf("old key during grace: %w", err)
+	}
+	if got.ExpiresAt == nil || time.Until(*got.ExpiresAt) > time.Hour {
+		return fmt.Errorf("old key during grace: expires_at %v", got.ExpiresAt)
+	}
+	if _, err := s.GetActiveAPIKey(ctx, nextHash); err != nil {
+		return fmt.Errorf("new key: %w", err)
+	}
+
+	// Rotating again with no grace expires the old key now.
+	last := &model.APIKey{UserID: u.ID, Name: "partner", Prefix: "lk_last", Scopes: key.Scopes}
+	if err := s.RotateAPIKey(ctx, next.ID, last, unique("hash"), 0); err != nil {
+		return fmt.Errorf("rotate without grace: %w", err)
+	}
+	if _, err := s.GetActiveAPIKey(ctx, nextHash); !errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("key rotated without grace: got error %v, want %v", err, repository.ErrNotFound)
+	}
+	if err := expectErr("rotate an expired key", s.RotateAPIKey(ctx, next.ID, &model.APIKey{UserID: u.ID, Name: "x", Prefix: "x"}, unique("hash"), 0), repository.ErrNotFound); err != nil {
+		return err
+	}
+
+	if err := s.RevokeAPIKey(ctx, key.ID); err != nil {
+		return fmt.Errorf("revoke: %w", err)
+	}
+	if _, err := s.GetActiveAPIKey(ctx, hash); !errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("revoked key: got error %v, want %v", err, repository.ErrNotFound)
+	}
+	if err := expectErr("revoke twice", s.RevokeAPIKey(ctx, key.ID), repository.ErrNotFound); err != nil {
+		return err
+	}
+	if got, err = s.GetAPIKey(ctx, key.ID); err != nil || got.RevokedAt == nil {
+		return fmt.Errorf("get revoked: got %+v, %v", got, err)
+	}
+	return nil
+}
+
+func checkLotteryResults(ctx context.Context, s repository.Store) error {
+	// Pick numbers no real draw has, to not match existing results.
+	n := 100000000 + int(time.Now().UnixNano()%100000000)
+	number := fmt.Sprintf("%d", n)
+	date := time.Now().UTC().Truncate(24 * time.Hour)
+	results := []model.LotteryResult{
+		{Date: date, Region: "north", PrizeType: "special", WinningNumber: number},
+		{Date: date, Region: "south", PrizeType: "first", WinningNumber: number},
+	}
+	if err := s.SaveLotteryResults(ctx, results); err != nil {
+		return fmt.Errorf("save: %w", err)
+	}
+	if results[0].ID == "" || results[0].ID == results[1].ID {
+		return fmt.Errorf("save did not assign IDs")
+	}
+
+	got, err := s.FindMatchingResults(ctx, []int{n, n + 1})
+	if err != nil {
+		return fmt.Errorf("find: %w", err)
+	}
+	if len(got) != 2 {
+		return fmt.Errorf("find: got %d results, want 2", len(got))
+	}
+	for _, r := range got {
+		if r.WinningNumber != number || !r.Date.Equal(date) {
+			return fmt.Errorf("find: got %+v", r)
+		}
+	}
+	if got, err = s.FindMatchingResults(ctx, nil); err != nil || len(got) != 0 {
+		return fmt.Errorf("find nothing: got %v, %v", got, err)
+	}
+	return nil
+}
@@ -0,0 +1,766 @@
+// Package memory is a repository.Store that keeps everything in process
+// memory. It needs no setup, which suits tests and trying the server out;
+// all data is lost when the process exits.
+package memory
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"loto/internal/model"
+	"loto/internal/repository"
+)
+
+type refreshToken struct {
+	userID    string
+	expiresAt time.Time
+	revokedAt *time.Time
+}
+
+type apiKey struct {
+	model.APIKey
+	hash string
+}
+
+type usageRecord struct {
+	scanID *string
+	model.Usage
+	createdAt time.Time
+}
+
+type keyDay struct {
+	keyID string
+	day   time.Time
+}
+
+type keyUsage struct {
+	requests, errors int64
+}
+
+// Store is safe for concurrent use. Records are copied on the way in and
+// out, so callers never share them.
+type Store struct {
+	mu        sync.RWMutex
+	scans     []*model.Scan
+	usage     []usageRecord
+	results   []model.LotteryResult
+	batches   map[string]*model.BatchResponse
+	users     map[string]*model.User
+	tokens    map[string]*refreshToken
+	keys      []*apiKey
+	keyUsage  map[keyDay]*keyUsage
+	keyLookup map[string]*apiKey
+}
+
+var _ repository.Store = (*Store)(nil)
+
+func New() *Store {
+	return &Store{
+		batches:   make(map[string]*model.BatchResponse),
+		users:     make(map[string]*model.User),
+		tokens:    make(map[string]*refreshToken),
+		keyUsage:  make(map[keyDay]*keyUsage),
+		keyLookup: make(map[string]*apiKey),
+	}
+}
+
+// now matches the microsecond precision of Postgres timestamps, which
+// history cursors rely on.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+func day(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// clonePtr copies the value p points to, so stored records do not alias the
+// caller's.
+func clonePtr[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	return ptr(*p)
+}
+
+func cloneScan(s *model.Scan) *model.Scan {
+	c := *s
+	c.UserID = clonePtr(s.UserID)
+	c.UploadID = clonePtr(s.UploadID)
+	c.Fingerprint = clonePtr(s.Fingerprint)
+	c.TicketID = clonePtr(s.TicketID)
+	c.APIKeyID = clonePtr(s.APIKeyID)
+	c.Blocks = cloneBlocks(s.Blocks)
+	c.ExtractedNumbers = slices.Clone(s.ExtractedNumbers)
+	c.Preprocessing = slices.Clone(s.Preprocessing)
+	c.OCRTokens = slices.Clone(s.OCRTokens)
+	c.Usage = nil
+	return &c
+}
+
+func cloneBlocks(blocks []model.Block) []model.Block {
+	out := make([]model.Block, len(blocks))
+	for i, b := range blocks {
+		out[i] = model.Block{Row1: slices.Clone(b.Row1), Row2: slices.Clone(b.Row2), Row3: slices.Clone(b.Row3)}
+	}
+	return out
+}
+
+func (s *Store) SaveScan(ctx context.Context, scan *model.Scan) error {
+	if scan.ID == "" {
+		scan.ID = uuid.NewString()
+	}
+	if scan.CreatedAt.IsZero() {
+		scan.CreatedAt = now()
+	}
+
+	stored := cloneScan(scan)
+	if stored.ExtractedNumbers == nil {
+		stored.ExtractedNumbers = []int{}
+	}
+	if stored.Preprocessing == nil {
+		stored.Preprocessing = []string{}
+	}
+	if stored.OCRTokens == nil {
+		stored.OCRTokens = []model.OCRToken{}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if slices.ContainsFunc(s.scans, func(sc *model.Scan) bool { return sc.ID == scan.ID }) {
+		return repository.ErrConflict
+	}
+	s.scans = append(s.scans, stored)
+	for _, u := range scan.Usage {
+		s.usage = append(s.usage, usageRecord{scanID: ptr(scan.ID), Usage: u, createdAt: scan.CreatedAt})
+	}
+	return nil
+}
+
+func (s *Store) GetScanByID(ctx context.Context, scanID string) (*model.Scan, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, sc := range s.scans {
+		if sc.ID == scanID {
+			return cloneScan(sc), nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (s *Store) GetScansByUserID(ctx context.Context, userID string, f repository.ScanFilter) ([]model.ScanHistoryItem, error) {
+	s.mu.RLock()
+	var matched []*model.Scan
+	for _, sc := range s.scans {
+		switch {
+		case sc.UserID == nil || *sc.UserID != userID:
+		case !f.From.IsZero() && sc.CreatedAt.Before(f.From):
+		case !f.To.IsZero() && !sc.CreatedAt.Before(f.To):
+		case f.Status != "" && sc.Status != f.Status:
+		case f.LotteryType != "" && sc.LotteryType != f.LotteryType:
+		case f.MinConfidence != nil && sc.Confidence < *f.MinConfidence:
+		case f.AfterID != "" && !before(sc, f.AfterTime, f.AfterID):
+		default:
+			matched = append(matched, cloneScan(sc))
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(matched, func(i, j int) bool { return before(matched[j], matched[i].CreatedAt, matched[i].ID) })
+	if f.Limit > 0 && len(matched) > f.Limit {
+		matched = matched[:f.Limit]
+	}
+
+	var items []model.ScanHistoryItem
+	for _, sc := range matched {
+		items = append(items, model.ScanHistoryItem{
+			ID:               sc.ID,
+			LotteryType:      sc.LotteryType,
+			TicketID:         sc.TicketID,
+			Blocks:           sc.Blocks,
+			ExtractedNumbers: sc.ExtractedNumbers,
+			Confidence:       sc.Confidence,
+			Status:           sc.Status,
+			CreatedAt:        sc.CreatedAt,
+		})
+	}
+	return items, nil
+}
+
+// before orders scans as (created_at, id) < (t, id) does in SQL.
+func before(sc *model.Scan, t time.Time, id string) bool {
+	if !sc.CreatedAt.Equal(t) {
+		return sc.CreatedAt.Before(t)
+	}
+	return sc.ID < id
+}
+
+func (s *Store) FindDuplicates(ctx context.Context, scan *model.Scan) ([]string, error) {
+	if scan.Fingerprint == nil && scan.TicketID == nil {
+		return nil, nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var layout, ticket bool
+	for _, sc := range s.scans {
+		if sc.ID == scan.ID || sc.Status == "rejected" {
+			continue
+		}
+		other := !sameUser(sc.UserID, scan.UserID)
+		relaid := sc.Fingerprint != nil && scan.Fingerprint != nil && *sc.Fingerprint != *scan.Fingerprint
+		layout = layout || other && equalPtr(sc.Fingerprint, scan.Fingerprint)
+		ticket = ticket || (other || relaid) && equalPtr(sc.TicketID, scan.TicketID)
+	}
+
+	var reasons []string
+	if layout {
+		reasons = append(reasons, model.DuplicateLayout)
+	}
+	if ticket {
+		reasons = append(reasons, model.DuplicateTicketID)
+	}
+	return reasons, nil
+}
+
+// sameUser is NOT (a IS DISTINCT FROM b): two anonymous scans count as the
+// same registrant.
+func sameUser(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// equalPtr is a = b in SQL: false when either is NULL.
+func equalPtr(a, b *string) bool {
+	return a != nil && b != nil && *a == *b
+}
+
+func (s *Store) FindMatchingResults(ctx context.Context, numbers []int) ([]model.LotteryResult, error) {
+	wanted := make(map[string]bool, len(numbers))
+	for _, n := range numbers {
+		wanted[strconv.Itoa(n)] = true
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var results []model.LotteryResult
+	for _, lr := range s.results {
+		if wanted[lr.WinningNumber] {
+			results = append(results, lr)
+		}
+	}
+	return results, nil
+}
+
+func (s *Store) SaveLotteryResults(ctx context.Context, results []model.LotteryResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range results {
+		results[i].ID = uuid.NewString()
+		s.results = append(s.results, results[i])
+	}
+	return nil
+}
+
+func cloneBatch(b *model.BatchResponse) *model.BatchResponse {
+	c := *b
+	c.UserID = clonePtr(b.UserID)
+	c.CompletedAt = clonePtr(b.CompletedAt)
+	c.Items = slices.Clone(b.Items)
+	return &c
+}
+
+func (s *Store) SaveBatch(ctx context.Context, batch *model.BatchResponse) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := cloneBatch(batch)
+	if old, ok := s.batches[batch.BatchID]; ok {
+		// As ON CONFLICT DO UPDATE: the owner and creation time stay.
+		stored.UserID, stored.CreatedAt = old.UserID, old.CreatedAt
+	}
+	s.batches[batch.BatchID] = stored
+	return nil
+}
+
+func (s *Store) GetBatch(ctx context.Context, batchID string) (*model.BatchResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	b, ok := s.batches[batchID]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	return cloneBatch(b), nil
+}
+
+func (s *Store) GetDailyUsage(ctx context.Context, from, to time.Time) ([]model.UsageAggregate, error) {
+	type groupKey struct {
+		day             time.Time
+		provider, model string
+	}
+
+	s.mu.RLock()
+	groups := make(map[groupKey]*model.UsageAggregate)
+	scans := make(map[groupKey]map[string]bool)
+	for _, u := range s.usage {
+		if u.createdAt.Before(from) || !u.createdAt.Before(to) {
+			continue
+		}
+		k := groupKey{day(u.createdAt), u.Provider, u.Model}
+		a := groups[k]
+		if a == nil {
+			a = &model.UsageAggregate{Day: k.day, Provider: k.provider, Model: k.model}
+			groups[k] = a
+			scans[k] = make(map[string]bool)
+		}
+		a.Calls++
+		if u.scanID != nil {
+			scans[k][*u.scanID] = true
+		}
+		a.InputTokens += u.InputTokens
+		a.OutputTokens += u.OutputTokens
+		a.ThinkingTokens += u.ThinkingTokens
+		a.Units += u.Units
+		a.CostUSD += u.CostUSD
+	}
+	s.mu.RUnlock()
+
+	var items []model.UsageAggregate
+	for k, a := range groups {
+		a.Scans = int64(len(scans[k]))
+		items = append(items, *a)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		if !a.Day.Equal(b.Day) {
+			return a.Day.After(b.Day)
+		}
+		if a.Provider != b.Provider {
+			return a.Provider < b.Provider
+		}
+		return a.Model < b.Model
+	})
+	return items, nil
+}
+
+func (s *Store) GetPromptStats(ctx context.Context, from, to time.Time) ([]model.PromptStats, error) {
+	type sums struct {
+		confidence float64
+		numbers    int
+		accepted   int
+	}
+
+	s.mu.RLock()
+	stats := make(map[string]*model.PromptStats)
+	totals := make(map[string]*sums)
+	for _, sc := range s.scans {
+		if sc.CreatedAt.Before(from) || !sc.CreatedAt.Before(to) {
+			continue
+		}
+		ps := stats[sc.PromptVersion]
+		if ps == nil {
+			ps = &model.PromptStats{PromptVersion: sc.PromptVersion}
+			stats[sc.PromptVersion] = ps
+			totals[sc.PromptVersion] = &sums{}
+		}
+		t := totals[sc.PromptVersion]
+		ps.Scans++
+		t.confidence += sc.Confidence
+		switch sc.Status {
+		case "confirmed":
+			ps.Confirmed++
+		case "needs_confirmation":
+			ps.NeedsConfirmation++
+		case "rejected":
+			ps.Rejected++
+		}
+		if sc.Status != "rejected" {
+			t.accepted++
+			t.numbers += len(sc.ExtractedNumbers)
+		}
+	}
+	s.mu.RUnlock()
+
+	var items []model.PromptStats
+	for v, ps := range stats {
+		t := totals[v]
+		ps.AvgConfidence = t.confidence / float64(ps.Scans)
+		if t.accepted > 0 {
+			ps.AvgNumbers = float64(t.numbers) / float64(t.accepted)
+		}
+		items = append(items, *ps)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].PromptVersion < items[j].PromptVersion })
+	return items, nil
+}
+
+func (s *Store) GetSuspiciousCards(ctx context.Context, from, to time.Time) ([]model.SuspiciousCard, error) {
+	type groupKey struct{ reason, key string }
+
+	s.mu.RLock()
+	groups := make(map[groupKey][]*model.Scan)
+	var order []groupKey
+	add := func(k groupKey, sc *model.Scan) {
+		if _, ok := groups[k]; !ok {
+			order = append(order, k)
+		}
+		groups[k] = append(groups[k], sc)
+	}
+	for _, sc := range s.scans {
+		if sc.Fingerprint != nil {
+			add(groupKey{model.DuplicateLayout, *sc.Fingerprint}, cloneScan(sc))
+		}
+		if sc.TicketID != nil && sc.Status != "rejected" {
+			add(groupKey{model.DuplicateTicketID, *sc.TicketID}, cloneScan(sc))
+		}
+	}
+	s.mu.RUnlock()
+
+	var items []model.SuspiciousCard
+	for _, k := range order {
+		scans := groups[k]
+		users := make(map[string]bool)
+		layouts := make(map[string]bool)
+		for _, sc := range scans {
+			user := "anonymous"
+			if sc.UserID != nil {
+				user = "user:" + *sc.UserID
+			}
+			users[user] = true
+			if sc.Fingerprint != nil {
+				layouts[*sc.Fingerprint] = true
+			}
+		}
+		// HAVING MAX(created_at) >= from AND MIN(created_at) < to.
+		var first, last time.Time
+		for i, sc := range scans {
+			if i == 0 || sc.CreatedAt.Before(first) {
+				first = sc.CreatedAt
+			}
+			if i == 0 || sc.CreatedAt.After(last) {
+				last = sc.CreatedAt
+			}
+		}
+		inRange := !last.Before(from) && first.Before(to)
+		if !inRange || !(len(users) > 1 || (k.reason == model.DuplicateTicketID && len(layouts) > 1)) {
+			continue
+		}
+
+		sort.SliceStable(scans, func(i, j int) bool { return scans[i].CreatedAt.Before(scans[j].CreatedAt) })
+		card := model.SuspiciousCard{Reason: k.reason, Key: k.key, Registrants: len(users), Layouts: len(layouts)}
+		for _, sc := range scans {
+			card.Scans = append(card.Scans, model.SuspiciousScan{
+				ScanID:      sc.ID,
+				UserID:      sc.UserID,
+				TicketID:    sc.TicketID,
+				Fingerprint: sc.Fingerprint,
+				Status:      sc.Status,
+				CreatedAt:   sc.CreatedAt,
+			})
+		}
+		items = append(items, card)
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		if a.Registrants != b.Registrants {
+			return a.Registrants > b.Registrants
+		}
+		if a.Reason != b.Reason {
+			return a.Reason < b.Reason
+		}
+		return a.Key < b.Key
+	})
+	return items, nil
+}
+
+func cloneUser(u *model.User) *model.User {
+	c := *u
+	c.Email = clonePtr(u.Email)
+	c.PasswordHash = clonePtr(u.PasswordHash)
+	c.DeviceID = clonePtr(u.DeviceID)
+	return &c
+}
+
+// CreateUser stores emails lower case; emails and device IDs are unique.
+func (s *Store) CreateUser(ctx context.Context, user *model.User) error {
+	if user.Email != nil {
+		email := strings.ToLower(*user.Email)
+		user.Email = &email
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if equalPtr(u.Email, user.Email) || equalPtr(u.DeviceID, user.DeviceID) {
+			return repository.ErrConflict
+		}
+	}
+	user.ID = uuid.NewString()
+	user.CreatedAt = now()
+	user.Anonymous = user.Email == nil
+	s.users[user.ID] = cloneUser(user)
+	return nil
+}
+
+func (s *Store) findUser(match func(*model.User) bool) (*model.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, u := range s.users {
+		if match(u) {
+			return cloneUser(u), nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (s *Store) GetUserByID(ctx context.Context, userID string) (*model.User, error) {
+	return s.findUser(func(u *model.User) bool { return u.ID == userID })
+}
+
+func (s *Store) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	email = strings.ToLower(email)
+	return s.findUser(func(u *model.User) bool { return u.Email != nil && *u.Email == email })
+}
+
+func (s *Store) GetUserByDeviceID(ctx context.Context, deviceID string) (*model.User, error) {
+	return s.findUser(func(u *model.User) bool { return u.DeviceID != nil && *u.DeviceID == deviceID })
+}
+
+func (s *Store) UpgradeUser(ctx context.Context, userID, email, passwordHash string) (*model.User, error) {
+	email = strings.ToLower(email)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userID]
+	if !ok || u.Email != nil {
+		return nil, repository.ErrNotFound
+	}
+	for _, other := range s.users {
+		if other.Email != nil && *other.Email == email {
+			return nil, repository.ErrConflict
+		}
+	}
+	u.Email = &email
+	u.PasswordHash = &passwordHash
+	u.DeviceID = nil
+	u.Anonymous = false
+	return cloneUser(u), nil
+}
+
+func (s *Store) SaveRefreshToken(ctx context.Context, userID, tokenHash string, expires time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[userID]; !ok {
+		return repository.ErrNotFound
+	}
+	if _, ok := s.tokens[tokenHash]; ok {
+		return repository.ErrConflict
+	}
+	s.tokens[tokenHash] = &refreshToken{userID: userID, expiresAt: expires}
+	return nil
+}
+
+func (s *Store) UseRefreshToken(ctx context.Context, tokenHash string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tokens[tokenHash]
+	if !ok {
+		return "", repository.ErrNotFound
+	}
+	at := now()
+	if t.revokedAt == nil && t.expiresAt.After(at) {
+		t.revokedAt = &at
+		return t.userID, nil
+	}
+	if t.revokedAt != nil {
+		// Reuse of a spent token: end every session of its user.
+		for _, other := range s.tokens {
+			if other.userID == t.userID && other.revokedAt == nil {
+				other.revokedAt = &at
+			}
+		}
+	}
+	return "", repository.ErrNotFound
+}
+
+func (s *Store) RevokeRefreshToken(ctx context.Context, tokenHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.tokens[tokenHash]; ok && t.revokedAt == nil {
+		t.revokedAt = ptr(now())
+	}
+	return nil
+}
+
+func cloneAPIKey(k *model.APIKey) *model.APIKey {
+	c := *k
+	c.Scopes = slices.Clone(k.Scopes)
+	c.RotatedFrom = clonePtr(k.RotatedFrom)
+	c.LastUsedAt = clonePtr(k.LastUsedAt)
+	c.ExpiresAt = clonePtr(k.ExpiresAt)
+	c.RevokedAt = clonePtr(k.RevokedAt)
+	return &c
+}
+
+func active(k *apiKey, at time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || k.ExpiresAt.After(at))
+}
+
+func (s *Store) CreateAPIKey(ctx context.Context, key *model.APIKey, keyHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.createAPIKey(key, keyHash)
+}
+
+// createAPIKey stores a key. Callers hold s.mu.
+func (s *Store) createAPIKey(key *model.APIKey, keyHash string) error {
+	if _, ok := s.users[key.UserID]; !ok {
+		return repository.ErrNotFound
+	}
+	if _, ok := s.keyLookup[keyHash]; ok {
+		return repository.ErrConflict
+	}
+	key.ID = uuid.NewString()
+	key.CreatedAt = now()
+	stored := &apiKey{APIKey: *cloneAPIKey(key), hash: keyHash}
+	s.keys = append(s.keys, stored)
+	s.keyLookup[keyHash] = stored
+	return nil
+}
+
+func (s *Store) ListAPIKeys(ctx context.Context) ([]model.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var keys []model.APIKey
+	for i := len(s.keys) - 1; i >= 0; i-- {
+		keys = append(keys, *cloneAPIKey(&s.keys[i].APIKey))
+	}
+	return keys, nil
+}
+
+func (s *Store) getKey(keyID string) *apiKey {
+	for _, k := range s.keys {
+		if k.ID == keyID {
+			return k
+		}
+	}
+	return nil
+}
+
+func (s *Store) GetAPIKey(ctx context.Context, keyID string) (*model.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if k := s.getKey(keyID); k != nil {
+		return cloneAPIKey(&k.APIKey), nil
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (s *Store) GetActiveAPIKey(ctx context.Context, keyHash string) (*model.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if k, ok := s.keyLookup[keyHash]; ok && active(k, now()) {
+		return cloneAPIKey(&k.APIKey), nil
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (s *Store) RotateAPIKey(ctx context.Context, oldID string, next *model.APIKey, keyHash string, grace time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	at := now()
+	old := s.getKey(oldID)
+	if old == nil || !active(old, at) {
+		return repository.ErrNotFound
+	}
+	if _, ok := s.keyLookup[keyHash]; ok {
+		return repository.ErrConflict
+	}
+
+	next.RotatedFrom = &oldID
+	if err := s.createAPIKey(next, keyHash); err != nil {
+		return err
+	}
+	if expires := at.Add(grace); old.ExpiresAt == nil || expires.Before(*old.ExpiresAt) {
+		old.ExpiresAt = &expires
+	}
+	return nil
+}
+
+func (s *Store) RevokeAPIKey(ctx context.Context, keyID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := s.getKey(keyID)
+	if k == nil || k.RevokedAt != nil {
+		return repository.ErrNotFound
+	}
+	k.RevokedAt = ptr(now())
+	return nil
+}
+
+func (s *Store) RecordAPIKeyUse(ctx context.Context, keyID string, failed bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	at := now()
+	if k := s.getKey(keyID); k != nil {
+		k.LastUsedAt = &at
+	}
+	kd := keyDay{keyID, day(at)}
+	u := s.keyUsage[kd]
+	if u == nil {
+		u = &keyUsage{}
+		s.keyUsage[kd] = u
+	}
+	u.requests++
+	if failed {
+		u.errors++
+	}
+	return nil
+}
+
+func (s *Store) GetAPIKeyUsage(ctx context.Context, keyID string, from, to time.Time) ([]model.APIKeyUsage, error) {
+	s.mu.RLock()
+	days := make(map[time.Time]*model.APIKeyUsage)
+	get := func(d time.Time) *model.APIKeyUsage {
+		u := days[d]
+		if u == nil {
+			u = &model.APIKeyUsage{Day: d}
+			days[d] = u
+		}
+		return u
+	}
+	for kd, ku := range s.keyUsage {
+		if kd.keyID == keyID && !kd.day.Before(day(from)) && kd.day.Before(day(to)) {
+			u := get(kd.day)
+			u.Requests, u.Errors = ku.requests, ku.errors
+		}
+	}
+	for _, sc := range s.scans {
+		if sc.APIKeyID == nil || *sc.APIKeyID != keyID || sc.CreatedAt.Before(from) || !sc.CreatedAt.Before(to) {
+			continue
+		}
+		u := get(day(sc.CreatedAt))
+		u.Scans++
+		u.CostUSD += sc.CostUSD
+	}
+	s.mu.RUnlock()
+
+	var items []model.APIKeyUsage
+	for _, u := range days {
+		items = append(items, *u)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Day.After(items[j].Day) })
+	return items, nil
+}
@@ -0,0 +1,15 @@
+package memory_test
+
+import (
+	"context"
+	"testing"
+
+	"loto/internal/repository/conformance"
+	"loto/internal/repository/memory"
+)
+
+func TestConformance(t *testing.T) {
+	if err := conformance.Run(context.Background(), memory.New()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,218 @@
+package reconnect
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"loto/internal/model"
+)
+
+// ErrOutboxFull is returned when the outbox holds its maximum of scans.
+var ErrOutboxFull = errors.New("outbox full")
+
+// Outbox holds the scans saved while the database is down until they are
+// written to it.
+type Outbox interface {
+	Add(scan *model.Scan) error
+	// Pending returns the queued scans, oldest first.
+	Pending() ([]*model.Scan, error)
+	Remove(scanID string) error
+	Len() int
+}
+
+// MemoryOutbox keeps queued scans in memory; they are lost on restart.
+type MemoryOutbox struct {
+	mu    sync.Mutex
+	scans []*model.Scan
+	max   int
+}
+
+func NewMemoryOutbox(max int) *MemoryOutbox {
+	return &MemoryOutbox{max: max}
+}
+
+func (o *MemoryOutbox) Add(scan *model.Scan) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.max > 0 && len(o.scans) >= o.max {
+		return ErrOutboxFull
+	}
+	queued := *scan
+	o.scans = append(o.scans, &queued)
+	return nil
+}
+
+func (o *MemoryOutbox) Pending() ([]*model.Scan, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return slices.Clone(o.scans), nil
+}
+
+func (o *MemoryOutbox) Remove(scanID string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.scans = slices.DeleteFunc(o.scans, func(sc *model.Scan) bool { return sc.ID == scanID })
+	return nil
+}
+
+func (o *MemoryOutbox) Len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.scans)
+}
+
+// DirOutbox keeps each queued scan in a JSON file in a directory, so they
+// survive a restart. Files are named by creation time, which orders them.
+// Files that cannot be read back are renamed with a .bad suffix and skipped,
+// so one damaged file does not hold up the rest.
+type DirOutbox struct {
+	dir    string
+	max    int
+	logger *zap.Logger
+
+	mu    sync.Mutex
+	count int
+}
+
+// queuedScan also keeps the fields of a scan that are not served, and so
+// not in its JSON.
+type queuedScan struct {
+	*model.Scan
+	OCRTokens   []model.OCRToken `json:"ocr_tokens"`
+	RawResponse string           `json:"raw_response"`
+}
+
+// NewDirOutbox opens the outbox in dir, creating it if needed. Scans left
+// from a previous run are pending.
+func NewDirOutbox(dir string, max int, logger *zap.Logger) (*DirOutbox, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	// Drop the partial writes of a crash.
+	partial, err := filepath.Glob(filepath.Join(dir, "*.json.tmp"))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range partial {
+		os.Remove(name)
+	}
+	o := &DirOutbox{dir: dir, max: max, logger: logger}
+	names, err := o.files()
+	if err != nil {
+		return nil, err
+	}
+	o.count = len(names)
+	return o, nil
+}
+
+func (o *DirOutbox) files() ([]string, error) {
+	entries, err := os.ReadDir(o.dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".json") {
+			names = append(names, e.Name())
+		}
+	}
+	return names, nil
+}
+
+func (o *DirOutbox) Add(scan *model.Scan) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.max > 0 && o.count >= o.max {
+		return ErrOutboxFull
+	}
+
+	data, err := json.Marshal(queuedScan{Scan: scan, OCRTokens: scan.OCRTokens, RawResponse: scan.RawResponse})
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file first, so that a crash never leaves half a
+	// scan to be flushed.
+	name := fmt.Sprintf("%020d_%s.json", scan.CreatedAt.UnixNano(), scan.ID)
+	tmp := filepath.Join(o.dir, name+".tmp")
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(o.dir, name)); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	o.count++
+	return nil
+}
+
+func (o *DirOutbox) Pending() ([]*model.Scan, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	names, err := o.files()
+	if err != nil {
+		return nil, err
+	}
+
+	scans := make([]*model.Scan, 0, len(names))
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(o.dir, name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		var q queuedScan
+		if err == nil {
+			if err = json.Unmarshal(data, &q); err == nil && q.Scan == nil {
+				err = errors.New("no scan")
+			}
+		}
+		if err != nil {
+			o.setAside(name, err)
+			continue
+		}
+		q.Scan.OCRTokens, q.Scan.RawResponse = q.OCRTokens, q.RawResponse
+		scans = append(scans, q.Scan)
+	}
+	return scans, nil
+}
+
+// setAside renames a queued scan that cannot be read to name.bad, where it is
+// no longer pending but is kept for inspection.
+func (o *DirOutbox) setAside(name string, cause error) {
+	path := filepath.Join(o.dir, name)
+	if err := os.Rename(path, path+".bad"); err != nil {
+		o.logger.Error("failed to set aside unreadable queued scan", zap.String("file", path), zap.NamedError("cause", cause), zap.Error(err))
+		return
+	}
+	o.count--
+	o.logger.Error("unreadable queued scan set aside", zap.String("file", path+".bad"), zap.Error(cause))
+}
+
+func (o *DirOutbox) Remove(scanID string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	names, err := filepath.Glob(filepath.Join(o.dir, "*_"+scanID+".json"))
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := os.Remove(name); err != nil {
+			return err
+		}
+		o.count--
+	}
+	return nil
+}
+
+func (o *DirOutbox) Len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.count
+}
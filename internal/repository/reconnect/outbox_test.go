@@ -0,0 +1,65 @@
+package reconnect
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"loto/internal/model"
+	"loto/internal/repository"
+	"loto/internal/repository/memory"
+)
+
+func TestDirOutboxSetsAsideCorruptFiles(t *testing.T) {
+	dir := t.TempDir()
+	o, err := NewDirOutbox(dir, 0, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created := time.Now().UTC().Truncate(time.Microsecond)
+	first := &model.Scan{ID: uuid.NewString(), ImageURL: "first.jpg", Status: "confirmed", CardIndex: 1, CreatedAt: created}
+	last := &model.Scan{ID: uuid.NewString(), ImageURL: "last.jpg", Status: "confirmed", CardIndex: 1, CreatedAt: created.Add(2 * time.Second)}
+	for _, sc := range []*model.Scan{first, last} {
+		if err := o.Add(sc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A hand-edited file queued between the two.
+	bad := filepath.Join(dir, "00000000000000000001_edited.json")
+	if err := os.WriteFile(bad, []byte(`{"id": "edited", `), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// Reopen so the corrupt file is counted as queued.
+	if o, err = NewDirOutbox(dir, 0, zap.NewNop()); err != nil {
+		t.Fatal(err)
+	}
+	if o.Len() != 3 {
+		t.Fatalf("Len = %d, want 3", o.Len())
+	}
+
+	// Flushing writes the readable scans and sets the corrupt one aside.
+	db := memory.New()
+	s := New(func(context.Context) (repository.Store, error) { return db, nil }, o, time.Hour, zap.NewNop())
+	s.check(context.Background())
+
+	for _, sc := range []*model.Scan{first, last} {
+		if _, err := db.GetScanByID(context.Background(), sc.ID); err != nil {
+			t.Errorf("scan %s not flushed: %v", sc.ImageURL, err)
+		}
+	}
+	if o.Len() != 0 {
+		t.Errorf("Len = %d after flush, want 0", o.Len())
+	}
+	if _, err := os.Stat(bad + ".bad"); err != nil {
+		t.Errorf("corrupt file not set aside: %v", err)
+	}
+	if _, err := os.Stat(bad); !os.IsNotExist(err) {
+		t.Errorf("corrupt file still pending: %v", err)
+	}
+}
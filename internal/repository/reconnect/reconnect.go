@@ -0,0 +1,432 @@
+// Package reconnect keeps the server useful while its database is down. The
+// Store connects in the background and retries until it succeeds, then
+// pings to notice outages. While the database is out of reach, reads fail
+// with repository.ErrUnavailable and scans are queued in an Outbox, to be
+// written once it is back.
+package reconnect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"loto/internal/model"
+	"loto/internal/repository"
+)
+
+// Pinger is implemented by stores that can check their connection.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// ConnectFunc returns the store once its database is reachable.
+type ConnectFunc func(ctx context.Context) (repository.Store, error)
+
+type Store struct {
+	connect  ConnectFunc
+	outbox   Outbox
+	interval time.Duration
+	logger   *zap.Logger
+
+	mu      sync.RWMutex
+	db      repository.Store
+	up      bool
+	failing bool
+	since   time.Time
+}
+
+var (
+	_ repository.Store          = (*Store)(nil)
+	_ repository.HealthReporter = (*Store)(nil)
+)
+
+// New creates a store that is connecting; Start connects it.
+func New(connect ConnectFunc, outbox Outbox, interval time.Duration, logger *zap.Logger) *Store {
+	return &Store{
+		connect:  connect,
+		outbox:   outbox,
+		interval: interval,
+		logger:   logger,
+		since:    time.Now().UTC(),
+	}
+}
+
+// Start tries to connect once, so that a reachable database is in use as
+// soon as Start returns, then keeps checking the connection every interval
+// until ctx is done.
+func (s *Store) Start(ctx context.Context) {
+	s.check(ctx)
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.check(ctx)
+			}
+		}
+	}()
+}
+
+// check connects or pings the database and flushes the outbox when it is up.
+func (s *Store) check(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, s.interval)
+	defer cancel()
+
+	s.mu.RLock()
+	db := s.db
+	s.mu.RUnlock()
+
+	if db == nil {
+		connected, err := s.connect(ctx)
+		if err != nil {
+			s.setDown(err)
+			return
+		}
+		s.mu.Lock()
+		s.db = connected
+		s.mu.Unlock()
+		db = connected
+	} else if p, ok := db.(Pinger); ok {
+		if err := p.Ping(ctx); err != nil {
+			s.setDown(err)
+			return
+		}
+	}
+	s.setUp()
+	s.flush(ctx, db)
+}
+
+func (s *Store) setUp() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failing = false
+	if !s.up {
+		s.up, s.since = true, time.Now().UTC()
+		s.logger.Info("database connected", zap.Int("queued_scans", s.outbox.Len()))
+	}
+}
+
+// setDown marks the database down. The first failure of an outage is a
+// warning; the retries after it are debug logs.
+func (s *Store) setDown(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failing {
+		s.logger.Debug("database still unreachable", zap.Error(err))
+		return
+	}
+	if s.up {
+		s.since = time.Now().UTC()
+	}
+	s.up, s.failing = false, true
+	s.logger.Warn("database unreachable, queueing scans until it is back",
+		zap.Duration("retry_interval", s.interval),
+		zap.Error(err),
+	)
+}
+
+// flush writes queued scans, oldest first, stopping at the first failure.
+// A scan that is already stored was written before a crash and is dropped.
+func (s *Store) flush(ctx context.Context, db repository.Store) {
+	if s.outbox.Len() == 0 {
+		return
+	}
+	pending, err := s.outbox.Pending()
+	if err != nil {
+		s.logger.Error("failed to read outbox", zap.Error(err))
+		return
+	}
+
+	flushed := 0
+	for _, scan := range pending {
+		if err := db.SaveScan(ctx, scan); err != nil && !errors.Is(err, repository.ErrConflict) {
+			s.logger.Warn("failed to flush queued scan, will retry", zap.String("scan_id", scan.ID), zap.Error(err))
+			break
+		}
+		if err := s.outbox.Remove(scan.ID); err != nil {
+			s.logger.Error("failed to remove flushed scan from outbox", zap.String("scan_id", scan.ID), zap.Error(err))
+			break
+		}
+		flushed++
+	}
+	if flushed == 0 {
+		return
+	}
+	s.logger.Info("flushed queued scans", zap.Int("flushed", flushed), zap.Int("queued", s.outbox.Len()))
+}
+
+// Health reports the connection state and the scans waiting to be written.
+func (s *Store) Health() model.DatabaseHealth {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	h := model.DatabaseHealth{Status: model.DatabaseUp, Since: s.since, Queued: s.outbox.Len()}
+	switch {
+	case s.up:
+	case s.db == nil:
+		h.Status = model.DatabaseConnecting
+	default:
+		h.Status = model.DatabaseDown
+	}
+	return h
+}
+
+// backend returns the store while the database is up.
+func (s *Store) backend() (repository.Store, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if !s.up {
+		return nil, repository.ErrUnavailable
+	}
+	return s.db, nil
+}
+
+// SaveScan writes the scan, or queues it while the database is down. A
+// write that fails because the connection was just lost is queued too.
+func (s *Store) SaveScan(ctx context.Context, scan *model.Scan) error {
+	if db, err := s.backend(); err == nil {
+		err = db.SaveScan(ctx, scan)
+		if err == nil || errors.Is(err, repository.ErrConflict) || !s.lost(ctx, db) {
+			return err
+		}
+	}
+
+	if scan.ID == "" {
+		scan.ID = uuid.NewString()
+	}
+	if scan.CreatedAt.IsZero() {
+		scan.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	}
+	if err := s.outbox.Add(scan); err != nil {
+		return fmt.Errorf("%w: queue scan: %w", repository.ErrUnavailable, err)
+	}
+	return nil
+}
+
+// lost reports whether db has lost its connection, marking the store down.
+func (s *Store) lost(ctx context.Context, db repository.Store) bool {
+	p, ok := db.(Pinger)
+	if !ok {
+		return false
+	}
+	if err := p.Ping(ctx); err != nil {
+		s.setDown(err)
+		return true
+	}
+	return false
+}
+
+func (s *Store) GetScanByID(ctx context.Context, scanID string) (*model.Scan, error) {
+	db, err := s.backend()
+	if err != nil {
+		return nil, err
+	}
+	return db.GetScanByID(ctx, scanID)
+}
+
+func (s *Store) GetScansByUserID(ctx context.Context, userID string, f repository.ScanFilter) ([]model.ScanHistoryItem, error) {
+	db, err := s.backend()
+	if err != nil {
+		return nil, err
+	}
+	return db.GetScansByUserID(ctx, userID, f)
+}
+
+func (s *Store) FindDuplicates(ctx context.Context, scan *model.Scan) ([]string, error) {
+	db, err := s.backend()
+	if err != nil {
+		return nil, err
+	}
+	return db.FindDuplicates(ctx, scan)
+}
+
+func (s *Store) FindMatchingResults(ctx context.Context, numbers []int) ([]model.LotteryResult, error) {
+	db, err := s.backend()
+	if err != nil {
+		return nil, err
+	}
+	return db.FindMatchingResults(ctx, numbers)
+}
+
+func (s *Store) SaveLotteryResults(ctx context.Context, results []model.LotteryResult) error {
+	db, err := s.backend()
+	if err != nil {
+		return err
+	}
+	return db.SaveLotteryResults(ctx, results)
+}
+
+func (s *Store) SaveBatch(ctx context.Context, batch *model.BatchResponse) error {
+	db, err := s.backend()
+	if err != nil {
+		return err
+	}
+	return db.SaveBatch(ctx, batch)
+}
+
+func (s *Store) GetBatch(ctx context.Context, batchID string) (*model.BatchResponse, error) {
+	db, err := s.backend()
+	if err != nil {
+		return nil, err
+	}
+	return db.GetBatch(ctx, batchID)
+}
+
+func (s *Store) GetDailyUsage(ctx context.Context, from, to time.Time) ([]model.UsageAggregate, error) {
+	db, err := s.backend()
+	if err != nil {
+		return nil, err
+	}
+	return db.GetDailyUsage(ctx, from, to)
+}
+
+func (s *Store) GetPromptStats(ctx context.Context, from, to time.Time) ([]model.PromptStats, error) {
+	db, err := s.backend()
+	if err != nil {
+		return nil, err
+	}
+	return db.GetPromptStats(ctx, from, to)
+}
+
+func (s *Store) GetSuspiciousCards(ctx context.Context, from, to time.Time) ([]model.SuspiciousCard, error) {
+	db, err := s.backend()
+	if err != nil {
+		return nil, err
+	}
+	return db.GetSuspiciousCards(ctx, from, to)
+}
+
+func (s *Store) CreateUser(ctx context.Context, user *model.User) error {
+	db, err := s.backend()
+	if err != nil {
+		return err
+	}
+	return db.CreateUser(ctx, user)
+}
+
+func (s *Store) GetUserByID(ctx context.Context, userID string) (*model.User, error) {
+	db, err := s.backend()
+	if err != nil {
+		return nil, err
+	}
+	return db.GetUserByID(ctx, userID)
+}
+
+func (s *Store) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	db, err := s.backend()
+	if err != nil {
+		return nil, err
+	}
+	return db.GetUserByEmail(ctx, email)
+}
+
+func (s *Store) GetUserByDeviceID(ctx context.Context, deviceID string) (*model.User, error) {
+	db, err := s.backend()
+	if err != nil {
+		return nil, err
+	}
+	return db.GetUserByDeviceID(ctx, deviceID)
+}
+
+func (s *Store) UpgradeUser(ctx context.Context, userID, email, passwordHash string) (*model.User, error) {
+	db, err := s.backend()
+	if err != nil {
+		return nil, err
+	}
+	return db.UpgradeUser(ctx, userID, email, passwordHash)
+}
+
+func (s *Store) SaveRefreshToken(ctx context.Context, userID, tokenHash string, expires time.Time) error {
+	db, err := s.backend()
+	if err != nil {
+		return err
+	}
+	return db.SaveRefreshToken(ctx, userID, tokenHash, expires)
+}
+
+func (s *Store) UseRefreshToken(ctx context.Context, tokenHash string) (string, error) {
+	db, err := s.backend()
+	if err != nil {
+		return "", err
+	}
+	return db.UseRefreshToken(ctx, tokenHash)
+}
+
+func (s *Store) RevokeRefreshToken(ctx context.Context, tokenHash string) error {
+	db, err := s.backend()
+	if err != nil {
+		return err
+	}
+	return db.RevokeRefreshToken(ctx, tokenHash)
+}
+
+func (s *Store) CreateAPIKey(ctx context.Context, key *model.APIKey, keyHash string) error {
+	db, err := s.backend()
+	if err != nil {
+		return err
+	}
+	return db.CreateAPIKey(ctx, key, keyHash)
+}
+
+func (s *Store) ListAPIKeys(ctx context.Context) ([]model.APIKey, error) {
+	db, err := s.backend()
+	if err != nil {
+		return nil, err
+	}
+	return db.ListAPIKeys(ctx)
+}
+
+func (s *Store) GetAPIKey(ctx context.Context, keyID string) (*model.APIKey, error) {
+	db, err := s.backend()
+	if err != nil {
+		return nil, err
+	}
+	return db.GetAPIKey(ctx, keyID)
+}
+
+func (s *Store) GetActiveAPIKey(ctx context.Context, keyHash string) (*model.APIKey, error) {
+	db, err := s.backend()
+	if err != nil {
+		return nil, err
+	}
+	return db.GetActiveAPIKey(ctx, keyHash)
+}
+
+func (s *Store) RotateAPIKey(ctx context.Context, oldID string, next *model.APIKey, keyHash string, grace time.Duration) error {
+	db, err := s.backend()
+	if err != nil {
+		return err
+	}
+	return db.RotateAPIKey(ctx, oldID, next, keyHash, grace)
+}
+
+func (s *Store) RevokeAPIKey(ctx context.Context, keyID string) error {
+	db, err := s.backend()
+	if err != nil {
+		return err
+	}
+	return db.RevokeAPIKey(ctx, keyID)
+}
+
+func (s *Store) RecordAPIKeyUse(ctx context.Context, keyID string, failed bool) error {
+	db, err := s.backend()
+	if err != nil {
+		return err
+	}
+	return db.RecordAPIKeyUse(ctx, keyID, failed)
+}
+
+func (s *Store) GetAPIKeyUsage(ctx context.Context, keyID string, from, to time.Time) ([]model.APIKeyUsage, error) {
+	db, err := s.backend()
+	if err != nil {
+		return nil, err
+	}
+	return db.GetAPIKeyUsage(ctx, keyID, from, to)
+}
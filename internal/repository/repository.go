@@ -3,7 +3,10 @@ package repository
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -13,36 +16,178 @@ import (
 	"loto/internal/model"
 )
 
+// Repository is the Postgres Store.
 type Repository struct {
 	db *pgxpool.Pool
 }
 
+// ErrNotFound is returned when a requested record does not exist.
+var ErrNotFound = errors.New("not found")
+
+// ErrUnavailable is returned while the database cannot be reached.
+var ErrUnavailable = errors.New("database unavailable")
+
 func New(db *pgxpool.Pool) *Repository {
 	return &Repository{db: db}
 }
 
+func (r *Repository) Ping(ctx context.Context) error {
+	return r.db.Ping(ctx)
+}
+
 func (r *Repository) SaveScan(ctx context.Context, scan *model.Scan) error {
-	scan.ID = uuid.NewString()
-	scan.CreatedAt = time.Now().UTC()
+	if scan.ID == "" {
+		scan.ID = uuid.NewString()
+	}
+	if scan.CreatedAt.IsZero() {
+		scan.CreatedAt = time.Now().UTC()
+	}
+
+	numbers := scan.ExtractedNumbers
+	if numbers == nil {
+		numbers = []int{}
+	}
+	numbersJSON, err := json.Marshal(numbers)
+	if err != nil {
+		return err
+	}
+	steps := scan.Preprocessing
+	if steps == nil {
+		steps = []string{}
+	}
+	stepsJSON, err := json.Marshal(steps)
+	if err != nil {
+		return err
+	}
+	blocks := scan.Blocks
+	if blocks == nil {
+		blocks = []model.Block{}
+	}
+	blocksJSON, err := json.Marshal(blocks)
+	if err != nil {
+		return err
+	}
+	tokens := scan.OCRTokens
+	if tokens == nil {
+		tokens = []model.OCRToken{}
+	}
+	tokensJSON, err := json.Marshal(tokens)
+	if err != nil {
+		return err
+	}
 
-	numbersJSON, err := json.Marshal(scan.ExtractedNumbers)
+	tx, err := r.db.Begin(ctx)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback(ctx)
 
-	_, err = r.db.Exec(ctx,
-		`INSERT INTO scans (id, user_id, image_url, extracted_numbers, confidence, status, created_at)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7)`,
-		scan.ID, scan.UserID, scan.ImageURL, numbersJSON, scan.Confidence, scan.Status, scan.CreatedAt,
+	_, err = tx.Exec(ctx,
+		`INSERT INTO scans (id, user_id, image_url, lottery_type, blocks, extracted_numbers, confidence, status, notes, provider, model, cost_usd, prompt_version, scan_path, duration_ms, preprocessing, upload_id, card_index, card_fingerprint, ticket_id, api_key_id, ocr_tokens, raw_response, created_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24)`,
+		scan.ID, scan.UserID, scan.ImageURL, scan.LotteryType, blocksJSON, numbersJSON, scan.Confidence, scan.Status, scan.Notes, scan.Provider, scan.Model, scan.CostUSD, scan.PromptVersion, scan.Path, scan.DurationMS, stepsJSON, scan.UploadID, scan.CardIndex, scan.Fingerprint, scan.TicketID, scan.APIKeyID, tokensJSON, scan.RawResponse, scan.CreatedAt,
 	)
-	return err
+	if isUniqueViolation(err) {
+		return ErrConflict
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := insertUsage(ctx, tx, &scan.ID, scan.Usage, scan.CreatedAt); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func insertUsage(ctx context.Context, tx pgx.Tx, scanID *string, usage []model.Usage, createdAt time.Time) error {
+	for _, u := range usage {
+		_, err := tx.Exec(ctx,
+			`INSERT INTO scan_usage (id, scan_id, provider, model, input_tokens, output_tokens, thinking_tokens, units, cost_usd, created_at)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+			uuid.NewString(), scanID, u.Provider, u.Model, u.InputTokens, u.OutputTokens, u.ThinkingTokens, u.Units, u.CostUSD, createdAt,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (r *Repository) GetScansByUserID(ctx context.Context, userID string) ([]model.ScanHistoryItem, error) {
+func (r *Repository) GetDailyUsage(ctx context.Context, from, to time.Time) ([]model.UsageAggregate, error) {
 	rows, err := r.db.Query(ctx,
-		`SELECT id, extracted_numbers, confidence, status, created_at
-		 FROM scans WHERE user_id = $1 ORDER BY created_at DESC LIMIT 50`,
-		userID,
+		`SELECT date_trunc('day', created_at AT TIME ZONE 'UTC') AS day, provider, model,
+		        COUNT(*), COUNT(DISTINCT scan_id),
+		        SUM(input_tokens), SUM(output_tokens), SUM(thinking_tokens), SUM(units), SUM(cost_usd)
+		 FROM scan_usage
+		 WHERE created_at >= $1 AND created_at < $2
+		 GROUP BY 1, 2, 3
+		 ORDER BY 1 DESC, 2, 3`,
+		from, to,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []model.UsageAggregate
+	for rows.Next() {
+		var a model.UsageAggregate
+		if err := rows.Scan(&a.Day, &a.Provider, &a.Model, &a.Calls, &a.Scans,
+			&a.InputTokens, &a.OutputTokens, &a.ThinkingTokens, &a.Units, &a.CostUSD); err != nil {
+			return nil, err
+		}
+		items = append(items, a)
+	}
+	return items, rows.Err()
+}
+
+// ScanFilter selects a user's scans for history. Zero fields do not filter;
+// To is exclusive. A page after the scan with AfterTime and AfterID holds
+// the scans that sort after it, newest first.
+type ScanFilter struct {
+	From, To      time.Time
+	Status        string
+	LotteryType   string
+	MinConfidence *float64
+	AfterTime     time.Time
+	AfterID       string
+	Limit         int
+}
+
+func (r *Repository) GetScansByUserID(ctx context.Context, userID string, f ScanFilter) ([]model.ScanHistoryItem, error) {
+	conds := []string{"user_id = $1"}
+	args := []any{userID}
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	if !f.From.IsZero() {
+		conds = append(conds, "created_at >= "+arg(f.From))
+	}
+	if !f.To.IsZero() {
+		conds = append(conds, "created_at < "+arg(f.To))
+	}
+	if f.Status != "" {
+		conds = append(conds, "status = "+arg(f.Status))
+	}
+	if f.LotteryType != "" {
+		conds = append(conds, "lottery_type = "+arg(f.LotteryType))
+	}
+	if f.MinConfidence != nil {
+		conds = append(conds, "confidence >= "+arg(*f.MinConfidence))
+	}
+	if f.AfterID != "" {
+		conds = append(conds, "(created_at, id) < ("+arg(f.AfterTime)+", "+arg(f.AfterID)+")")
+	}
+	limit := arg(f.Limit)
+
+	rows, err := r.db.Query(ctx,
+		`SELECT id, lottery_type, ticket_id, blocks, extracted_numbers, confidence, status, created_at
+		 FROM scans WHERE `+strings.Join(conds, " AND ")+`
+		 ORDER BY created_at DESC, id DESC
+		 LIMIT `+limit,
+		args...,
 	)
 	if err != nil {
 		return nil, err
@@ -54,22 +199,68 @@ func (r *Repository) GetScansByUserID(ctx context.Context, userID string) ([]mod
 
 func (r *Repository) GetScanByID(ctx context.Context, scanID string) (*model.Scan, error) {
 	var scan model.Scan
-	var numbersJSON []byte
+	var blocksJSON, numbersJSON, stepsJSON, tokensJSON []byte
 
 	err := r.db.QueryRow(ctx,
-		`SELECT id, user_id, image_url, extracted_numbers, confidence, status, created_at
+		`SELECT id, user_id, image_url, lottery_type, blocks, extracted_numbers, confidence, status, notes,
+		        provider, model, cost_usd, prompt_version, scan_path, duration_ms, preprocessing, upload_id, card_index,
+		        card_fingerprint, ticket_id, api_key_id, ocr_tokens, raw_response, created_at
 		 FROM scans WHERE id = $1`, scanID,
-	).Scan(&scan.ID, &scan.UserID, &scan.ImageURL, &numbersJSON, &scan.Confidence, &scan.Status, &scan.CreatedAt)
+	).Scan(&scan.ID, &scan.UserID, &scan.ImageURL, &scan.LotteryType, &blocksJSON, &numbersJSON, &scan.Confidence, &scan.Status, &scan.Notes,
+		&scan.Provider, &scan.Model, &scan.CostUSD, &scan.PromptVersion, &scan.Path, &scan.DurationMS, &stepsJSON, &scan.UploadID, &scan.CardIndex,
+		&scan.Fingerprint, &scan.TicketID, &scan.APIKeyID, &tokensJSON, &scan.RawResponse, &scan.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
 
+	if err := json.Unmarshal(blocksJSON, &scan.Blocks); err != nil {
+		return nil, err
+	}
 	if err := json.Unmarshal(numbersJSON, &scan.ExtractedNumbers); err != nil {
 		return nil, err
 	}
+	if err := json.Unmarshal(stepsJSON, &scan.Preprocessing); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(tokensJSON, &scan.OCRTokens); err != nil {
+		return nil, err
+	}
 	return &scan, nil
 }
 
+func (r *Repository) GetPromptStats(ctx context.Context, from, to time.Time) ([]model.PromptStats, error) {
+	rows, err := r.db.Query(ctx,
+		`SELECT prompt_version, COUNT(*),
+		        COUNT(*) FILTER (WHERE status = 'confirmed'),
+		        COUNT(*) FILTER (WHERE status = 'needs_confirmation'),
+		        COUNT(*) FILTER (WHERE status = 'rejected'),
+		        COALESCE(AVG(confidence), 0),
+		        COALESCE(AVG(jsonb_array_length(extracted_numbers)) FILTER (WHERE status <> 'rejected'), 0)
+		 FROM scans
+		 WHERE created_at >= $1 AND created_at < $2
+		 GROUP BY prompt_version
+		 ORDER BY prompt_version`,
+		from, to,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []model.PromptStats
+	for rows.Next() {
+		var ps model.PromptStats
+		if err := rows.Scan(&ps.PromptVersion, &ps.Scans, &ps.Confirmed, &ps.NeedsConfirmation, &ps.Rejected, &ps.AvgConfidence, &ps.AvgNumbers); err != nil {
+			return nil, err
+		}
+		items = append(items, ps)
+	}
+	return items, rows.Err()
+}
+
 func (r *Repository) FindMatchingResults(ctx context.Context, numbers []int) ([]model.LotteryResult, error) {
 	strNumbers := make([]string, len(numbers))
 	for i, n := range numbers {
@@ -96,13 +287,38 @@ func (r *Repository) FindMatchingResults(ctx context.Context, numbers []int) ([]
 	return results, rows.Err()
 }
 
+// SaveLotteryResults adds drawn numbers that scans are checked against.
+func (r *Repository) SaveLotteryResults(ctx context.Context, results []model.LotteryResult) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	for i := range results {
+		lr := &results[i]
+		lr.ID = uuid.NewString()
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO lottery_results (id, date, region, prize_type, winning_number)
+			 VALUES ($1, $2, $3, $4, $5)`,
+			lr.ID, lr.Date, lr.Region, lr.PrizeType, lr.WinningNumber,
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
 func collectScanHistory(rows pgx.Rows) ([]model.ScanHistoryItem, error) {
 	var items []model.ScanHistoryItem
 	for rows.Next() {
 		var item model.ScanHistoryItem
-		var numbersJSON []byte
+		var blocksJSON, numbersJSON []byte
 
-		if err := rows.Scan(&item.ID, &numbersJSON, &item.Confidence, &item.Status, &item.CreatedAt); err != nil {
+		if err := rows.Scan(&item.ID, &item.LotteryType, &item.TicketID, &blocksJSON, &numbersJSON, &item.Confidence, &item.Status, &item.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(blocksJSON, &item.Blocks); err != nil {
 			return nil, err
 		}
 		if err := json.Unmarshal(numbersJSON, &item.ExtractedNumbers); err != nil {
@@ -112,3 +328,131 @@ func collectScanHistory(rows pgx.Rows) ([]model.ScanHistoryItem, error) {
 	}
 	return items, rows.Err()
 }
+
+// SaveBatch stores a finished batch with its per-image results.
+func (r *Repository) SaveBatch(ctx context.Context, batch *model.BatchResponse) error {
+	summaryJSON, err := json.Marshal(batch.Summary)
+	if err != nil {
+		return err
+	}
+	itemsJSON, err := json.Marshal(batch.Items)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Exec(ctx,
+		`INSERT INTO scan_batches (id, user_id, status, summary, items, created_at, completed_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)
+		 ON CONFLICT (id) DO UPDATE
+		 SET status = EXCLUDED.status, summary = EXCLUDED.summary,
+		     items = EXCLUDED.items, completed_at = EXCLUDED.completed_at`,
+		batch.BatchID, batch.UserID, batch.Status, summaryJSON, itemsJSON, batch.CreatedAt, batch.CompletedAt,
+	)
+	return err
+}
+
+func (r *Repository) GetBatch(ctx context.Context, batchID string) (*model.BatchResponse, error) {
+	var batch model.BatchResponse
+	var summaryJSON, itemsJSON []byte
+
+	err := r.db.QueryRow(ctx,
+		`SELECT id, user_id, status, summary, items, created_at, completed_at
+		 FROM scan_batches WHERE id = $1`,
+		batchID,
+	).Scan(&batch.BatchID, &batch.UserID, &batch.Status, &summaryJSON, &itemsJSON, &batch.CreatedAt, &batch.CompletedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(summaryJSON, &batch.Summary); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(itemsJSON, &batch.Items); err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// FindDuplicates reports whether another user already registered the scan's
+// card layout or ticket ID, or any user registered its ticket ID with a
+// different layout, as GetSuspiciousCards flags. Anonymous scans are not
+// compared with each other, since their registrants cannot be told apart.
+func (r *Repository) FindDuplicates(ctx context.Context, scan *model.Scan) ([]string, error) {
+	if scan.Fingerprint == nil && scan.TicketID == nil {
+		return nil, nil
+	}
+
+	var layouts, tickets int
+	err := r.db.QueryRow(ctx,
+		`SELECT COUNT(*) FILTER (WHERE card_fingerprint = $1 AND user_id IS DISTINCT FROM $4),
+		        COUNT(*) FILTER (WHERE ticket_id = $2 AND (user_id IS DISTINCT FROM $4 OR card_fingerprint <> $1))
+		 FROM scans
+		 WHERE id <> $3
+		   AND (card_fingerprint = $1 OR ticket_id = $2)
+		   AND status <> 'rejected'`,
+		scan.Fingerprint, scan.TicketID, scan.ID, scan.UserID,
+	).Scan(&layouts, &tickets)
+	if err != nil {
+		return nil, err
+	}
+
+	var reasons []string
+	if layouts > 0 {
+		reasons = append(reasons, model.DuplicateLayout)
+	}
+	if tickets > 0 {
+		reasons = append(reasons, model.DuplicateTicketID)
+	}
+	return reasons, nil
+}
+
+// GetSuspiciousCards lists card layouts and ticket IDs registered by more
+// than one user, and ticket IDs seen with more than one layout, with at least
+// one scan in [from, to). Each group carries all of its scans, oldest first.
+func (r *Repository) GetSuspiciousCards(ctx context.Context, from, to time.Time) ([]model.SuspiciousCard, error) {
+	rows, err := r.db.Query(ctx,
+		`WITH keyed AS (
+		     SELECT 'duplicate_layout' AS reason, card_fingerprint AS key, * FROM scans WHERE card_fingerprint IS NOT NULL
+		     UNION ALL
+		     SELECT 'duplicate_ticket_id', ticket_id, * FROM scans WHERE ticket_id IS NOT NULL AND status <> 'rejected'
+		 ), flagged AS (
+		     SELECT reason, key,
+		            COUNT(DISTINCT user_id) + MAX(CASE WHEN user_id IS NULL THEN 1 ELSE 0 END) AS registrants,
+		            COUNT(DISTINCT card_fingerprint) AS layouts
+		     FROM keyed
+		     GROUP BY reason, key
+		     HAVING MAX(created_at) >= $1 AND MIN(created_at) < $2
+		 )
+		 SELECT f.reason, f.key, f.registrants, f.layouts,
+		        k.id, k.user_id, k.ticket_id, k.card_fingerprint, k.status, k.created_at
+		 FROM flagged f
+		 JOIN keyed k ON k.reason = f.reason AND k.key = f.key
+		 WHERE f.registrants > 1 OR (f.reason = 'duplicate_ticket_id' AND f.layouts > 1)
+		 ORDER BY f.registrants DESC, f.reason, f.key, k.created_at`,
+		from, to,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []model.SuspiciousCard
+	for rows.Next() {
+		var card model.SuspiciousCard
+		var sc model.SuspiciousScan
+		if err := rows.Scan(&card.Reason, &card.Key, &card.Registrants, &card.Layouts,
+			&sc.ScanID, &sc.UserID, &sc.TicketID, &sc.Fingerprint, &sc.Status, &sc.CreatedAt); err != nil {
+			return nil, err
+		}
+		if n := len(items); n > 0 && items[n-1].Reason == card.Reason && items[n-1].Key == card.Key {
+			items[n-1].Scans = append(items[n-1].Scans, sc)
+			continue
+		}
+		card.Scans = []model.SuspiciousScan{sc}
+		items = append(items, card)
+	}
+	return items, rows.Err()
+}
@@ -0,0 +1,44 @@
+package repository_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+
+	"loto/internal/migrate"
+	"loto/internal/repository"
+	"loto/internal/repository/conformance"
+	"loto/migrations"
+)
+
+// TestConformance runs against the Postgres database in
+// LOTO_TEST_POSTGRES_DSN, which it migrates and leaves its records in, so
+// point it at a scratch database. It is skipped when the variable is unset.
+func TestConformance(t *testing.T) {
+	dsn := os.Getenv("LOTO_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("LOTO_TEST_POSTGRES_DSN not set")
+	}
+	ctx := context.Background()
+
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	m, err := migrate.New(pool, migrations.FS, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	if err := conformance.Run(ctx, repository.New(pool)); err != nil {
+		t.Fatal(err)
+	}
+}
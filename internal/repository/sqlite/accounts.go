@@ -0,0 +1,298 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"loto/internal/model"
+	"loto/internal/repository"
+)
+
+const userColumns = `id, email, password_hash, device_id, created_at`
+
+func scanUser(row *sql.Row) (*model.User, error) {
+	var u model.User
+	if err := row.Scan(&u.ID, &u.Email, &u.PasswordHash, &u.DeviceID, timeCol{&u.CreatedAt}); err != nil {
+		return nil, notFound(err)
+	}
+	u.Anonymous = u.Email == nil
+	return &u, nil
+}
+
+func (s *Store) CreateUser(ctx context.Context, user *model.User) error {
+	user.ID = uuid.NewString()
+	user.CreatedAt = now()
+	if user.Email != nil {
+		email := strings.ToLower(*user.Email)
+		user.Email = &email
+	}
+	user.Anonymous = user.Email == nil
+
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO users (id, email, password_hash, device_id, created_at, updated_at)
+		 VALUES (?1, ?2, ?3, ?4, ?5, ?5)`,
+		user.ID, user.Email, user.PasswordHash, user.DeviceID, ts(user.CreatedAt),
+	)
+	if isUniqueViolation(err) {
+		return repository.ErrConflict
+	}
+	return err
+}
+
+func (s *Store) GetUserByID(ctx context.Context, userID string) (*model.User, error) {
+	return scanUser(s.db.QueryRowContext(ctx,
+		`SELECT `+userColumns+` FROM users WHERE id = ?`, userID))
+}
+
+func (s *Store) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	return scanUser(s.db.QueryRowContext(ctx,
+		`SELECT `+userColumns+` FROM users WHERE LOWER(email) = LOWER(?)`, email))
+}
+
+func (s *Store) GetUserByDeviceID(ctx context.Context, deviceID string) (*model.User, error) {
+	return scanUser(s.db.QueryRowContext(ctx,
+		`SELECT `+userColumns+` FROM users WHERE device_id = ?`, deviceID))
+}
+
+func (s *Store) UpgradeUser(ctx context.Context, userID, email, passwordHash string) (*model.User, error) {
+	user, err := scanUser(s.db.QueryRowContext(ctx,
+		`UPDATE users
+		 SET email = ?2, password_hash = ?3, device_id = NULL, updated_at = ?4
+		 WHERE id = ?1 AND email IS NULL
+		 RETURNING `+userColumns,
+		userID, strings.ToLower(email), passwordHash, ts(now()),
+	))
+	if isUniqueViolation(err) {
+		return nil, repository.ErrConflict
+	}
+	return user, err
+}
+
+func (s *Store) SaveRefreshToken(ctx context.Context, userID, tokenHash string, expires time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO refresh_tokens (id, user_id, token_hash, expires_at, created_at)
+		 VALUES (?, ?, ?, ?, ?)`,
+		uuid.NewString(), userID, tokenHash, ts(expires), ts(now()),
+	)
+	return err
+}
+
+func (s *Store) UseRefreshToken(ctx context.Context, tokenHash string) (string, error) {
+	at := ts(now())
+	var userID string
+	err := s.db.QueryRowContext(ctx,
+		`UPDATE refresh_tokens SET revoked_at = ?2
+		 WHERE token_hash = ?1 AND revoked_at IS NULL AND expires_at > ?2
+		 RETURNING user_id`,
+		tokenHash, at,
+	).Scan(&userID)
+	if err == nil {
+		return userID, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+
+	_, err = s.db.ExecContext(ctx,
+		`UPDATE refresh_tokens SET revoked_at = ?2
+		 WHERE revoked_at IS NULL
+		   AND user_id = (SELECT user_id FROM refresh_tokens WHERE token_hash = ?1 AND revoked_at IS NOT NULL)`,
+		tokenHash, at,
+	)
+	if err != nil {
+		return "", err
+	}
+	return "", repository.ErrNotFound
+}
+
+func (s *Store) RevokeRefreshToken(ctx context.Context, tokenHash string) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE refresh_tokens SET revoked_at = ?
+		 WHERE token_hash = ? AND revoked_at IS NULL`,
+		ts(now()), tokenHash,
+	)
+	return err
+}
+
+const apiKeyColumns = `id, user_id, name, prefix, scopes, rotated_from, created_at, last_used_at, expires_at, revoked_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanAPIKey(row rowScanner) (*model.APIKey, error) {
+	var k model.APIKey
+	err := row.Scan(&k.ID, &k.UserID, &k.Name, &k.Prefix, jsonCol{&k.Scopes}, &k.RotatedFrom,
+		timeCol{&k.CreatedAt}, nullTimeCol{&k.LastUsedAt}, nullTimeCol{&k.ExpiresAt}, nullTimeCol{&k.RevokedAt})
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &k, nil
+}
+
+// execer is satisfied by both the database and a transaction.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func (s *Store) CreateAPIKey(ctx context.Context, key *model.APIKey, keyHash string) error {
+	return createAPIKey(ctx, s.db, key, keyHash)
+}
+
+func createAPIKey(ctx context.Context, db execer, key *model.APIKey, keyHash string) error {
+	key.ID = uuid.NewString()
+	key.CreatedAt = now()
+	scopes, err := jsonText(orEmpty(key.Scopes))
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx,
+		`INSERT INTO api_keys (id, user_id, name, prefix, key_hash, scopes, rotated_from, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		key.ID, key.UserID, key.Name, key.Prefix, keyHash, scopes, key.RotatedFrom, ts(key.CreatedAt),
+	)
+	return err
+}
+
+func (s *Store) ListAPIKeys(ctx context.Context) ([]model.APIKey, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+apiKeyColumns+` FROM api_keys ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []model.APIKey
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *k)
+	}
+	return keys, rows.Err()
+}
+
+func (s *Store) GetAPIKey(ctx context.Context, keyID string) (*model.APIKey, error) {
+	return scanAPIKey(s.db.QueryRowContext(ctx,
+		`SELECT `+apiKeyColumns+` FROM api_keys WHERE id = ?`, keyID))
+}
+
+func (s *Store) GetActiveAPIKey(ctx context.Context, keyHash string) (*model.APIKey, error) {
+	return scanAPIKey(s.db.QueryRowContext(ctx,
+		`SELECT `+apiKeyColumns+` FROM api_keys
+		 WHERE key_hash = ?1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?2)`,
+		keyHash, ts(now()),
+	))
+}
+
+func (s *Store) RotateAPIKey(ctx context.Context, oldID string, next *model.APIKey, keyHash string, grace time.Duration) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	at := now()
+	res, err := tx.ExecContext(ctx,
+		`UPDATE api_keys
+		 SET expires_at = MIN(COALESCE(expires_at, ?2), ?2)
+		 WHERE id = ?1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?3)`,
+		oldID, ts(at.Add(grace)), ts(at),
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return repository.ErrNotFound
+	}
+
+	next.RotatedFrom = &oldID
+	if err := createAPIKey(ctx, tx, next, keyHash); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *Store) RevokeAPIKey(ctx context.Context, keyID string) error {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE api_keys SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`, ts(now()), keyID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) RecordAPIKeyUse(ctx context.Context, keyID string, failed bool) error {
+	failures := 0
+	if failed {
+		failures = 1
+	}
+	at := now()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE api_keys SET last_used_at = ? WHERE id = ?`, ts(at), keyID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO api_key_usage (key_id, day, requests, errors)
+		 VALUES (?, ?, 1, ?)
+		 ON CONFLICT (key_id, day) DO UPDATE
+		 SET requests = requests + 1, errors = errors + excluded.errors`,
+		keyID, at.Format(time.DateOnly), failures,
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *Store) GetAPIKeyUsage(ctx context.Context, keyID string, from, to time.Time) ([]model.APIKeyUsage, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`WITH requests AS (
+		     SELECT day, requests, errors FROM api_key_usage
+		     WHERE key_id = ?1 AND day >= ?2 AND day < ?3
+		 ), scanned AS (
+		     SELECT substr(created_at, 1, 10) AS day, COUNT(*) AS scans, SUM(cost_usd) AS cost
+		     FROM scans
+		     WHERE api_key_id = ?1 AND created_at >= ?4 AND created_at < ?5
+		     GROUP BY 1
+		 )
+		 SELECT COALESCE(r.day, s.day), COALESCE(r.requests, 0), COALESCE(r.errors, 0),
+		        COALESCE(s.scans, 0), COALESCE(s.cost, 0)
+		 FROM requests r FULL OUTER JOIN scanned s ON r.day = s.day
+		 ORDER BY 1 DESC`,
+		keyID, from.UTC().Format(time.DateOnly), to.UTC().Format(time.DateOnly), ts(from), ts(to),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []model.APIKeyUsage
+	for rows.Next() {
+		var u model.APIKeyUsage
+		if err := rows.Scan(timeCol{&u.Day}, &u.Requests, &u.Errors, &u.Scans, &u.CostUSD); err != nil {
+			return nil, err
+		}
+		items = append(items, u)
+	}
+	return items, rows.Err()
+}
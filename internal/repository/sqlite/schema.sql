@@ -0,0 +1,118 @@
+-- The Postgres schema of migrations/ in SQLite types: UUIDs and timestamps
+-- are TEXT (timestamps in the fixed-width UTC format of package sqlite, so
+-- they sort as text), JSONB and TEXT[] are JSON TEXT.
+
+CREATE TABLE IF NOT EXISTS users (
+    id TEXT PRIMARY KEY,
+    email TEXT,
+    password_hash TEXT,
+    device_id TEXT,
+    created_at TEXT NOT NULL,
+    updated_at TEXT NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users(LOWER(email)) WHERE email IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_device_id ON users(device_id) WHERE device_id IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL UNIQUE,
+    expires_at TEXT NOT NULL,
+    revoked_at TEXT,
+    created_at TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON refresh_tokens(user_id);
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id),
+    name TEXT NOT NULL,
+    prefix TEXT NOT NULL,
+    key_hash TEXT NOT NULL UNIQUE,
+    scopes TEXT NOT NULL DEFAULT '[]',
+    rotated_from TEXT REFERENCES api_keys(id),
+    created_at TEXT NOT NULL,
+    last_used_at TEXT,
+    expires_at TEXT,
+    revoked_at TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys(user_id);
+
+CREATE TABLE IF NOT EXISTS api_key_usage (
+    key_id TEXT NOT NULL REFERENCES api_keys(id),
+    day TEXT NOT NULL,
+    requests INTEGER NOT NULL DEFAULT 0,
+    errors INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (key_id, day)
+);
+
+CREATE TABLE IF NOT EXISTS scans (
+    id TEXT PRIMARY KEY,
+    user_id TEXT REFERENCES users(id),
+    image_url TEXT NOT NULL,
+    lottery_type TEXT NOT NULL DEFAULT '',
+    blocks TEXT NOT NULL DEFAULT '[]',
+    extracted_numbers TEXT NOT NULL DEFAULT '[]',
+    confidence REAL NOT NULL DEFAULT 0,
+    status TEXT NOT NULL DEFAULT 'pending',
+    notes TEXT NOT NULL DEFAULT '',
+    provider TEXT NOT NULL DEFAULT '',
+    model TEXT NOT NULL DEFAULT '',
+    cost_usd REAL NOT NULL DEFAULT 0,
+    prompt_version TEXT NOT NULL DEFAULT '',
+    scan_path TEXT NOT NULL DEFAULT '',
+    duration_ms INTEGER NOT NULL DEFAULT 0,
+    preprocessing TEXT NOT NULL DEFAULT '[]',
+    upload_id TEXT,
+    card_index INTEGER NOT NULL DEFAULT 1,
+    card_fingerprint TEXT,
+    ticket_id TEXT,
+    api_key_id TEXT REFERENCES api_keys(id),
+    ocr_tokens TEXT NOT NULL DEFAULT '[]',
+    raw_response TEXT NOT NULL DEFAULT '',
+    created_at TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_scans_user_history ON scans(user_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_scans_created_at ON scans(created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_scans_card_fingerprint ON scans(card_fingerprint) WHERE card_fingerprint IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_scans_ticket_id ON scans(ticket_id) WHERE ticket_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_scans_api_key_id ON scans(api_key_id) WHERE api_key_id IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS scan_usage (
+    id TEXT PRIMARY KEY,
+    scan_id TEXT REFERENCES scans(id) ON DELETE CASCADE,
+    provider TEXT NOT NULL,
+    model TEXT NOT NULL,
+    input_tokens INTEGER NOT NULL DEFAULT 0,
+    output_tokens INTEGER NOT NULL DEFAULT 0,
+    thinking_tokens INTEGER NOT NULL DEFAULT 0,
+    units INTEGER NOT NULL DEFAULT 0,
+    cost_usd REAL NOT NULL DEFAULT 0,
+    created_at TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_scan_usage_created_at ON scan_usage(created_at DESC);
+
+CREATE TABLE IF NOT EXISTS scan_batches (
+    id TEXT PRIMARY KEY,
+    user_id TEXT REFERENCES users(id),
+    status TEXT NOT NULL,
+    summary TEXT NOT NULL DEFAULT '{}',
+    items TEXT NOT NULL DEFAULT '[]',
+    created_at TEXT NOT NULL,
+    completed_at TEXT
+);
+
+CREATE TABLE IF NOT EXISTS lottery_results (
+    id TEXT PRIMARY KEY,
+    date TEXT NOT NULL,
+    region TEXT NOT NULL,
+    prize_type TEXT NOT NULL,
+    winning_number TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_lottery_results_winning_number ON lottery_results(winning_number);
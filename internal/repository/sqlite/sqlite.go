@@ -0,0 +1,481 @@
+// Package sqlite is a repository.Store in a single SQLite file, for running
+// the server with history and accounts but without Postgres. The schema is
+// created when the file is opened. The driver is pure Go, so no cgo is
+// needed.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	sqlite "modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+
+	"loto/internal/model"
+	"loto/internal/repository"
+)
+
+//go:embed schema.sql
+var schema string
+
+// Store serialises access through one connection: SQLite allows a single
+// writer, and waiting on the pool is cheaper than retrying busy errors.
+type Store struct {
+	db *sql.DB
+}
+
+var _ repository.Store = (*Store)(nil)
+
+// Open opens or creates the database at path; ":memory:" keeps it in memory.
+func Open(path string) (*Store, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create schema: %w", err)
+	}
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Timestamps are stored as fixed-width UTC text at the microsecond precision
+// of Postgres, so that comparing and sorting them as text is chronological.
+const timeFormat = "2006-01-02T15:04:05.000000Z"
+
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+func ts(t time.Time) string {
+	return t.UTC().Format(timeFormat)
+}
+
+func tsPtr(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return ts(*t)
+}
+
+// timeCol scans a timestamp column.
+type timeCol struct{ t *time.Time }
+
+func (c timeCol) Scan(v any) error {
+	s, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("timestamp column holds %T", v)
+	}
+	t, err := time.Parse(timeFormat, s)
+	if err != nil {
+		t, err = time.Parse(time.DateOnly, s)
+	}
+	*c.t = t
+	return err
+}
+
+// nullTimeCol scans a nullable timestamp column.
+type nullTimeCol struct{ t **time.Time }
+
+func (c nullTimeCol) Scan(v any) error {
+	if v == nil {
+		*c.t = nil
+		return nil
+	}
+	var t time.Time
+	if err := (timeCol{&t}).Scan(v); err != nil {
+		return err
+	}
+	*c.t = &t
+	return nil
+}
+
+// jsonCol scans a JSON text column into v.
+type jsonCol struct{ v any }
+
+func (c jsonCol) Scan(v any) error {
+	switch data := v.(type) {
+	case string:
+		return json.Unmarshal([]byte(data), c.v)
+	case []byte:
+		return json.Unmarshal(data, c.v)
+	}
+	return fmt.Errorf("json column holds %T", v)
+}
+
+func jsonText(v any) (string, error) {
+	data, err := json.Marshal(v)
+	return string(data), err
+}
+
+func isUniqueViolation(err error) bool {
+	var e *sqlite.Error
+	return errors.As(err, &e) && (e.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE || e.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY)
+}
+
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return repository.ErrNotFound
+	}
+	return err
+}
+
+func orEmpty[T any](v []T) []T {
+	if v == nil {
+		return []T{}
+	}
+	return v
+}
+
+func (s *Store) SaveScan(ctx context.Context, scan *model.Scan) error {
+	if scan.ID == "" {
+		scan.ID = uuid.NewString()
+	}
+	if scan.CreatedAt.IsZero() {
+		scan.CreatedAt = now()
+	}
+
+	blocks, err := jsonText(orEmpty(scan.Blocks))
+	if err != nil {
+		return err
+	}
+	numbers, err := jsonText(orEmpty(scan.ExtractedNumbers))
+	if err != nil {
+		return err
+	}
+	steps, err := jsonText(orEmpty(scan.Preprocessing))
+	if err != nil {
+		return err
+	}
+	tokens, err := jsonText(orEmpty(scan.OCRTokens))
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO scans (id, user_id, image_url, lottery_type, blocks, extracted_numbers, confidence, status, notes, provider, model, cost_usd, prompt_version, scan_path, duration_ms, preprocessing, upload_id, card_index, card_fingerprint, ticket_id, api_key_id, ocr_tokens, raw_response, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		scan.ID, scan.UserID, scan.ImageURL, scan.LotteryType, blocks, numbers, scan.Confidence, scan.Status, scan.Notes, scan.Provider, scan.Model, scan.CostUSD, scan.PromptVersion, scan.Path, scan.DurationMS, steps, scan.UploadID, scan.CardIndex, scan.Fingerprint, scan.TicketID, scan.APIKeyID, tokens, scan.RawResponse, ts(scan.CreatedAt),
+	)
+	if isUniqueViolation(err) {
+		return repository.ErrConflict
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, u := range scan.Usage {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO scan_usage (id, scan_id, provider, model, input_tokens, output_tokens, thinking_tokens, units, cost_usd, created_at)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			uuid.NewString(), scan.ID, u.Provider, u.Model, u.InputTokens, u.OutputTokens, u.ThinkingTokens, u.Units, u.CostUSD, ts(scan.CreatedAt),
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *Store) GetScanByID(ctx context.Context, scanID string) (*model.Scan, error) {
+	var scan model.Scan
+	err := s.db.QueryRowContext(ctx,
+		`SELECT id, user_id, image_url, lottery_type, blocks, extracted_numbers, confidence, status, notes,
+		        provider, model, cost_usd, prompt_version, scan_path, duration_ms, preprocessing, upload_id, card_index,
+		        card_fingerprint, ticket_id, api_key_id, ocr_tokens, raw_response, created_at
+		 FROM scans WHERE id = ?`, scanID,
+	).Scan(&scan.ID, &scan.UserID, &scan.ImageURL, &scan.LotteryType, jsonCol{&scan.Blocks}, jsonCol{&scan.ExtractedNumbers}, &scan.Confidence, &scan.Status, &scan.Notes,
+		&scan.Provider, &scan.Model, &scan.CostUSD, &scan.PromptVersion, &scan.Path, &scan.DurationMS, jsonCol{&scan.Preprocessing}, &scan.UploadID, &scan.CardIndex,
+		&scan.Fingerprint, &scan.TicketID, &scan.APIKeyID, jsonCol{&scan.OCRTokens}, &scan.RawResponse, timeCol{&scan.CreatedAt})
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &scan, nil
+}
+
+func (s *Store) GetScansByUserID(ctx context.Context, userID string, f repository.ScanFilter) ([]model.ScanHistoryItem, error) {
+	conds := []string{"user_id = ?"}
+	args := []any{userID}
+	if !f.From.IsZero() {
+		conds = append(conds, "created_at >= ?")
+		args = append(args, ts(f.From))
+	}
+	if !f.To.IsZero() {
+		conds = append(conds, "created_at < ?")
+		args = append(args, ts(f.To))
+	}
+	if f.Status != "" {
+		conds = append(conds, "status = ?")
+		args = append(args, f.Status)
+	}
+	if f.LotteryType != "" {
+		conds = append(conds, "lottery_type = ?")
+		args = append(args, f.LotteryType)
+	}
+	if f.MinConfidence != nil {
+		conds = append(conds, "confidence >= ?")
+		args = append(args, *f.MinConfidence)
+	}
+	if f.AfterID != "" {
+		conds = append(conds, "(created_at, id) < (?, ?)")
+		args = append(args, ts(f.AfterTime), f.AfterID)
+	}
+	args = append(args, f.Limit)
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, lottery_type, ticket_id, blocks, extracted_numbers, confidence, status, created_at
+		 FROM scans WHERE `+strings.Join(conds, " AND ")+`
+		 ORDER BY created_at DESC, id DESC
+		 LIMIT ?`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []model.ScanHistoryItem
+	for rows.Next() {
+		var item model.ScanHistoryItem
+		if err := rows.Scan(&item.ID, &item.LotteryType, &item.TicketID, jsonCol{&item.Blocks}, jsonCol{&item.ExtractedNumbers},
+			&item.Confidence, &item.Status, timeCol{&item.CreatedAt}); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (s *Store) FindDuplicates(ctx context.Context, scan *model.Scan) ([]string, error) {
+	if scan.Fingerprint == nil && scan.TicketID == nil {
+		return nil, nil
+	}
+
+	var layouts, tickets int
+	err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FILTER (WHERE card_fingerprint = ?1 AND user_id IS NOT ?4),
+		        COUNT(*) FILTER (WHERE ticket_id = ?2 AND (user_id IS NOT ?4 OR card_fingerprint <> ?1))
+		 FROM scans
+		 WHERE id <> ?3
+		   AND (card_fingerprint = ?1 OR ticket_id = ?2)
+		   AND status <> 'rejected'`,
+		scan.Fingerprint, scan.TicketID, scan.ID, scan.UserID,
+	).Scan(&layouts, &tickets)
+	if err != nil {
+		return nil, err
+	}
+
+	var reasons []string
+	if layouts > 0 {
+		reasons = append(reasons, model.DuplicateLayout)
+	}
+	if tickets > 0 {
+		reasons = append(reasons, model.DuplicateTicketID)
+	}
+	return reasons, nil
+}
+
+func (s *Store) FindMatchingResults(ctx context.Context, numbers []int) ([]model.LotteryResult, error) {
+	if len(numbers) == 0 {
+		return nil, nil
+	}
+	args := make([]any, len(numbers))
+	for i, n := range numbers {
+		args[i] = fmt.Sprintf("%d", n)
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, date, region, prize_type, winning_number
+		 FROM lottery_results WHERE winning_number IN (?`+strings.Repeat(", ?", len(numbers)-1)+`)`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []model.LotteryResult
+	for rows.Next() {
+		var lr model.LotteryResult
+		if err := rows.Scan(&lr.ID, timeCol{&lr.Date}, &lr.Region, &lr.PrizeType, &lr.WinningNumber); err != nil {
+			return nil, err
+		}
+		results = append(results, lr)
+	}
+	return results, rows.Err()
+}
+
+func (s *Store) SaveLotteryResults(ctx context.Context, results []model.LotteryResult) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for i := range results {
+		lr := &results[i]
+		lr.ID = uuid.NewString()
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO lottery_results (id, date, region, prize_type, winning_number)
+			 VALUES (?, ?, ?, ?, ?)`,
+			lr.ID, lr.Date.Format(time.DateOnly), lr.Region, lr.PrizeType, lr.WinningNumber,
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *Store) SaveBatch(ctx context.Context, batch *model.BatchResponse) error {
+	summary, err := jsonText(batch.Summary)
+	if err != nil {
+		return err
+	}
+	items, err := jsonText(batch.Items)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO scan_batches (id, user_id, status, summary, items, created_at, completed_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT (id) DO UPDATE
+		 SET status = excluded.status, summary = excluded.summary,
+		     items = excluded.items, completed_at = excluded.completed_at`,
+		batch.BatchID, batch.UserID, batch.Status, summary, items, ts(batch.CreatedAt), tsPtr(batch.CompletedAt),
+	)
+	return err
+}
+
+func (s *Store) GetBatch(ctx context.Context, batchID string) (*model.BatchResponse, error) {
+	var batch model.BatchResponse
+	err := s.db.QueryRowContext(ctx,
+		`SELECT id, user_id, status, summary, items, created_at, completed_at
+		 FROM scan_batches WHERE id = ?`,
+		batchID,
+	).Scan(&batch.BatchID, &batch.UserID, &batch.Status, jsonCol{&batch.Summary}, jsonCol{&batch.Items},
+		timeCol{&batch.CreatedAt}, nullTimeCol{&batch.CompletedAt})
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &batch, nil
+}
+
+func (s *Store) GetDailyUsage(ctx context.Context, from, to time.Time) ([]model.UsageAggregate, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT substr(created_at, 1, 10) AS day, provider, model,
+		        COUNT(*), COUNT(DISTINCT scan_id),
+		        SUM(input_tokens), SUM(output_tokens), SUM(thinking_tokens), SUM(units), SUM(cost_usd)
+		 FROM scan_usage
+		 WHERE created_at >= ? AND created_at < ?
+		 GROUP BY 1, 2, 3
+		 ORDER BY 1 DESC, 2, 3`,
+		ts(from), ts(to),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []model.UsageAggregate
+	for rows.Next() {
+		var a model.UsageAggregate
+		if err := rows.Scan(timeCol{&a.Day}, &a.Provider, &a.Model, &a.Calls, &a.Scans,
+			&a.InputTokens, &a.OutputTokens, &a.ThinkingTokens, &a.Units, &a.CostUSD); err != nil {
+			return nil, err
+		}
+		items = append(items, a)
+	}
+	return items, rows.Err()
+}
+
+func (s *Store) GetPromptStats(ctx context.Context, from, to time.Time) ([]model.PromptStats, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT prompt_version, COUNT(*),
+		        COUNT(*) FILTER (WHERE status = 'confirmed'),
+		        COUNT(*) FILTER (WHERE status = 'needs_confirmation'),
+		        COUNT(*) FILTER (WHERE status = 'rejected'),
+		        COALESCE(AVG(confidence), 0),
+		        COALESCE(AVG(json_array_length(extracted_numbers)) FILTER (WHERE status <> 'rejected'), 0)
+		 FROM scans
+		 WHERE created_at >= ? AND created_at < ?
+		 GROUP BY prompt_version
+		 ORDER BY prompt_version`,
+		ts(from), ts(to),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []model.PromptStats
+	for rows.Next() {
+		var ps model.PromptStats
+		if err := rows.Scan(&ps.PromptVersion, &ps.Scans, &ps.Confirmed, &ps.NeedsConfirmation, &ps.Rejected, &ps.AvgConfidence, &ps.AvgNumbers); err != nil {
+			return nil, err
+		}
+		items = append(items, ps)
+	}
+	return items, rows.Err()
+}
+
+func (s *Store) GetSuspiciousCards(ctx context.Context, from, to time.Time) ([]model.SuspiciousCard, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`WITH keyed AS (
+		     SELECT 'duplicate_layout' AS reason, card_fingerprint AS group_key, * FROM scans WHERE card_fingerprint IS NOT NULL
+		     UNION ALL
+		     SELECT 'duplicate_ticket_id', ticket_id, * FROM scans WHERE ticket_id IS NOT NULL AND status <> 'rejected'
+		 ), flagged AS (
+		     SELECT reason, group_key,
+		            COUNT(DISTINCT user_id) + MAX(CASE WHEN user_id IS NULL THEN 1 ELSE 0 END) AS registrants,
+		            COUNT(DISTINCT card_fingerprint) AS layouts
+		     FROM keyed
+		     GROUP BY reason, group_key
+		     HAVING MAX(created_at) >= ? AND MIN(created_at) < ?
+		 )
+		 SELECT f.reason, f.group_key, f.registrants, f.layouts,
+		        k.id, k.user_id, k.ticket_id, k.card_fingerprint, k.status, k.created_at
+		 FROM flagged f
+		 JOIN keyed k ON k.reason = f.reason AND k.group_key = f.group_key
+		 WHERE f.registrants > 1 OR (f.reason = 'duplicate_ticket_id' AND f.layouts > 1)
+		 ORDER BY f.registrants DESC, f.reason, f.group_key, k.created_at`,
+		ts(from), ts(to),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []model.SuspiciousCard
+	for rows.Next() {
+		var card model.SuspiciousCard
+		var sc model.SuspiciousScan
+		if err := rows.Scan(&card.Reason, &card.Key, &card.Registrants, &card.Layouts,
+			&sc.ScanID, &sc.UserID, &sc.TicketID, &sc.Fingerprint, &sc.Status, timeCol{&sc.CreatedAt}); err != nil {
+			return nil, err
+		}
+		if n := len(items); n > 0 && items[n-1].Reason == card.Reason && items[n-1].Key == card.Key {
+			items[n-1].Scans = append(items[n-1].Scans, sc)
+			continue
+		}
+		card.Scans = []model.SuspiciousScan{sc}
+		items = append(items, card)
+	}
+	return items, rows.Err()
+}
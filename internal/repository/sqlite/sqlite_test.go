@@ -0,0 +1,22 @@
+package sqlite_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"loto/internal/repository/conformance"
+	"loto/internal/repository/sqlite"
+)
+
+func TestConformance(t *testing.T) {
+	db, err := sqlite.Open(filepath.Join(t.TempDir(), "loto.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := conformance.Run(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"loto/internal/model"
+)
+
+// Store is everything the service persists. Repository keeps it in Postgres;
+// the sqlite and memory packages are drop-in alternatives for running on a
+// laptop or in tests. Package conformance checks that they all behave alike.
+type Store interface {
+	ScanStore
+	BatchStore
+	StatsStore
+	UserStore
+	APIKeyStore
+}
+
+// ScanStore holds scans and the lottery results they are checked against.
+type ScanStore interface {
+	// SaveScan stores the scan with its provider usage, assigning its ID and
+	// CreatedAt unless they are set. It returns ErrConflict when a scan with
+	// the ID exists.
+	SaveScan(ctx context.Context, scan *model.Scan) error
+	GetScanByID(ctx context.Context, scanID string) (*model.Scan, error)
+	GetScansByUserID(ctx context.Context, userID string, f ScanFilter) ([]model.ScanHistoryItem, error)
+	FindDuplicates(ctx context.Context, scan *model.Scan) ([]string, error)
+	FindMatchingResults(ctx context.Context, numbers []int) ([]model.LotteryResult, error)
+	SaveLotteryResults(ctx context.Context, results []model.LotteryResult) error
+}
+
+type BatchStore interface {
+	SaveBatch(ctx context.Context, batch *model.BatchResponse) error
+	GetBatch(ctx context.Context, batchID string) (*model.BatchResponse, error)
+}
+
+// StatsStore aggregates scans for the admin endpoints over [from, to).
+type StatsStore interface {
+	GetDailyUsage(ctx context.Context, from, to time.Time) ([]model.UsageAggregate, error)
+	GetPromptStats(ctx context.Context, from, to time.Time) ([]model.PromptStats, error)
+	GetSuspiciousCards(ctx context.Context, from, to time.Time) ([]model.SuspiciousCard, error)
+}
+
+type UserStore interface {
+	CreateUser(ctx context.Context, user *model.User) error
+	GetUserByID(ctx context.Context, userID string) (*model.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*model.User, error)
+	GetUserByDeviceID(ctx context.Context, deviceID string) (*model.User, error)
+	UpgradeUser(ctx context.Context, userID, email, passwordHash string) (*model.User, error)
+	SaveRefreshToken(ctx context.Context, userID, tokenHash string, expires time.Time) error
+	UseRefreshToken(ctx context.Context, tokenHash string) (string, error)
+	RevokeRefreshToken(ctx context.Context, tokenHash string) error
+}
+
+type APIKeyStore interface {
+	CreateAPIKey(ctx context.Context, key *model.APIKey, keyHash string) error
+	ListAPIKeys(ctx context.Context) ([]model.APIKey, error)
+	GetAPIKey(ctx context.Context, keyID string) (*model.APIKey, error)
+	GetActiveAPIKey(ctx context.Context, keyHash string) (*model.APIKey, error)
+	RotateAPIKey(ctx context.Context, oldID string, next *model.APIKey, keyHash string, grace time.Duration) error
+	RevokeAPIKey(ctx context.Context, keyID string) error
+	RecordAPIKeyUse(ctx context.Context, keyID string, failed bool) error
+	GetAPIKeyUsage(ctx context.Context, keyID string, from, to time.Time) ([]model.APIKeyUsage, error)
+}
+
+// HealthReporter is implemented by stores whose database can be out of
+// reach, such as reconnect.Store.
+type HealthReporter interface {
+	Health() model.DatabaseHealth
+}
+
+var _ Store = (*Repository)(nil)
@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"loto/internal/model"
+)
+
+// ErrConflict is returned when a record violates a unique constraint, e.g.
+// an email that is already registered.
+var ErrConflict = errors.New("already exists")
+
+const uniqueViolation = "23505"
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation
+}
+
+const userColumns = `id, email, password_hash, device_id, created_at`
+
+func scanUser(row pgx.Row) (*model.User, error) {
+	var u model.User
+	err := row.Scan(&u.ID, &u.Email, &u.PasswordHash, &u.DeviceID, &u.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	u.Anonymous = u.Email == nil
+	return &u, nil
+}
+
+// CreateUser inserts an email or device account. Emails are stored lower
+// case.
+func (r *Repository) CreateUser(ctx context.Context, user *model.User) error {
+	user.ID = uuid.NewString()
+	user.CreatedAt = time.Now().UTC()
+	if user.Email != nil {
+		email := strings.ToLower(*user.Email)
+		user.Email = &email
+	}
+	user.Anonymous = user.Email == nil
+
+	_, err := r.db.Exec(ctx,
+		`INSERT INTO users (id, email, password_hash, device_id, created_at, updated_at)
+		 VALUES ($1, $2, $3, $4, $5, $5)`,
+		user.ID, user.Email, user.PasswordHash, user.DeviceID, user.CreatedAt,
+	)
+	if isUniqueViolation(err) {
+		return ErrConflict
+	}
+	return err
+}
+
+func (r *Repository) GetUserByID(ctx context.Context, userID string) (*model.User, error) {
+	return scanUser(r.db.QueryRow(ctx,
+		`SELECT `+userColumns+` FROM users WHERE id = $1`, userID))
+}
+
+func (r *Repository) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	return scanUser(r.db.QueryRow(ctx,
+		`SELECT `+userColumns+` FROM users WHERE LOWER(email) = LOWER($1)`, email))
+}
+
+func (r *Repository) GetUserByDeviceID(ctx context.Context, deviceID string) (*model.User, error) {
+	return scanUser(r.db.QueryRow(ctx,
+		`SELECT `+userColumns+` FROM users WHERE device_id = $1`, deviceID))
+}
+
+// UpgradeUser adds an email and password to an anonymous account and
+// detaches it from its device ID, so the device can start a fresh anonymous
+// account after logging out. It returns ErrNotFound when the account does not
+// exist or already has an email.
+func (r *Repository) UpgradeUser(ctx context.Context, userID, email, passwordHash string) (*model.User, error) {
+	user, err := scanUser(r.db.QueryRow(ctx,
+		`UPDATE users
+		 SET email = $2, password_hash = $3, device_id = NULL, updated_at = NOW()
+		 WHERE id = $1 AND email IS NULL
+		 RETURNING `+userColumns,
+		userID, strings.ToLower(email), passwordHash,
+	))
+	if isUniqueViolation(err) {
+		return nil, ErrConflict
+	}
+	return user, err
+}
+
+func (r *Repository) SaveRefreshToken(ctx context.Context, userID, tokenHash string, expires time.Time) error {
+	_, err := r.db.Exec(ctx,
+		`INSERT INTO refresh_tokens (id, user_id, token_hash, expires_at)
+		 VALUES ($1, $2, $3, $4)`,
+		uuid.NewString(), userID, tokenHash, expires,
+	)
+	return err
+}
+
+// UseRefreshToken revokes a live refresh token and returns its user, so each
+// token is exchanged at most once. Presenting a token that was already used
+// means it leaked: every session of its user is revoked and ErrNotFound is
+// returned, as for unknown and expired tokens.
+func (r *Repository) UseRefreshToken(ctx context.Context, tokenHash string) (string, error) {
+	var userID string
+	err := r.db.QueryRow(ctx,
+		`UPDATE refresh_tokens SET revoked_at = NOW()
+		 WHERE token_hash = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		 RETURNING user_id`,
+		tokenHash,
+	).Scan(&userID)
+	if err == nil {
+		return userID, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return "", err
+	}
+
+	_, err = r.db.Exec(ctx,
+		`UPDATE refresh_tokens SET revoked_at = NOW()
+		 WHERE revoked_at IS NULL
+		   AND user_id = (SELECT user_id FROM refresh_tokens WHERE token_hash = $1 AND revoked_at IS NOT NULL)`,
+		tokenHash,
+	)
+	if err != nil {
+		return "", err
+	}
+	return "", ErrNotFound
+}
+
+func (r *Repository) RevokeRefreshToken(ctx context.Context, tokenHash string) error {
+	_, err := r.db.Exec(ctx,
+		`UPDATE refresh_tokens SET revoked_at = NOW()
+		 WHERE token_hash = $1 AND revoked_at IS NULL`,
+		tokenHash,
+	)
+	return err
+}
@@ -0,0 +1,150 @@
+package scan
+
+import (
+	"image"
+	"sort"
+	"strings"
+
+	"loto/internal/model"
+	"loto/internal/ocr"
+)
+
+// minCardNumbers is the fewest numeric tokens a region needs to count as a
+// card of its own. A card prints 45 numbers and a single block 15, so a split
+// between two blocks of one card never qualifies.
+const minCardNumbers = 30
+
+// cardGap is the smallest empty gap, in median token sizes, that can
+// separate two cards.
+const cardGap = 1.5
+
+// DetectCards finds the cards in a photo from the positions of its numeric
+// OCR tokens. The tokens are cut recursively at the widest empty horizontal
+// or vertical gap that leaves at least minCardNumbers on both sides, so cards
+// lying side by side or stacked are separated while stray numbers from cards
+// at the edge of the photo stay with their neighbour. Each region is padded by
+// one token size. It returns nil when there are no numeric tokens.
+func DetectCards(tokens []model.OCRToken) []image.Rectangle {
+	pts := numericTokens(tokens)
+	if len(pts) == 0 {
+		return nil
+	}
+
+	var widths, heights []float64
+	for _, p := range pts {
+		widths = append(widths, float64(p.w))
+		heights = append(heights, float64(p.h))
+	}
+	medW, medH := median(widths), median(heights)
+
+	var regions []image.Rectangle
+	var split func(pts []placedToken)
+	split = func(pts []placedToken) {
+		if left, right, ok := cutCards(pts, medW, medH); ok {
+			split(left)
+			split(right)
+			return
+		}
+		pad := int(max(medW, medH))
+		regions = append(regions, bounds(pts).Inset(-pad))
+	}
+	split(pts)
+
+	// Reading order: cards on the same level left to right, then downwards.
+	sort.Slice(regions, func(i, j int) bool {
+		a, b := regions[i], regions[j]
+		if sameLevel(a, b) {
+			return a.Min.X < b.Min.X
+		}
+		return a.Min.Y < b.Min.Y
+	})
+	return regions
+}
+
+// cutCards splits pts at the widest qualifying gap across either axis.
+func cutCards(pts []placedToken, medW, medH float64) ([]placedToken, []placedToken, bool) {
+	if len(pts) < 2*minCardNumbers {
+		return nil, nil, false
+	}
+
+	var best float64
+	var left, right []placedToken
+	for _, vertical := range []bool{false, true} {
+		span := func(p placedToken) (float64, float64) {
+			if vertical {
+				return float64(p.y), float64(p.y + p.h)
+			}
+			return float64(p.x), float64(p.x + p.w)
+		}
+		minGap := cardGap * medW
+		if vertical {
+			minGap = cardGap * medH
+		}
+
+		sorted := append([]placedToken(nil), pts...)
+		sort.Slice(sorted, func(i, j int) bool {
+			a, _ := span(sorted[i])
+			b, _ := span(sorted[j])
+			return a < b
+		})
+
+		_, reach := span(sorted[0])
+		for i := 1; i < len(sorted); i++ {
+			start, end := span(sorted[i])
+			gap := start - reach
+			if gap >= minGap && gap > best && i >= minCardNumbers && len(sorted)-i >= minCardNumbers {
+				best = gap
+				left, right = sorted[:i], sorted[i:]
+			}
+			reach = max(reach, end)
+		}
+	}
+	return left, right, left != nil
+}
+
+func bounds(pts []placedToken) image.Rectangle {
+	r := image.Rect(pts[0].x, pts[0].y, pts[0].x+pts[0].w, pts[0].y+pts[0].h)
+	for _, p := range pts[1:] {
+		r = r.Union(image.Rect(p.x, p.y, p.x+p.w, p.y+p.h))
+	}
+	return r
+}
+
+// sameLevel reports whether the vertical centres of a and b are within half
+// the shorter height of each other.
+func sameLevel(a, b image.Rectangle) bool {
+	ca := (a.Min.Y + a.Max.Y) / 2
+	cb := (b.Min.Y + b.Max.Y) / 2
+	d := ca - cb
+	if d < 0 {
+		d = -d
+	}
+	return d < min(a.Dy(), b.Dy())/2
+}
+
+// cropOCR keeps the tokens whose centre lies in r, shifted into r's
+// coordinates, and recomputes the numbers, text and confidence from them.
+// Usage is left empty for the caller to assign.
+func cropOCR(res *model.OCRScanResult, r image.Rectangle) *model.OCRScanResult {
+	sub := &model.OCRScanResult{Provider: res.Provider}
+	var texts []string
+	var total float64
+	for _, t := range res.Tokens {
+		center := image.Pt(t.X+t.Width/2, t.Y+t.Height/2)
+		if !center.In(r) {
+			continue
+		}
+		t.X -= r.Min.X
+		t.Y -= r.Min.Y
+		sub.Tokens = append(sub.Tokens, t)
+		sub.Numbers = append(sub.Numbers, ocr.SplitLOTONumbers(t.Text)...)
+		texts = append(texts, t.Text)
+		total += t.Confidence
+	}
+	if len(sub.Tokens) > 0 {
+		sub.Confidence = total / float64(len(sub.Tokens))
+	}
+	sub.FullText = strings.Join(texts, " ")
+	sort.Ints(sub.Numbers)
+	return sub
+}
@@ -0,0 +1,110 @@
+package scan
+
+import (
+	"loto/internal/model"
+	"loto/internal/validator"
+)
+
+// Per-cell confidence adjustments relative to the card-level AI confidence.
+const (
+	agreedBonus     = 0.1
+	movedPenalty    = 0.9
+	unseenPenalty   = 0.85
+	disputedPenalty = 0.6
+	correctedFactor = 0.6
+)
+
+type cellKey struct{ block, row, col int }
+
+// AnnotateCells scores every number in resp.Blocks. OCR readings come from
+// resp.OCRLayout: a number OCR read in the same row agrees with the AI, one
+// OCR read elsewhere on the card is likely misplaced, one where OCR read a
+// different number in that cell is disputed. Cells the reconciler settled
+// take its source; numbers rewritten by the structure check are marked
+// corrected.
+func AnnotateCells(resp *model.GPTScanResponse) {
+	resp.Cells = nil
+	if resp.LotteryType != "LOTO" || len(resp.Blocks) == 0 {
+		return
+	}
+
+	inRow := make(map[[3]int]float64)
+	anywhere := make(map[int]float64)
+	byCell := make(map[cellKey]int)
+	if resp.OCRLayout != nil {
+		for _, c := range resp.OCRLayout.Cells {
+			k := [3]int{c.Block, c.Row, c.Number}
+			inRow[k] = max(inRow[k], c.Confidence)
+			anywhere[c.Number] = max(anywhere[c.Number], c.Confidence)
+			byCell[cellKey{c.Block, c.Row, c.Col}] = c.Number
+		}
+	}
+
+	decided := make(map[[3]int]model.ReconcileDecision)
+	for _, d := range resp.Reconciliation {
+		if d.Chosen != 0 {
+			decided[[3]int{d.Block, d.Row, d.Chosen}] = d
+		}
+	}
+
+	corrected := make(map[[3]int]bool)
+	for _, c := range resp.Corrections {
+		corrected[[3]int{c.Block, c.Row, c.To}] = true
+	}
+
+	aiConf := resp.Confidence
+	for b, block := range resp.Blocks {
+		for r, row := range [][]int{block.Row1, block.Row2, block.Row3} {
+			for i, n := range row {
+				cell := model.CellDetail{
+					Block:  b + 1,
+					Row:    r + 1,
+					Index:  i + 1,
+					Col:    validator.DecadeColumn(n),
+					Number: n,
+				}
+				key := [3]int{b + 1, r + 1, n}
+
+				switch {
+				case resp.Mode == model.ModeOCR:
+					cell.Source = model.CellSourceOCR
+					cell.Confidence = inRow[key]
+					if cell.Confidence == 0 {
+						cell.Confidence = aiConf
+					}
+				case resp.OCRLayout == nil:
+					cell.Source = model.CellSourceAI
+					cell.Confidence = aiConf
+				case decided[key].OCR != 0 && decided[key].AI != 0 && decided[key].OCR != decided[key].AI:
+					cell.Source = decided[key].Source
+					cell.Confidence = aiConf * disputedPenalty
+					if cell.Source == model.CellSourceOCR {
+						cell.Confidence = inRow[key] * disputedPenalty
+					}
+				case decided[key].Source == model.CellSourceOCR:
+					cell.Source = model.CellSourceOCR
+					cell.Confidence = inRow[key] * unseenPenalty
+				case inRow[key] > 0:
+					cell.Source = model.CellSourceBoth
+					cell.Confidence = (aiConf+inRow[key])/2 + agreedBonus
+				case anywhere[n] > 0:
+					cell.Source = model.CellSourceBoth
+					cell.Confidence = (aiConf + anywhere[n]) / 2 * movedPenalty
+				default:
+					cell.Source = model.CellSourceAI
+					cell.Confidence = aiConf * unseenPenalty
+					if other, ok := byCell[cellKey{b + 1, r + 1, cell.Col}]; ok && other != n {
+						cell.Confidence = aiConf * disputedPenalty
+					}
+				}
+
+				if corrected[key] {
+					cell.Source = model.CellSourceCorrected
+					cell.Confidence *= correctedFactor
+				}
+				cell.Confidence = max(0, min(cell.Confidence, 1))
+				resp.Cells = append(resp.Cells, cell)
+			}
+		}
+	}
+}
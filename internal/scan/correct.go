@@ -0,0 +1,343 @@
+package scan
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"loto/internal/model"
+	"loto/internal/validator"
+)
+
+// confusable lists digits OCR and vision models commonly mistake for each
+// other on printed Lô Tô cards.
+var confusable = map[byte]string{
+	'0': "68",
+	'1': "47",
+	'3': "8",
+	'4': "1",
+	'5': "6",
+	'6': "058",
+	'7': "1",
+	'8': "0369",
+	'9': "8",
+}
+
+// alternatives returns the numbers reachable from n by swapping one digit
+// for a confusable one.
+func alternatives(n int) []int {
+	s := strconv.Itoa(n)
+	var out []int
+	for i := 0; i < len(s); i++ {
+		for _, d := range []byte(confusable[s[i]]) {
+			b := []byte(s)
+			b[i] = d
+			v, _ := strconv.Atoi(string(b))
+			if v >= 1 && v <= 90 && v != n {
+				out = append(out, v)
+			}
+		}
+	}
+	return out
+}
+
+// Correct fixes the cells of an OCR grid whose number does not belong in the
+// column it was printed in, when exactly one confusable reading fits that
+// column and is not already on the card.
+func (g *Grid) Correct() []model.Correction {
+	onCard := make(map[int]int)
+	for _, block := range g.Cells {
+		for _, row := range block {
+			for _, cell := range row {
+				if cell.Number != 0 {
+					onCard[cell.Number]++
+				}
+			}
+		}
+	}
+
+	var fixes []model.Correction
+	for b := range g.Cells {
+		for r := range g.Cells[b] {
+			for c := range g.Cells[b][r] {
+				cell := &g.Cells[b][r][c]
+				if cell.Number == 0 || validator.DecadeColumn(cell.Number) == c+1 {
+					continue
+				}
+
+				var fits []int
+				for _, alt := range alternatives(cell.Number) {
+					if validator.DecadeColumn(alt) == c+1 && onCard[alt] == 0 {
+						fits = append(fits, alt)
+					}
+				}
+				if len(fits) != 1 {
+					continue
+				}
+
+				fixes = append(fixes, model.Correction{
+					Block:  b + 1,
+					Row:    r + 1,
+					From:   cell.Number,
+					To:     fits[0],
+					Reason: fmt.Sprintf("printed in column %d", c+1),
+				})
+				onCard[cell.Number]--
+				onCard[fits[0]]++
+				cell.Number = fits[0]
+			}
+		}
+	}
+	return fixes
+}
+
+// CorrectBlocks fixes numbers that break the card structure. For a number
+// that is out of range, or a set of numbers sharing a column in one row, a
+// number is replaced only when it is the one member of the clash with exactly
+// one fitting confusable reading; ties between readings are broken by keeping
+// the block's columns in ascending order. A number that appears twice on the
+// card is handled the same way across its copies. Clashes without such a
+// signal are left for the validator to report. The input is not modified.
+func CorrectBlocks(blocks []model.Block) ([]model.Block, []model.Correction) {
+	c := newCardFixer(blocks)
+
+	for b := range c.grid {
+		for r, row := range c.grid[b] {
+			for _, clash := range clashes(row) {
+				var pick, to int
+				single := 0
+				for _, i := range clash {
+					if fits := c.fits(b, r, i); len(fits) == 1 {
+						single++
+						pick, to = i, fits[0]
+					}
+				}
+				if single == 1 {
+					c.apply(b, r, pick, to, "card structure")
+				}
+			}
+		}
+	}
+
+	dups := c.duplicates()
+	var dupNumbers []int
+	for n := range dups {
+		dupNumbers = append(dupNumbers, n)
+	}
+	sort.Ints(dupNumbers)
+	for _, n := range dupNumbers {
+		positions := dups[n]
+		var pick []int
+		var to int
+		for pi, p := range positions {
+			if fits := c.fits(p[0], p[1], p[2]); len(fits) == 1 {
+				pick = append(pick, pi)
+				to = fits[0]
+			}
+		}
+		if len(pick) == 1 {
+			p := positions[pick[0]]
+			c.apply(p[0], p[1], p[2], to, fmt.Sprintf("%d appears twice on the card", n))
+		}
+	}
+
+	out := make([]model.Block, len(c.grid))
+	for b, rows := range c.grid {
+		for _, row := range rows {
+			sort.Ints(row)
+		}
+		out[b] = model.Block{Row1: rows[0], Row2: rows[1], Row3: rows[2]}
+	}
+	return out, c.fixes
+}
+
+type cardFixer struct {
+	grid   [][][]int
+	onCard map[int]int
+	fixes  []model.Correction
+}
+
+func newCardFixer(blocks []model.Block) *cardFixer {
+	c := &cardFixer{grid: make([][][]int, len(blocks)), onCard: make(map[int]int)}
+	for b, block := range blocks {
+		c.grid[b] = [][]int{
+			append([]int(nil), block.Row1...),
+			append([]int(nil), block.Row2...),
+			append([]int(nil), block.Row3...),
+		}
+		for _, row := range c.grid[b] {
+			for _, n := range row {
+				c.onCard[n]++
+			}
+		}
+	}
+	return c
+}
+
+// fits returns the confusable readings of grid[b][r][i] that are not on the
+// card and leave the row structurally valid.
+func (c *cardFixer) fits(b, r, i int) []int {
+	row := c.grid[b][r]
+	n := row[i]
+	var fits []int
+	for _, alt := range alternatives(n) {
+		if c.onCard[alt] > 0 {
+			continue
+		}
+		row[i] = alt
+		if !misfit(row, i) {
+			fits = append(fits, alt)
+		}
+		row[i] = n
+	}
+	if len(fits) > 1 {
+		fits = keepColumnOrder(c.grid[b], r, fits)
+	}
+	return fits
+}
+
+func (c *cardFixer) apply(b, r, i, to int, reason string) {
+	from := c.grid[b][r][i]
+	c.fixes = append(c.fixes, model.Correction{Block: b + 1, Row: r + 1, From: from, To: to, Reason: reason})
+	c.onCard[from]--
+	c.onCard[to]++
+	c.grid[b][r][i] = to
+}
+
+// duplicates maps each number on the card more than once to its positions.
+func (c *cardFixer) duplicates() map[int][][3]int {
+	out := make(map[int][][3]int)
+	for b, rows := range c.grid {
+		for r, row := range rows {
+			for i, n := range row {
+				if c.onCard[n] > 1 {
+					out[n] = append(out[n], [3]int{b, r, i})
+				}
+			}
+		}
+	}
+	return out
+}
+
+// clashes groups the indexes of row that break its structure: each
+// out-of-range number alone, and the numbers sharing a column together.
+func clashes(row []int) [][]int {
+	var out [][]int
+	byColumn := make(map[int][]int)
+	var cols []int
+	for i, n := range row {
+		if n < 1 || n > 90 {
+			out = append(out, []int{i})
+			continue
+		}
+		col := validator.DecadeColumn(n)
+		if byColumn[col] == nil {
+			cols = append(cols, col)
+		}
+		byColumn[col] = append(byColumn[col], i)
+	}
+	for _, col := range cols {
+		if len(byColumn[col]) > 1 {
+			out = append(out, byColumn[col])
+		}
+	}
+	return out
+}
+
+// misfit reports whether row[i] is out of range or shares its column with
+// another number in the row.
+func misfit(row []int, i int) bool {
+	n := row[i]
+	if n < 1 || n > 90 {
+		return true
+	}
+	col := validator.DecadeColumn(n)
+	for j, m := range row {
+		if j != i && m >= 1 && m <= 90 && validator.DecadeColumn(m) == col {
+			return true
+		}
+	}
+	return false
+}
+
+func keepColumnOrder(block [][]int, r int, candidates []int) []int {
+	var ordered []int
+	for _, cand := range candidates {
+		col := validator.DecadeColumn(cand)
+		ok := true
+		for rr, row := range block {
+			for _, m := range row {
+				if validator.DecadeColumn(m) != col {
+					continue
+				}
+				if (rr < r && m >= cand) || (rr > r && m <= cand) {
+					ok = false
+				}
+			}
+		}
+		if ok {
+			ordered = append(ordered, cand)
+		}
+	}
+	return ordered
+}
+
+// ApplyCorrections runs the structural corrector on a LOTO response, keeps
+// AllNumbers in step with the corrected blocks, records the remaining
+// violations and re-scores confidence: each correction costs 2% and each
+// remaining structural error 5%.
+func ApplyCorrections(resp *model.GPTScanResponse) {
+	if resp.LotteryType != "LOTO" || len(resp.Blocks) == 0 {
+		return
+	}
+
+	blocks, fixes := CorrectBlocks(resp.Blocks)
+	resp.Blocks = blocks
+	resp.Corrections = append(resp.Corrections, fixes...)
+
+	if len(fixes) > 0 {
+		inBlocks := make(map[int]struct{})
+		for _, b := range blocks {
+			for _, row := range [][]int{b.Row1, b.Row2, b.Row3} {
+				for _, n := range row {
+					inBlocks[n] = struct{}{}
+				}
+			}
+		}
+		nums := make(map[int]struct{}, len(resp.AllNumbers))
+		for _, n := range resp.AllNumbers {
+			nums[n] = struct{}{}
+		}
+		for _, f := range fixes {
+			if _, ok := inBlocks[f.From]; !ok {
+				delete(nums, f.From)
+			}
+			nums[f.To] = struct{}{}
+		}
+		resp.AllNumbers = resp.AllNumbers[:0]
+		for n := range nums {
+			resp.AllNumbers = append(resp.AllNumbers, n)
+		}
+		sort.Ints(resp.AllNumbers)
+	}
+
+	resp.Violations = validator.ValidateLOTOCard(resp.Blocks)
+	errs := validator.CountErrors(resp.Violations)
+	resp.Confidence = rescore(resp.Confidence, len(fixes), errs)
+
+	if len(fixes) > 0 || errs > 0 {
+		resp.Notes = appendNote(resp.Notes, fmt.Sprintf("structure check: %d corrected, %d errors remaining", len(fixes), errs))
+	}
+}
+
+func rescore(confidence float64, corrections, errors int) float64 {
+	c := confidence * (1 - 0.02*float64(corrections)) * (1 - 0.05*float64(errors))
+	return max(0, min(c, 1))
+}
+
+func appendNote(notes, note string) string {
+	if notes == "" {
+		return note
+	}
+	return notes + "; " + note
+}
@@ -0,0 +1,129 @@
+package scan
+
+import (
+	"reflect"
+	"testing"
+
+	"loto/internal/model"
+)
+
+func TestCorrectBlocks(t *testing.T) {
+	tests := []struct {
+		name   string
+		blocks []model.Block
+		want   [][]int
+		fixes  []model.Correction
+	}{
+		{
+			// 61 could also be 51 or 81; 60 can only be 80 since 50 is taken.
+			name: "second of a clash",
+			blocks: []model.Block{
+				{Row1: []int{1, 22, 41, 61, 60}},
+				{Row1: []int{7, 18, 29, 50, 75}},
+			},
+			want:  [][]int{{1, 22, 41, 61, 80}, {7, 18, 29, 50, 75}},
+			fixes: []model.Correction{{Block: 1, Row: 1, From: 60, To: 80, Reason: "card structure"}},
+		},
+		{
+			// 14 could be 44 or 74; 12 can only be 72 since 42 is taken.
+			name: "last of a clash",
+			blocks: []model.Block{
+				{Row1: []int{5, 14, 30, 50, 12}},
+				{Row1: []int{3, 42, 66, 79, 88}},
+			},
+			want:  [][]int{{5, 14, 30, 50, 72}, {3, 42, 66, 79, 88}},
+			fixes: []model.Correction{{Block: 1, Row: 1, From: 12, To: 72, Reason: "card structure"}},
+		},
+		{
+			name:   "13 and 18 both have two readings",
+			blocks: []model.Block{{Row1: []int{13, 18, 25, 34, 56}}},
+			want:   [][]int{{13, 18, 25, 34, 56}},
+		},
+		{
+			// 61 can only be 81 and 60 can only be 80: no way to tell.
+			name: "61 and 60 both have one reading",
+			blocks: []model.Block{
+				{Row1: []int{1, 22, 41, 61, 60}},
+				{Row1: []int{7, 18, 29, 50, 75}},
+				{Row1: []int{4, 11, 33, 51, 86}},
+			},
+			want: [][]int{{1, 22, 41, 60, 61}, {7, 18, 29, 50, 75}, {4, 11, 33, 51, 86}},
+		},
+		{
+			name:   "out of range",
+			blocks: []model.Block{{Row1: []int{3, 14, 35, 52, 97}}},
+			want:   [][]int{{3, 14, 35, 52, 87}},
+			fixes:  []model.Correction{{Block: 1, Row: 1, From: 97, To: 87, Reason: "card structure"}},
+		},
+		{
+			name:   "valid card",
+			blocks: testCard,
+			want:   [][]int{testCard[0].Row1, testCard[1].Row1, testCard[2].Row1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := clone(tt.blocks)
+			got, fixes := CorrectBlocks(in)
+			if !reflect.DeepEqual(in, tt.blocks) {
+				t.Errorf("input modified: %v", in)
+			}
+			for b, row := range tt.want {
+				if !reflect.DeepEqual(got[b].Row1, row) {
+					t.Errorf("block %d row 1 = %v, want %v", b+1, got[b].Row1, row)
+				}
+			}
+			if !reflect.DeepEqual(fixes, tt.fixes) {
+				t.Errorf("fixes = %+v, want %+v", fixes, tt.fixes)
+			}
+		})
+	}
+}
+
+func TestFits(t *testing.T) {
+	tests := []struct {
+		name   string
+		blocks []model.Block
+		index  int
+		want   []int
+	}{
+		{"two readings", []model.Block{{Row1: []int{1, 22, 41, 61, 60}}}, 3, []int{51, 81}},
+		{"reading on the card", []model.Block{{Row1: []int{1, 22, 41, 61, 60}}, {Row1: []int{50}}}, 4, []int{80}},
+		{
+			// 51 would sit above 50 in column 6.
+			name:   "column order",
+			blocks: []model.Block{{Row1: []int{1, 22, 41, 61, 60}, Row2: []int{50}}},
+			index:  3,
+			want:   []int{81},
+		},
+		{"no reading", []model.Block{{Row1: []int{21, 22}}}, 1, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newCardFixer(tt.blocks).fits(0, 0, tt.index); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("fits = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMisfit(t *testing.T) {
+	tests := []struct {
+		row   []int
+		index int
+		want  bool
+	}{
+		{[]int{3, 14, 35, 52, 71}, 2, false},
+		{[]int{3, 14, 35, 52, 58}, 4, true},
+		{[]int{3, 14, 35, 52, 58}, 3, true},
+		{[]int{3, 14, 35, 52, 58}, 0, false},
+		{[]int{80, 90}, 0, true},
+		{[]int{3, 14, 95}, 2, true},
+		{[]int{0, 3}, 1, false},
+	}
+	for _, tt := range tests {
+		if got := misfit(tt.row, tt.index); got != tt.want {
+			t.Errorf("misfit(%v, %d) = %v, want %v", tt.row, tt.index, got, tt.want)
+		}
+	}
+}
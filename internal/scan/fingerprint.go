@@ -0,0 +1,48 @@
+package scan
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"loto/internal/model"
+)
+
+// Fingerprint returns a canonical hash of a complete LOTO card, so the same
+// printed card scanned twice, by anyone and from any photo, hashes the same.
+// Each row's numbers are sorted, and the blocks are sorted as well, so a card
+// whose blocks were read in a different order (or cut apart and reassembled)
+// still matches. It returns "" unless the card has 3 blocks of 3 rows with 5
+// numbers each, since a partial reading would match unrelated cards.
+func Fingerprint(lotteryType string, blocks []model.Block) string {
+	if lotteryType != "LOTO" || len(blocks) != gridBlocks {
+		return ""
+	}
+
+	canon := make([]string, len(blocks))
+	for b, block := range blocks {
+		rows := make([]string, gridRows)
+		for r, row := range [][]int{block.Row1, block.Row2, block.Row3} {
+			if len(row) != rowNumbers {
+				return ""
+			}
+			sorted := append([]int(nil), row...)
+			sort.Ints(sorted)
+			nums := make([]string, len(sorted))
+			for i, n := range sorted {
+				if n < 1 || n > 90 {
+					return ""
+				}
+				nums[i] = fmt.Sprint(n)
+			}
+			rows[r] = strings.Join(nums, ",")
+		}
+		canon[b] = strings.Join(rows, "|")
+	}
+	sort.Strings(canon)
+
+	sum := sha256.Sum256([]byte(strings.Join(canon, "/")))
+	return hex.EncodeToString(sum[:])
+}
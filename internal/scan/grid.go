@@ -0,0 +1,158 @@
+package scan
+
+import (
+	"sort"
+
+	"loto/internal/model"
+	"loto/internal/validator"
+)
+
+// Grid is a LOTO card reconstructed from OCR positions. Cells[b][r][c] holds
+// the reading for block b, row r, column c (0-based); Number 0 means empty.
+type Grid struct {
+	Cells [][gridRows][gridColumns]model.GridCell
+}
+
+// ReconstructGrid builds a card from OCR tokens without any LLM. When several
+// readings land in one cell the one whose decade fits the column wins, then
+// the most confident. Blocks with more than three rows (stray text picked up
+// between blocks) keep the three fullest rows. It returns nil when no numeric
+// tokens were found.
+func ReconstructGrid(tokens []model.OCRToken) *Grid {
+	blocks, cells := placeTokens(tokens)
+	if len(cells) == 0 {
+		return nil
+	}
+
+	rowCounts := make(map[[2]int]int)
+	for _, c := range cells {
+		rowCounts[[2]int{c.Block, c.Row}]++
+	}
+	rowMap := make(map[[2]int]int)
+	for b := 1; b <= blocks; b++ {
+		var rows []int
+		for r := 1; rowCounts[[2]int{b, r}] > 0; r++ {
+			rows = append(rows, r)
+		}
+		if len(rows) > gridRows {
+			sort.SliceStable(rows, func(i, j int) bool {
+				return rowCounts[[2]int{b, rows[i]}] > rowCounts[[2]int{b, rows[j]}]
+			})
+			rows = rows[:gridRows]
+			sort.Ints(rows)
+		}
+		for i, r := range rows {
+			rowMap[[2]int{b, r}] = i
+		}
+	}
+
+	g := &Grid{Cells: make([][gridRows][gridColumns]model.GridCell, blocks)}
+	for _, c := range cells {
+		ri, ok := rowMap[[2]int{c.Block, c.Row}]
+		if !ok {
+			continue
+		}
+		c.Row = ri + 1
+		slot := &g.Cells[c.Block-1][ri][c.Col-1]
+		if slot.Number == 0 || betterReading(c, *slot) {
+			*slot = c
+		}
+	}
+	return g
+}
+
+func betterReading(a, b model.GridCell) bool {
+	aFits := validator.DecadeColumn(a.Number) == a.Col
+	bFits := validator.DecadeColumn(b.Number) == b.Col
+	if aFits != bFits {
+		return aFits
+	}
+	return a.Confidence > b.Confidence
+}
+
+// Complete reports whether the grid has the standard 3 blocks.
+func (g *Grid) Complete() bool {
+	return len(g.Cells) == gridBlocks
+}
+
+// Layout returns the grid's readings, one per filled cell.
+func (g *Grid) Layout() *model.OCRLayout {
+	layout := &model.OCRLayout{Blocks: len(g.Cells)}
+	for _, block := range g.Cells {
+		for _, row := range block {
+			for _, cell := range row {
+				if cell.Number != 0 {
+					layout.Cells = append(layout.Cells, cell)
+				}
+			}
+		}
+	}
+	return layout
+}
+
+// Blocks returns the card in the response shape, each row left to right.
+func (g *Grid) Blocks() []model.Block {
+	blocks := make([]model.Block, len(g.Cells))
+	for b, block := range g.Cells {
+		rows := make([][]int, gridRows)
+		for r := range block {
+			rows[r] = []int{}
+			for _, cell := range block[r] {
+				if cell.Number != 0 {
+					rows[r] = append(rows[r], cell.Number)
+				}
+			}
+		}
+		blocks[b] = model.Block{Row1: rows[0], Row2: rows[1], Row3: rows[2]}
+	}
+	return blocks
+}
+
+// Numbers returns the unique numbers on the card, sorted ascending.
+func (g *Grid) Numbers() []int {
+	seen := make(map[int]struct{})
+	var nums []int
+	for _, block := range g.Cells {
+		for _, row := range block {
+			for _, cell := range row {
+				if cell.Number == 0 {
+					continue
+				}
+				if _, ok := seen[cell.Number]; ok {
+					continue
+				}
+				seen[cell.Number] = struct{}{}
+				nums = append(nums, cell.Number)
+			}
+		}
+	}
+	sort.Ints(nums)
+	return nums
+}
+
+// Confidence combines mean OCR confidence with how close the grid is to the
+// expected 5 numbers per row across 3 blocks.
+func (g *Grid) Confidence() float64 {
+	var filled int
+	var total float64
+	for _, block := range g.Cells {
+		for _, row := range block {
+			for _, cell := range row {
+				if cell.Number != 0 {
+					filled++
+					total += cell.Confidence
+				}
+			}
+		}
+	}
+	if filled == 0 {
+		return 0
+	}
+
+	expected := gridBlocks * gridRows * rowNumbers
+	shape := float64(min(filled, expected)) / float64(expected)
+	if filled > expected {
+		shape -= float64(filled-expected) / float64(expected)
+	}
+	return max(0, total/float64(filled)*shape)
+}
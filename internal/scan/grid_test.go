@@ -0,0 +1,151 @@
+package scan
+
+import (
+	"math"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"loto/internal/model"
+	"loto/internal/validator"
+)
+
+// testCard is a valid LOTO card: every row holds 5 numbers in distinct
+// columns and every column runs top to bottom within its block.
+var testCard = []model.Block{
+	{Row1: []int{3, 14, 35, 52, 71}, Row2: []int{21, 40, 56, 63, 85}, Row3: []int{7, 18, 29, 47, 78}},
+	{Row1: []int{1, 26, 44, 67, 80}, Row2: []int{12, 33, 58, 69, 88}, Row3: []int{9, 19, 37, 49, 74}},
+	{Row1: []int{5, 23, 51, 60, 82}, Row2: []int{16, 30, 45, 65, 77}, Row3: []int{8, 28, 39, 54, 90}},
+}
+
+// Synthetic photo geometry: 60px columns, 40px rows and 120px between
+// blocks, with 30x24 word boxes.
+const (
+	testLeft, testTop      = 100, 100
+	testColPitch           = 60
+	testRowPitch           = 40
+	testBlockPitch         = 3*testRowPitch + 80
+	testTokenW, testTokenH = 30, 24
+)
+
+// cardTokens lays blocks out as OCR word boxes, rotated by degrees about
+// the top-left corner of the photo.
+func cardTokens(blocks []model.Block, degrees float64) []model.OCRToken {
+	var tokens []model.OCRToken
+	for b, block := range blocks {
+		for r, row := range [][]int{block.Row1, block.Row2, block.Row3} {
+			for _, n := range row {
+				x := testLeft + (validator.DecadeColumn(n)-1)*testColPitch
+				y := testTop + b*testBlockPitch + r*testRowPitch
+				tokens = append(tokens, placeToken(strconv.Itoa(n), x, y, degrees))
+			}
+		}
+	}
+	return tokens
+}
+
+func placeToken(text string, x, y int, degrees float64) model.OCRToken {
+	sin, cos := math.Sincos(degrees * math.Pi / 180)
+	fx, fy := float64(x), float64(y)
+	return model.OCRToken{
+		Text:       text,
+		Confidence: 0.9,
+		X:          int(math.Round(fx*cos - fy*sin)),
+		Y:          int(math.Round(fx*sin + fy*cos)),
+		Width:      testTokenW,
+		Height:     testTokenH,
+	}
+}
+
+func TestReconstructGrid(t *testing.T) {
+	tests := []struct {
+		name    string
+		degrees float64
+	}{
+		{"straight", 0},
+		{"skewed clockwise", 1.5},
+		{"skewed counter-clockwise", -1.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			grid := ReconstructGrid(cardTokens(testCard, tt.degrees))
+			if grid == nil || !grid.Complete() {
+				t.Fatalf("grid not reconstructed: %d blocks", blockCount(grid))
+			}
+			if got := grid.Blocks(); !reflect.DeepEqual(got, testCard) {
+				t.Errorf("blocks = %v, want %v", got, testCard)
+			}
+			for _, cell := range grid.Layout().Cells {
+				if cell.Col != validator.DecadeColumn(cell.Number) {
+					t.Errorf("%d placed in column %d", cell.Number, cell.Col)
+				}
+			}
+		})
+	}
+}
+
+func TestReconstructGridMissingRow(t *testing.T) {
+	// OCR missed the last row of the middle block.
+	blocks := clone(testCard)
+	blocks[1].Row3 = nil
+
+	grid := ReconstructGrid(cardTokens(blocks, 0))
+	if grid == nil || !grid.Complete() {
+		t.Fatalf("grid not reconstructed: %d blocks", blockCount(grid))
+	}
+	want := clone(testCard)
+	want[1].Row3 = []int{}
+	if got := grid.Blocks(); !reflect.DeepEqual(got, want) {
+		t.Errorf("blocks = %v, want %v", got, want)
+	}
+}
+
+func TestReconstructGridStrayTokens(t *testing.T) {
+	tokens := cardTokens(testCard, 0)
+	// A serial number printed one row below the first block joins it as a
+	// fourth row, which is dropped as the emptiest.
+	tokens = append(tokens, placeToken("42", testLeft+4*testColPitch, testTop+3*testRowPitch, 0))
+	// A faint misreading in the cell of 52, whose decade does not fit.
+	stray := placeToken("82", testLeft+5*testColPitch+2, testTop+1, 0)
+	stray.Confidence = 0.95
+	tokens = append(tokens, stray)
+
+	grid := ReconstructGrid(tokens)
+	if grid == nil || !grid.Complete() {
+		t.Fatalf("grid not reconstructed: %d blocks", blockCount(grid))
+	}
+	if got := grid.Blocks(); !reflect.DeepEqual(got, testCard) {
+		t.Errorf("blocks = %v, want %v", got, testCard)
+	}
+
+	layout := BuildLayout(tokens)
+	if got, want := len(layout.Cells), 45+2; got != want {
+		t.Errorf("BuildLayout kept %d readings, want every one of %d", got, want)
+	}
+}
+
+func TestReconstructGridNoNumbers(t *testing.T) {
+	tokens := []model.OCRToken{{Text: "LOTO", X: 10, Y: 10, Width: 40, Height: 20}}
+	if grid := ReconstructGrid(tokens); grid != nil {
+		t.Errorf("got %v from text without numbers, want nil", grid.Blocks())
+	}
+}
+
+func blockCount(g *Grid) int {
+	if g == nil {
+		return 0
+	}
+	return len(g.Cells)
+}
+
+func clone(blocks []model.Block) []model.Block {
+	out := make([]model.Block, len(blocks))
+	for i, b := range blocks {
+		out[i] = model.Block{
+			Row1: append([]int(nil), b.Row1...),
+			Row2: append([]int(nil), b.Row2...),
+			Row3: append([]int(nil), b.Row3...),
+		}
+	}
+	return out
+}
@@ -1,37 +1,298 @@
 package scan
 
 import (
+	"cmp"
 	"context"
+	"encoding/base64"
 	"fmt"
+	"image"
 	"sort"
+	"sync"
+	"time"
 
 	"go.uber.org/zap"
 
 	"loto/internal/ai"
+	"loto/internal/config"
 	"loto/internal/model"
 	"loto/internal/ocr"
+	"loto/internal/preprocess"
+)
+
+const (
+	StrategySequential = "sequential"
+	StrategyParallel   = "parallel"
 )
 
 type HybridScanner struct {
-	ocr    ocr.Scanner
-	ai     ai.Scanner
-	logger *zap.Logger
+	ocr       ocr.Scanner
+	ai        ai.Scanner
+	digits    *ocr.DigitClassifier
+	maxPixels int
+	strategy  string
+	threshold float64
+	workers   int
+	logger    *zap.Logger
 }
 
-func NewHybridScanner(ocrScanner ocr.Scanner, aiClient ai.Scanner, logger *zap.Logger) *HybridScanner {
+func NewHybridScanner(ocrScanner ocr.Scanner, aiClient ai.Scanner, cfg config.HybridConfig, logger *zap.Logger) *HybridScanner {
+	strategy := cfg.Strategy
+	if strategy != StrategyParallel {
+		strategy = StrategySequential
+	}
 	return &HybridScanner{
-		ocr:    ocrScanner,
-		ai:     aiClient,
-		logger: logger,
+		ocr:       ocrScanner,
+		ai:        aiClient,
+		strategy:  strategy,
+		threshold: cfg.AgreementThreshold,
+		workers:   max(1, cfg.RegionWorkers),
+		logger:    logger,
 	}
 }
 
+// SetDigitClassifier adds the digit classifier as a third vote: it reads each
+// OCR cell's box, and where OCR and AI disagree on a cell the side it agrees
+// with wins.
+func (s *HybridScanner) SetDigitClassifier(c *ocr.DigitClassifier) {
+	s.digits = c
+}
+
+// SetMaxPixels limits the images the scanner decodes itself, to crop cards
+// and read digits; 0 means preprocess.DefaultMaxPixels.
+func (s *HybridScanner) SetMaxPixels(n int) {
+	s.maxPixels = n
+}
+
+// Scan reads a photo holding a single card.
 func (s *HybridScanner) Scan(ctx context.Context, imgBytes []byte, base64Image string, mimeType string) (*model.GPTScanResponse, error) {
+	plain := s.startPlain(ctx, base64Image, mimeType)
+	start := time.Now()
+	ocrResult, ocrErr := s.ocr.Scan(ctx, imgBytes, mimeType)
+	return s.complete(ctx, imgBytes, base64Image, mimeType, ocrResult, ocrErr, time.Since(start), plain)
+}
+
+// ScanCards reads every card in the photo. OCR runs once on the whole photo;
+// when its tokens form several cards (see DetectCards) each card is cropped
+// and scanned on its own with its share of the tokens, otherwise the photo is
+// scanned as a single card.
+func (s *HybridScanner) ScanCards(ctx context.Context, imgBytes []byte, base64Image string, mimeType string) ([]*model.GPTScanResponse, error) {
+	plain := s.startPlain(ctx, base64Image, mimeType)
+	start := time.Now()
 	ocrResult, ocrErr := s.ocr.Scan(ctx, imgBytes, mimeType)
+	ocrTook := time.Since(start)
+
+	if ocrErr == nil {
+		if regions := DetectCards(ocrResult.Tokens); len(regions) > 1 {
+			s.logger.Info("multiple cards detected", zap.Int("cards", len(regions)))
+			return s.scanRegions(ctx, imgBytes, ocrResult, regions, plain)
+		}
+	}
+
+	resp, err := s.complete(ctx, imgBytes, base64Image, mimeType, ocrResult, ocrErr, ocrTook, plain)
+	if err != nil {
+		return nil, err
+	}
+	return []*model.GPTScanResponse{resp}, nil
+}
+
+// scanRegions scans the card regions concurrently, at most s.workers at a
+// time since each decodes the photo and makes its own AI calls. The OCR call
+// is charged to the first card, as is the whole-photo AI call still running
+// in parallel mode: it is of no use for split cards but is paid for, so it is
+// collected once the cards are scanned rather than waited for first. Cards
+// that fail are dropped; it errors only when all fail.
+func (s *HybridScanner) scanRegions(ctx context.Context, imgBytes []byte, ocrResult *model.OCRScanResult, regions []image.Rectangle, plain <-chan aiOutcome) ([]*model.GPTScanResponse, error) {
+	results := make([]*model.GPTScanResponse, len(regions))
+	errs := make([]error, len(regions))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, s.workers)
+	for i, r := range regions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			data, r, err := preprocess.Crop(imgBytes, r, s.maxPixels)
+			if err != nil {
+				errs[i] = fmt.Errorf("crop card %d: %w", i+1, err)
+				return
+			}
+			sub := cropOCR(ocrResult, r)
+			if i == 0 {
+				sub.Usage = ocrResult.Usage
+			}
+			b64 := base64.StdEncoding.EncodeToString(data)
+			plain := s.startPlain(ctx, b64, "image/jpeg")
+			resp, err := s.complete(ctx, data, b64, "image/jpeg", sub, nil, 0, plain)
+			if err != nil {
+				errs[i] = fmt.Errorf("scan card %d: %w", i+1, err)
+				return
+			}
+			resp.Region = &model.Region{X: r.Min.X, Y: r.Min.Y, Width: r.Dx(), Height: r.Dy()}
+			results[i] = resp
+		}()
+	}
+	wg.Wait()
+
+	var wasted []model.Usage
+	if plain != nil {
+		if p := <-plain; p.err == nil {
+			wasted = p.resp.Usage
+		} else {
+			wasted = ai.FailedUsage(p.err)
+		}
+	}
+
+	var out []*model.GPTScanResponse
+	var firstErr error
+	for i, resp := range results {
+		if resp == nil {
+			s.logger.Warn("card scan failed", zap.Int("card", i+1), zap.Error(errs[i]))
+			firstErr = cmp.Or(firstErr, errs[i])
+			wasted = append(wasted, ai.FailedUsage(errs[i])...)
+			continue
+		}
+		out = append(out, resp)
+	}
+	if len(out) == 0 {
+		if len(wasted) > 0 {
+			return nil, &ai.UsageError{Err: firstErr, Usage: wasted}
+		}
+		return nil, firstErr
+	}
+	out[0].Usage = append(out[0].Usage, wasted...)
+	return out, nil
+}
+
+// startPlain starts the plain AI call in parallel mode; it returns nil in
+// sequential mode.
+func (s *HybridScanner) startPlain(ctx context.Context, base64Image string, mimeType string) <-chan aiOutcome {
+	if s.strategy != StrategyParallel {
+		return nil
+	}
+	ch := make(chan aiOutcome, 1)
+	go func() {
+		start := time.Now()
+		resp, err := s.ai.ScanTicket(ctx, base64Image, mimeType)
+		ch <- aiOutcome{resp: resp, err: err, took: time.Since(start)}
+	}()
+	return ch
+}
+
+// complete finishes a scan once OCR is done. plain is the in-flight plain AI
+// call in parallel mode and nil in sequential mode.
+func (s *HybridScanner) complete(ctx context.Context, imgBytes []byte, base64Image, mimeType string, ocrResult *model.OCRScanResult, ocrErr error, ocrTook time.Duration, plain <-chan aiOutcome) (*model.GPTScanResponse, error) {
+	if plain != nil {
+		return s.scanParallel(ctx, imgBytes, base64Image, mimeType, ocrResult, ocrErr, ocrTook, plain)
+	}
+	return s.scanSequential(ctx, imgBytes, base64Image, mimeType, ocrResult, ocrErr)
+}
 
+// scanSequential gives the OCR output to the AI.
+func (s *HybridScanner) scanSequential(ctx context.Context, imgBytes []byte, base64Image string, mimeType string, ocrResult *model.OCRScanResult, ocrErr error) (*model.GPTScanResponse, error) {
 	if ocrErr != nil {
 		s.logger.Warn("OCR failed, falling back to GPT-only", zap.Error(ocrErr))
-		return s.ai.ScanTicket(ctx, base64Image, mimeType)
+		resp, err := s.ai.ScanTicket(ctx, base64Image, mimeType)
+		if err != nil {
+			return nil, err
+		}
+		resp.Mode = model.ModeAI
+		resp.Path = model.PathOCRFailed
+		return resp, nil
+	}
+
+	grid := s.prepareOCR(imgBytes, ocrResult)
+
+	gptResult, gptErr := s.ai.ScanTicketWithOCR(ctx, base64Image, mimeType, ocrResult)
+	if gptErr != nil {
+		s.logger.Warn("GPT failed, using OCR-only result", zap.Error(gptErr))
+		return withFailedUsage(buildOCROnlyResponse(ocrResult), gptErr), nil
+	}
+
+	return s.finish(ocrResult, grid, gptResult, model.PathSequential, true), nil
+}
+
+type aiOutcome struct {
+	resp *model.GPTScanResponse
+	err  error
+	took time.Duration
+}
+
+// scanParallel joins the plain AI call started alongside OCR. When they agree
+// on at least threshold of the card the plain result is reconciled and
+// returned, so latency is roughly max(OCR, AI); otherwise the OCR-augmented
+// AI call is made as in sequential mode.
+func (s *HybridScanner) scanParallel(ctx context.Context, imgBytes []byte, base64Image string, mimeType string, ocrResult *model.OCRScanResult, ocrErr error, ocrTook time.Duration, plainCh <-chan aiOutcome) (*model.GPTScanResponse, error) {
+	plain := <-plainCh
+
+	s.logger.Info("parallel stage completed",
+		zap.Duration("ocr_latency", ocrTook),
+		zap.Duration("ai_latency", plain.took),
+		zap.NamedError("ocr_error", ocrErr),
+		zap.NamedError("ai_error", plain.err),
+	)
+
+	if ocrErr != nil {
+		s.logger.Warn("OCR failed, using GPT-only result", zap.Error(ocrErr))
+		if plain.err != nil {
+			return nil, plain.err
+		}
+		plain.resp.Mode = model.ModeAI
+		plain.resp.Path = model.PathOCRFailed
+		return plain.resp, nil
+	}
+
+	grid := s.prepareOCR(imgBytes, ocrResult)
+
+	if plain.err == nil {
+		agreed := agreement(ocrResult, grid, plain.resp)
+		s.logger.Info("parallel agreement",
+			zap.Float64("agreement", agreed),
+			zap.Float64("threshold", s.threshold),
+		)
+		if agreed >= s.threshold {
+			return s.finish(ocrResult, grid, plain.resp, model.PathParallelAgreed, false), nil
+		}
+	} else {
+		s.logger.Warn("plain GPT call failed, escalating to hybrid call", zap.Error(plain.err))
+	}
+
+	gptResult, gptErr := s.ai.ScanTicketWithOCR(ctx, base64Image, mimeType, ocrResult)
+	if gptErr != nil {
+		if plain.err == nil {
+			s.logger.Warn("hybrid GPT call failed, using plain GPT result", zap.Error(gptErr))
+			return withFailedUsage(s.finish(ocrResult, grid, plain.resp, model.PathParallelFallback, false), gptErr), nil
+		}
+		s.logger.Warn("GPT failed, using OCR-only result", zap.Error(gptErr))
+		return withFailedUsage(buildOCROnlyResponse(ocrResult), plain.err, gptErr), nil
+	}
+
+	if plain.err == nil {
+		gptResult.Usage = append(plain.resp.Usage, gptResult.Usage...)
+	}
+	return withFailedUsage(s.finish(ocrResult, grid, gptResult, model.PathParallelEscalated, true), plain.err), nil
+}
+
+// withFailedUsage adds the usage billed by failed AI calls to resp, so that
+// the scan's cost covers them.
+func withFailedUsage(resp *model.GPTScanResponse, errs ...error) *model.GPTScanResponse {
+	for _, err := range errs {
+		resp.Usage = append(resp.Usage, ai.FailedUsage(err)...)
+	}
+	return resp
+}
+
+// prepareOCR lays out the OCR tokens for the prompt and returns the
+// reconstructed grid, or nil when the tokens do not form a full card. With a
+// digit classifier set, every grid cell also gets its reading of the cell.
+func (s *HybridScanner) prepareOCR(imgBytes []byte, ocrResult *model.OCRScanResult) *Grid {
+	ocrResult.Layout = BuildLayout(ocrResult.Tokens)
+	if ocrResult.Layout != nil {
+		s.logger.Info("OCR layout",
+			zap.Int("blocks", ocrResult.Layout.Blocks),
+			zap.Int("cells", len(ocrResult.Layout.Cells)),
+		)
 	}
 
 	s.logger.Info("OCR completed",
@@ -42,12 +303,50 @@ func (s *HybridScanner) Scan(ctx context.Context, imgBytes []byte, base64Image s
 		zap.String("provider", ocrResult.Provider),
 	)
 
-	gptResult, gptErr := s.ai.ScanTicketWithOCR(ctx, base64Image, mimeType, ocrResult)
-	if gptErr != nil {
-		s.logger.Warn("GPT failed, using OCR-only result", zap.Error(gptErr))
-		return buildOCROnlyResponse(ocrResult), nil
+	grid := ReconstructGrid(ocrResult.Tokens)
+	if grid != nil && !grid.Complete() {
+		return nil
+	}
+	if grid != nil && s.digits != nil {
+		s.voteDigits(imgBytes, grid)
+	}
+	return grid
+}
+
+// voteDigits reads every filled cell's box with the digit classifier and
+// stores the reading as the cell's Digits, the third vote in reconcileGrid.
+func (s *HybridScanner) voteDigits(imgBytes []byte, grid *Grid) {
+	img, err := preprocess.Decode(imgBytes, s.maxPixels)
+	if err != nil {
+		s.logger.Warn("digit vote skipped", zap.Error(err))
+		return
 	}
 
+	var read, agreed int
+	for b := range grid.Cells {
+		for r := range grid.Cells[b] {
+			for c := range grid.Cells[b][r] {
+				cell := &grid.Cells[b][r][c]
+				if cell.Number == 0 {
+					continue
+				}
+				text, _ := s.digits.Read(img, image.Rect(cell.X, cell.Y, cell.X+cell.Width, cell.Y+cell.Height))
+				if nums := ocr.SplitLOTONumbers(text); len(nums) == 1 {
+					cell.Digits = nums[0]
+					read++
+					if cell.Digits == cell.Number {
+						agreed++
+					}
+				}
+			}
+		}
+	}
+	s.logger.Info("digit vote", zap.Int("cells_read", read), zap.Int("agreed_with_ocr", agreed))
+}
+
+// finish reconciles the AI result with OCR. sawOCR is whether the AI call
+// was given the OCR reading (ScanTicketWithOCR) rather than the photo alone.
+func (s *HybridScanner) finish(ocrResult *model.OCRScanResult, grid *Grid, gptResult *model.GPTScanResponse, path string, sawOCR bool) *model.GPTScanResponse {
 	s.logger.Info("GPT completed",
 		zap.String("lottery_type", gptResult.LotteryType),
 		zap.Int("numbers_found", len(gptResult.AllNumbers)),
@@ -57,9 +356,20 @@ func (s *HybridScanner) Scan(ctx context.Context, imgBytes []byte, base64Image s
 		zap.String("notes", gptResult.Notes),
 	)
 
-	final := reconcile(ocrResult, gptResult, s.logger)
+	final := reconcile(ocrResult, grid, gptResult, sawOCR, s.logger)
+	final.Mode = model.ModeHybrid
+	final.Path = path
+	final.OCRTokens = ocrResult.Tokens
+	final.OCRLayout = ocrResult.Layout
+	if grid != nil {
+		final.OCRLayout = grid.Layout()
+	}
+	if ocrResult.Usage != nil {
+		final.Usage = append([]model.Usage{*ocrResult.Usage}, final.Usage...)
+	}
 
 	s.logger.Info("final result",
+		zap.String("path", path),
 		zap.String("lottery_type", final.LotteryType),
 		zap.Int("numbers_count", len(final.AllNumbers)),
 		zap.Ints("numbers", final.AllNumbers),
@@ -67,10 +377,36 @@ func (s *HybridScanner) Scan(ctx context.Context, imgBytes []byte, base64Image s
 		zap.String("notes", final.Notes),
 	)
 
-	return final, nil
+	return final
 }
 
+// buildOCROnlyResponse reconstructs the card from OCR positions alone. When
+// the tokens do not form a grid it falls back to the flat number list.
 func buildOCROnlyResponse(ocr *model.OCRScanResult) *model.GPTScanResponse {
+	resp := &model.GPTScanResponse{
+		LotteryType: "LOTO",
+		Notes:       "OCR-only scan (GPT unavailable)",
+		Mode:        model.ModeOCR,
+		Path:        model.PathAIFailed,
+		OCRLayout:   ocr.Layout,
+		OCRTokens:   ocr.Tokens,
+		Provider:    ocr.Provider,
+	}
+	if ocr.Usage != nil {
+		resp.Usage = []model.Usage{*ocr.Usage}
+		resp.Model = ocr.Usage.Model
+	}
+
+	if grid := ReconstructGrid(ocr.Tokens); grid != nil && grid.Complete() {
+		resp.OCRLayout = grid.Layout()
+		resp.Corrections = grid.Correct()
+		resp.Blocks = grid.Blocks()
+		resp.AllNumbers = grid.Numbers()
+		resp.Confidence = grid.Confidence() * 0.9
+		resp.Notes = "OCR-only scan (GPT unavailable), grid reconstructed from token positions"
+		return resp
+	}
+
 	var filtered []int
 	seen := make(map[int]struct{})
 	for _, n := range ocr.Numbers {
@@ -82,87 +418,7 @@ func buildOCROnlyResponse(ocr *model.OCRScanResult) *model.GPTScanResponse {
 		}
 	}
 	sort.Ints(filtered)
-	return &model.GPTScanResponse{
-		LotteryType: "LOTO",
-		AllNumbers:  filtered,
-		Confidence:  ocr.Confidence * 0.9,
-		Notes:       "OCR-only scan (GPT unavailable)",
-	}
-}
-
-func reconcile(ocrResult *model.OCRScanResult, gptResult *model.GPTScanResponse, logger *zap.Logger) *model.GPTScanResponse {
-	ocrSet := make(map[int]struct{})
-	for _, n := range ocrResult.Numbers {
-		if n >= 1 && n <= 90 {
-			ocrSet[n] = struct{}{}
-		}
-	}
-
-	gptSet := make(map[int]struct{})
-	for _, n := range gptResult.AllNumbers {
-		gptSet[n] = struct{}{}
-	}
-
-	agreed := 0
-	for n := range gptSet {
-		if _, ok := ocrSet[n]; ok {
-			agreed++
-		}
-	}
-
-	gptCoverage := 0.0
-	if len(gptSet) > 0 {
-		gptCoverage = float64(agreed) / float64(len(gptSet))
-	}
-
-	logger.Info("reconciliation",
-		zap.Int("ocr_count", len(ocrSet)),
-		zap.Int("gpt_count", len(gptSet)),
-		zap.Int("agreed", agreed),
-		zap.Float64("gpt_coverage", gptCoverage),
-	)
-
-	if gptCoverage >= 0.85 {
-		gptResult.Confidence = (gptResult.Confidence + ocrResult.Confidence) / 2
-		if gptCoverage >= 0.95 {
-			gptResult.Confidence = min(gptResult.Confidence*1.1, 1.0)
-		}
-		gptResult.Notes = fmt.Sprintf("hybrid scan: %.0f%% GPT numbers confirmed by OCR", gptCoverage*100)
-		return gptResult
-	}
-
-	if gptCoverage >= 0.7 {
-		gptResult.Confidence = (gptResult.Confidence*0.7 + ocrResult.Confidence*0.3)
-		gptResult.Notes = fmt.Sprintf("hybrid scan: %.0f%% GPT numbers confirmed by OCR", gptCoverage*100)
-		return gptResult
-	}
-
-	finalSet := make(map[int]struct{})
-
-	for n := range gptSet {
-		if _, ok := ocrSet[n]; ok {
-			finalSet[n] = struct{}{}
-		}
-	}
-
-	if gptResult.Confidence >= 0.7 {
-		for n := range gptSet {
-			finalSet[n] = struct{}{}
-		}
-	}
-
-	var finalNumbers []int
-	for n := range finalSet {
-		finalNumbers = append(finalNumbers, n)
-	}
-	sort.Ints(finalNumbers)
-
-	gptResult.AllNumbers = finalNumbers
-	gptResult.Confidence = (gptResult.Confidence + ocrResult.Confidence) / 2 * 0.8
-	if gptResult.Confidence < 0.4 {
-		gptResult.Confidence = 0.4
-	}
-	gptResult.Notes = fmt.Sprintf("hybrid scan: low coverage (%.0f%%), merged results", gptCoverage*100)
-
-	return gptResult
+	resp.AllNumbers = filtered
+	resp.Confidence = ocr.Confidence * 0.9
+	return resp
 }
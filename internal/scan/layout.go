@@ -0,0 +1,224 @@
+package scan
+
+import (
+	"math"
+	"sort"
+
+	"loto/internal/model"
+	"loto/internal/ocr"
+	"loto/internal/validator"
+)
+
+const (
+	gridBlocks  = 3
+	gridRows    = 3
+	gridColumns = 9
+	rowNumbers  = 5
+)
+
+type placedToken struct {
+	number     int
+	text       string
+	confidence float64
+	x, y, w, h int
+	cx, cy     float64
+}
+
+type tokenRow struct {
+	tokens []placedToken
+	cy     float64
+}
+
+// BuildLayout places numeric OCR tokens on the card grid using only their
+// bounding boxes: rows are clustered by vertical center, blocks are split at
+// unusually large row gaps, and columns come from fitColumns. Every token is
+// kept, so a cell may hold several readings.
+func BuildLayout(tokens []model.OCRToken) *model.OCRLayout {
+	blocks, cells := placeTokens(tokens)
+	if len(cells) == 0 {
+		return nil
+	}
+	return &model.OCRLayout{Blocks: blocks, Cells: cells}
+}
+
+func placeTokens(tokens []model.OCRToken) (int, []model.GridCell) {
+	pts := numericTokens(tokens)
+	if len(pts) == 0 {
+		return 0, nil
+	}
+
+	rows := clusterRows(pts)
+	blocks := groupBlocks(rows)
+	columnOf := fitColumns(pts)
+
+	var cells []model.GridCell
+	for bi, block := range blocks {
+		for ri, row := range block {
+			for _, p := range row.tokens {
+				cells = append(cells, model.GridCell{
+					Block:      bi + 1,
+					Row:        ri + 1,
+					Col:        columnOf(p.cx),
+					Number:     p.number,
+					Text:       p.text,
+					Confidence: p.confidence,
+					X:          p.x,
+					Y:          p.y,
+					Width:      p.w,
+					Height:     p.h,
+				})
+			}
+		}
+	}
+	return len(blocks), cells
+}
+
+// fitColumns maps an x center to a column. Most OCR readings sit in the
+// column their decade says, so the median x of each decade gives anchor
+// points for a least-squares line x = a + b*col; a misread digit then still
+// lands in the column it was printed in. With fewer than two decades seen it
+// falls back to splitting the numbers' x-extent into ninths.
+func fitColumns(pts []placedToken) func(cx float64) int {
+	byCol := make(map[int][]float64)
+	for _, p := range pts {
+		c := validator.DecadeColumn(p.number)
+		byCol[c] = append(byCol[c], p.cx)
+	}
+
+	var sumC, sumX, sumCC, sumCX, n float64
+	for c, xs := range byCol {
+		x := median(xs)
+		fc := float64(c)
+		sumC += fc
+		sumX += x
+		sumCC += fc * fc
+		sumCX += fc * x
+		n++
+	}
+
+	if n >= 2 {
+		if denom := n*sumCC - sumC*sumC; denom != 0 {
+			b := (n*sumCX - sumC*sumX) / denom
+			a := (sumX - b*sumC) / n
+			if b > 0 {
+				return func(cx float64) int {
+					col := int(math.Round((cx - a) / b))
+					return max(1, min(col, gridColumns))
+				}
+			}
+		}
+	}
+
+	minX, maxX := pts[0].x, pts[0].x+pts[0].w
+	for _, p := range pts {
+		minX = min(minX, p.x)
+		maxX = max(maxX, p.x+p.w)
+	}
+	colWidth := float64(maxX-minX) / gridColumns
+	return func(cx float64) int {
+		if colWidth <= 0 {
+			return 1
+		}
+		col := int((cx-float64(minX))/colWidth) + 1
+		return max(1, min(col, gridColumns))
+	}
+}
+
+// numericTokens keeps tokens that parse as LOTO numbers. Words OCR merged
+// across cells are split into equal-width pieces.
+func numericTokens(tokens []model.OCRToken) []placedToken {
+	var pts []placedToken
+	for _, t := range tokens {
+		nums := ocr.SplitLOTONumbers(t.Text)
+		if len(nums) == 0 || t.Width <= 0 || t.Height <= 0 {
+			continue
+		}
+		w := t.Width / len(nums)
+		for i, n := range nums {
+			p := placedToken{
+				number:     n,
+				text:       t.Text,
+				confidence: t.Confidence,
+				x:          t.X + i*w,
+				y:          t.Y,
+				w:          w,
+				h:          t.Height,
+			}
+			p.cx = float64(p.x) + float64(p.w)/2
+			p.cy = float64(p.y) + float64(p.h)/2
+			pts = append(pts, p)
+		}
+	}
+	return pts
+}
+
+func clusterRows(pts []placedToken) []tokenRow {
+	sorted := make([]placedToken, len(pts))
+	copy(sorted, pts)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].cy < sorted[j].cy })
+
+	heights := make([]float64, len(sorted))
+	for i, p := range sorted {
+		heights[i] = float64(p.h)
+	}
+	tolerance := median(heights) * 0.5
+
+	var rows []tokenRow
+	for _, p := range sorted {
+		if n := len(rows); n > 0 && p.cy-rows[n-1].cy <= tolerance {
+			r := &rows[n-1]
+			r.tokens = append(r.tokens, p)
+			r.cy += (p.cy - r.cy) / float64(len(r.tokens))
+			continue
+		}
+		rows = append(rows, tokenRow{tokens: []placedToken{p}, cy: p.cy})
+	}
+
+	for _, r := range rows {
+		sort.Slice(r.tokens, func(i, j int) bool { return r.tokens[i].cx < r.tokens[j].cx })
+	}
+	return rows
+}
+
+// groupBlocks splits rows into blocks wherever the gap to the next row is
+// clearly larger than the typical row pitch. A card photographed so tightly
+// that no gap stands out falls back to chunks of three rows.
+func groupBlocks(rows []tokenRow) [][]tokenRow {
+	if len(rows) <= 1 {
+		return [][]tokenRow{rows}
+	}
+
+	gaps := make([]float64, len(rows)-1)
+	for i := range gaps {
+		gaps[i] = rows[i+1].cy - rows[i].cy
+	}
+	threshold := median(gaps) * 1.4
+
+	var blocks [][]tokenRow
+	start := 0
+	for i, g := range gaps {
+		if g > threshold {
+			blocks = append(blocks, rows[start:i+1])
+			start = i + 1
+		}
+	}
+	blocks = append(blocks, rows[start:])
+
+	if len(blocks) == 1 && len(rows)%3 == 0 && len(rows) > 3 {
+		blocks = nil
+		for i := 0; i < len(rows); i += 3 {
+			blocks = append(blocks, rows[i:i+3])
+		}
+	}
+	return blocks
+}
+
+func median(vals []float64) float64 {
+	if len(vals) == 0 {
+		return 0
+	}
+	s := make([]float64, len(vals))
+	copy(s, vals)
+	sort.Float64s(s)
+	return s[len(s)/2]
+}
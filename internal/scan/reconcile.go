@@ -0,0 +1,499 @@
+package scan
+
+import (
+	"fmt"
+	"sort"
+
+	"go.uber.org/zap"
+
+	"loto/internal/model"
+	"loto/internal/validator"
+)
+
+const (
+	reasonAIOnly         = "ai_only"
+	reasonOCRAdded       = "ocr_added"
+	reasonOCRIgnored     = "ocr_ignored"
+	reasonOCRWrongColumn = "ocr_wrong_column"
+	reasonOCRDuplicate   = "ocr_duplicate"
+	reasonAIPreferred    = "ai_preferred"
+	reasonAIColumnClash  = "ai_column_conflict"
+	reasonAIClashDropped = "ai_column_conflict_dropped"
+	reasonAIMisread      = "ai_misread"
+	reasonDigitsOCR      = "digits_ocr"
+	reasonDigitsRejected = "digits_rejected"
+	reasonDisputed       = "disputed"
+)
+
+// reconcile merges the OCR and AI readings. A LOTO card with AI blocks and a
+// complete OCR grid is merged cell by cell; anything else falls back to
+// comparing the two number sets. Either way Blocks and AllNumbers agree on
+// return. sawOCR is whether the AI prompt included the OCR reading.
+func reconcile(ocrResult *model.OCRScanResult, grid *Grid, gptResult *model.GPTScanResponse, sawOCR bool, logger *zap.Logger) *model.GPTScanResponse {
+	if grid != nil && gptResult.LotteryType == "LOTO" && len(gptResult.Blocks) == len(grid.Cells) {
+		return reconcileGrid(ocrResult, grid, gptResult, sawOCR, logger)
+	}
+	result := reconcileNumbers(ocrResult, gptResult, logger)
+	syncNumbers(result)
+	return result
+}
+
+// aiCells indexes AI numbers by block, row and the column their decade puts
+// them in. A cell holds more than one number when the AI put two numbers of
+// the same decade in one row.
+func aiCells(blocks []model.Block) [][gridRows][gridColumns][]int {
+	cells := make([][gridRows][gridColumns][]int, len(blocks))
+	for b, block := range blocks {
+		for r, row := range [][]int{block.Row1, block.Row2, block.Row3} {
+			for _, n := range row {
+				if n < 1 || n > 90 {
+					continue
+				}
+				c := validator.DecadeColumn(n) - 1
+				cells[b][r][c] = append(cells[b][r][c], n)
+			}
+		}
+	}
+	return cells
+}
+
+// alignBlocks returns, for each AI block, the OCR block it corresponds to.
+// Blocks are usually in the same order, but a rotated photo or a missed gap
+// can shuffle them, so every ordering is scored by exact cell agreement.
+// Beyond gridBlocks blocks the reading is not a card and only the given
+// order is scored, which keeps the search bounded.
+func alignBlocks(ai [][gridRows][gridColumns][]int, grid *Grid) ([]int, int) {
+	best, bestScore := identity(len(ai)), -1
+	orders := [][]int{best}
+	if len(ai) <= gridBlocks {
+		orders = permutations(len(ai))
+	}
+	for _, perm := range orders {
+		score := 0
+		for b, ob := range perm {
+			for r := 0; r < gridRows; r++ {
+				for c := 0; c < gridColumns; c++ {
+					o := grid.Cells[ob][r][c].Number
+					for _, n := range ai[b][r][c] {
+						if o != 0 && n == o {
+							score++
+						}
+					}
+				}
+			}
+		}
+		if score > bestScore {
+			best, bestScore = perm, score
+		}
+	}
+	return best, bestScore
+}
+
+// agreement is the share of the card OCR and AI read identically: matching
+// cells over the larger of the two readings when the grid is available,
+// otherwise matching numbers over the larger number set.
+func agreement(ocrResult *model.OCRScanResult, grid *Grid, gptResult *model.GPTScanResponse) float64 {
+	if grid != nil && gptResult.LotteryType == "LOTO" && len(gptResult.Blocks) == len(grid.Cells) {
+		ai := aiCells(gptResult.Blocks)
+		_, matched := alignBlocks(ai, grid)
+
+		aiCount := 0
+		for b := range ai {
+			for r := range ai[b] {
+				for c := range ai[b][r] {
+					aiCount += len(ai[b][r][c])
+				}
+			}
+		}
+		total := max(aiCount, len(grid.Layout().Cells))
+		if total == 0 {
+			return 0
+		}
+		return float64(matched) / float64(total)
+	}
+
+	ocrSet := make(map[int]struct{})
+	for _, n := range ocrResult.Numbers {
+		ocrSet[n] = struct{}{}
+	}
+	gptSet := make(map[int]struct{})
+	matched := 0
+	for _, n := range gptResult.AllNumbers {
+		if _, dup := gptSet[n]; dup {
+			continue
+		}
+		gptSet[n] = struct{}{}
+		if _, ok := ocrSet[n]; ok {
+			matched++
+		}
+	}
+	total := max(len(gptSet), len(ocrSet))
+	if total == 0 {
+		return 0
+	}
+	return float64(matched) / float64(total)
+}
+
+func reconcileGrid(ocrResult *model.OCRScanResult, grid *Grid, gptResult *model.GPTScanResponse, sawOCR bool, logger *zap.Logger) *model.GPTScanResponse {
+	ai := aiCells(gptResult.Blocks)
+	order, _ := alignBlocks(ai, grid)
+
+	onCard := make(map[int]bool)
+	rowCount := make([][gridRows]int, len(ai))
+	for b := range ai {
+		for r := 0; r < gridRows; r++ {
+			for c := 0; c < gridColumns; c++ {
+				for _, n := range ai[b][r][c] {
+					onCard[n] = true
+				}
+				if len(ai[b][r][c]) > 0 {
+					rowCount[b][r]++
+				}
+			}
+		}
+	}
+
+	misreads := findMisreads(ai, grid, order, onCard)
+
+	merged := make([][gridRows][gridColumns]int, len(ai))
+	var decisions []model.ReconcileDecision
+	var agreed, filled, toOCR, added int
+
+	for b := range ai {
+		for r := 0; r < gridRows; r++ {
+			for c := 0; c < gridColumns; c++ {
+				aiNums := ai[b][r][c]
+				cell := grid.Cells[order[b]][r][c]
+				o, dv := cell.Number, cell.Digits
+				if len(aiNums) == 0 && o == 0 {
+					continue
+				}
+
+				d := model.ReconcileDecision{Block: b + 1, Row: r + 1, Col: c + 1, OCR: o, Digits: dv}
+				if len(aiNums) > 0 {
+					d.AI = aiNums[0]
+				}
+
+				switch {
+				case misreads[[3]int{b, r, c}]:
+					if o != 0 {
+						d.Chosen, d.Source, d.Reason = o, model.CellSourceOCR, reasonAIMisread
+						onCard[o] = true
+						toOCR++
+					} else {
+						d.Source, d.Reason = model.CellSourceOCR, reasonAIMisread
+						delete(onCard, aiNums[0])
+					}
+				case len(aiNums) > 0 && contains(aiNums, o):
+					d.AI, d.Chosen, d.Source = o, o, model.CellSourceBoth
+					if len(aiNums) == 1 {
+						agreed++
+						merged[b][r][c] = o
+						filled++
+						continue
+					}
+					d.Reason = reasonAIColumnClash
+				case len(aiNums) == 0 && dv != 0 && dv != o:
+					d.Source, d.Reason = model.CellSourceAI, reasonDigitsRejected
+				case len(aiNums) == 0:
+					if validator.DecadeColumn(o) == c+1 && !onCard[o] && rowCount[b][r] < rowNumbers {
+						d.Chosen, d.Source, d.Reason = o, model.CellSourceOCR, reasonOCRAdded
+						onCard[o] = true
+						rowCount[b][r]++
+						added++
+					} else {
+						d.Source, d.Reason = model.CellSourceAI, reasonOCRIgnored
+					}
+				case o == 0:
+					d.Chosen, d.Source, d.Reason = aiNums[0], model.CellSourceAI, reasonAIOnly
+					if len(aiNums) > 1 {
+						d.Reason = reasonAIColumnClash
+					}
+				case validator.DecadeColumn(o) != c+1:
+					d.Chosen, d.Source, d.Reason = aiNums[0], model.CellSourceAI, reasonOCRWrongColumn
+				case onCard[o]:
+					d.Chosen, d.Source, d.Reason = aiNums[0], model.CellSourceAI, reasonOCRDuplicate
+				case dv == o:
+					// The digit classifier read the printed cell as OCR did,
+					// outvoting the AI.
+					d.Chosen, d.Source, d.Reason = o, model.CellSourceOCR, reasonDigitsOCR
+					delete(onCard, aiNums[0])
+					onCard[o] = true
+					toOCR++
+				case !sawOCR && dv != aiNums[0] && cell.Confidence > gptResult.Confidence:
+					// The AI never saw this OCR reading, so the two are
+					// independent and the more confident one wins.
+					d.Chosen, d.Source, d.Reason = o, model.CellSourceOCR, reasonDisputed
+					delete(onCard, aiNums[0])
+					onCard[o] = true
+					toOCR++
+				case !sawOCR:
+					d.Chosen, d.Source, d.Reason = aiNums[0], model.CellSourceAI, reasonDisputed
+				default:
+					// The AI saw this OCR reading in its prompt and chose
+					// differently, so its reading stands.
+					d.Chosen, d.Source, d.Reason = aiNums[0], model.CellSourceAI, reasonAIPreferred
+				}
+
+				merged[b][r][c] = d.Chosen
+				if d.Chosen != 0 {
+					filled++
+				}
+				decisions = append(decisions, d)
+
+				// The AI put more than one number in this column; the ones
+				// not decided on above are dropped from the card.
+				for _, n := range aiNums {
+					if n == d.AI {
+						continue
+					}
+					decisions = append(decisions, model.ReconcileDecision{
+						Block: b + 1, Row: r + 1, Col: c + 1, OCR: o, AI: n, Digits: dv,
+						Source: model.CellSourceAI, Reason: reasonAIClashDropped,
+					})
+					delete(onCard, n)
+				}
+			}
+		}
+	}
+
+	gptResult.Blocks = make([]model.Block, len(merged))
+	var numbers []int
+	for b, block := range merged {
+		rows := make([][]int, gridRows)
+		for r := range block {
+			rows[r] = []int{}
+			for _, n := range block[r] {
+				if n != 0 {
+					rows[r] = append(rows[r], n)
+					numbers = append(numbers, n)
+				}
+			}
+		}
+		gptResult.Blocks[b] = model.Block{Row1: rows[0], Row2: rows[1], Row3: rows[2]}
+	}
+	gptResult.AllNumbers = uniqueSorted(numbers)
+	gptResult.Reconciliation = decisions
+
+	ratio := 0.0
+	if filled > 0 {
+		ratio = float64(agreed) / float64(filled)
+	}
+	gptResult.Confidence = blendConfidence(gptResult.Confidence, ocrResult.Confidence, ratio)
+	gptResult.Notes = fmt.Sprintf("hybrid scan: %d/%d cells agreed, %d decided (%d to OCR, %d added from OCR)",
+		agreed, filled, len(decisions), toOCR, added)
+
+	logger.Info("reconciliation",
+		zap.String("method", "grid"),
+		zap.Ints("block_order", order),
+		zap.Int("agreed", agreed),
+		zap.Int("filled", filled),
+		zap.Int("decisions", len(decisions)),
+		zap.Int("to_ocr", toOCR),
+		zap.Int("added", added),
+	)
+
+	return gptResult
+}
+
+// findMisreads pairs, within one row, an AI number whose column OCR saw empty
+// with an OCR number whose column the AI left empty, when the OCR number is a
+// confusable reading of the AI one (61 vs 81) and not already on the card.
+// The AI then misread the printed digit and placed the number by its wrong
+// decade; both cells of each pair are returned.
+func findMisreads(ai [][gridRows][gridColumns][]int, grid *Grid, order []int, onCard map[int]bool) map[[3]int]bool {
+	out := make(map[[3]int]bool)
+	for b := range ai {
+		for r := 0; r < gridRows; r++ {
+			ocrRow := grid.Cells[order[b]][r]
+			for c := 0; c < gridColumns; c++ {
+				if len(ai[b][r][c]) != 1 || ocrRow[c].Number != 0 {
+					continue
+				}
+				var matches []int
+				for _, alt := range alternatives(ai[b][r][c][0]) {
+					oc := validator.DecadeColumn(alt) - 1
+					if ocrRow[oc].Number == alt && len(ai[b][r][oc]) == 0 && !onCard[alt] && !out[[3]int{b, r, oc}] {
+						matches = append(matches, oc)
+					}
+				}
+				if len(matches) == 1 {
+					out[[3]int{b, r, c}] = true
+					out[[3]int{b, r, matches[0]}] = true
+				}
+			}
+		}
+	}
+	return out
+}
+
+// blendConfidence combines AI and OCR confidence by how much of the result
+// both sides agreed on.
+func blendConfidence(ai, ocr, agreement float64) float64 {
+	switch {
+	case agreement >= 0.95:
+		return min((ai+ocr)/2*1.1, 1.0)
+	case agreement >= 0.85:
+		return (ai + ocr) / 2
+	case agreement >= 0.7:
+		return ai*0.7 + ocr*0.3
+	default:
+		return max((ai+ocr)/2*0.8, 0.4)
+	}
+}
+
+// reconcileNumbers compares OCR and AI as number sets, for results the grid
+// cannot be built for (no OCR grid, VN_6_DIGIT tickets, or AI blocks missing).
+func reconcileNumbers(ocrResult *model.OCRScanResult, gptResult *model.GPTScanResponse, logger *zap.Logger) *model.GPTScanResponse {
+	ocrSet := make(map[int]struct{})
+	for _, n := range ocrResult.Numbers {
+		if n >= 1 && n <= 90 {
+			ocrSet[n] = struct{}{}
+		}
+	}
+
+	gptSet := make(map[int]struct{})
+	for _, n := range gptResult.AllNumbers {
+		gptSet[n] = struct{}{}
+	}
+
+	agreed := 0
+	for n := range gptSet {
+		if _, ok := ocrSet[n]; ok {
+			agreed++
+		}
+	}
+
+	gptCoverage := 0.0
+	if len(gptSet) > 0 {
+		gptCoverage = float64(agreed) / float64(len(gptSet))
+	}
+
+	logger.Info("reconciliation",
+		zap.String("method", "numbers"),
+		zap.Int("ocr_count", len(ocrSet)),
+		zap.Int("gpt_count", len(gptSet)),
+		zap.Int("agreed", agreed),
+		zap.Float64("gpt_coverage", gptCoverage),
+	)
+
+	aiConfidence := gptResult.Confidence
+	gptResult.Confidence = blendConfidence(aiConfidence, ocrResult.Confidence, gptCoverage)
+
+	if gptCoverage >= 0.7 {
+		gptResult.Notes = fmt.Sprintf("hybrid scan: %.0f%% GPT numbers confirmed by OCR", gptCoverage*100)
+		return gptResult
+	}
+
+	if aiConfidence >= 0.7 {
+		gptResult.Notes = fmt.Sprintf("hybrid scan: low coverage (%.0f%%), kept GPT numbers", gptCoverage*100)
+		return gptResult
+	}
+
+	var kept []int
+	for n := range gptSet {
+		if _, ok := ocrSet[n]; ok {
+			kept = append(kept, n)
+		}
+	}
+	sort.Ints(kept)
+
+	gptResult.AllNumbers = kept
+	gptResult.Blocks = filterBlocks(gptResult.Blocks, ocrSet)
+	gptResult.Notes = fmt.Sprintf("hybrid scan: low coverage (%.0f%%), kept numbers confirmed by OCR", gptCoverage*100)
+
+	return gptResult
+}
+
+func filterBlocks(blocks []model.Block, keep map[int]struct{}) []model.Block {
+	filter := func(row []int) []int {
+		out := []int{}
+		for _, n := range row {
+			if _, ok := keep[n]; ok {
+				out = append(out, n)
+			}
+		}
+		return out
+	}
+	out := make([]model.Block, len(blocks))
+	for i, b := range blocks {
+		out[i] = model.Block{Row1: filter(b.Row1), Row2: filter(b.Row2), Row3: filter(b.Row3)}
+	}
+	return out
+}
+
+// syncNumbers makes every block number part of AllNumbers. When the blocks
+// form a complete card they are authoritative and AllNumbers is rebuilt from
+// them; partial blocks (the AI sometimes fills only the first block) only add
+// to AllNumbers.
+func syncNumbers(resp *model.GPTScanResponse) {
+	if len(resp.Blocks) == 0 {
+		return
+	}
+
+	var numbers []int
+	complete := len(resp.Blocks) == gridBlocks
+	for _, b := range resp.Blocks {
+		for _, row := range [][]int{b.Row1, b.Row2, b.Row3} {
+			if len(row) != rowNumbers {
+				complete = false
+			}
+			numbers = append(numbers, row...)
+		}
+	}
+
+	if !complete {
+		numbers = append(numbers, resp.AllNumbers...)
+	}
+	resp.AllNumbers = uniqueSorted(numbers)
+}
+
+func uniqueSorted(nums []int) []int {
+	seen := make(map[int]struct{}, len(nums))
+	out := []int{}
+	for _, n := range nums {
+		if _, ok := seen[n]; ok {
+			continue
+		}
+		seen[n] = struct{}{}
+		out = append(out, n)
+	}
+	sort.Ints(out)
+	return out
+}
+
+func contains(nums []int, n int) bool {
+	for _, m := range nums {
+		if m == n {
+			return true
+		}
+	}
+	return false
+}
+
+func identity(n int) []int {
+	p := make([]int, n)
+	for i := range p {
+		p[i] = i
+	}
+	return p
+}
+
+// permutations lists every ordering of 0..n-1. There are n! of them, so
+// callers keep n small.
+func permutations(n int) [][]int {
+	if n == 0 {
+		return [][]int{{}}
+	}
+	var out [][]int
+	for _, p := range permutations(n - 1) {
+		for i := 0; i <= len(p); i++ {
+			q := make([]int, 0, n)
+			q = append(q, p[:i]...)
+			q = append(q, n-1)
+			q = append(q, p[i:]...)
+			out = append(out, q)
+		}
+	}
+	return out
+}
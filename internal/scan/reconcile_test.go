@@ -0,0 +1,174 @@
+package scan
+
+import (
+	"cmp"
+	"reflect"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"loto/internal/model"
+)
+
+// misreadCard holds the row 1, 22, 41, 61, 80, whose 61 and 80 are both a
+// confusable reading of 81.
+var misreadCard = []model.Block{
+	{Row1: []int{1, 22, 41, 61, 80}, Row2: []int{24, 43, 56, 63, 85}, Row3: []int{7, 18, 29, 47, 78}},
+	{Row1: []int{2, 26, 44, 67, 83}, Row2: []int{12, 33, 58, 69, 88}, Row3: []int{9, 19, 37, 49, 74}},
+	testCard[2],
+}
+
+func TestReconcileGrid(t *testing.T) {
+	tests := []struct {
+		name  string
+		ocr   []model.Block
+		extra []model.OCRToken
+		ai    func(c []model.Block) []model.Block
+		// plain is set when the AI read the photo without the OCR reading,
+		// with confidence aiConf instead of 0.9.
+		plain   bool
+		aiConf  float64
+		want    []model.Block
+		reasons []string
+	}{
+		{
+			name: "agreement",
+			ocr:  testCard,
+			ai:   func(c []model.Block) []model.Block { return c },
+			want: testCard,
+		},
+		{
+			name: "OCR fills a number the AI missed",
+			ocr:  testCard,
+			ai: func(c []model.Block) []model.Block {
+				c[0].Row1 = []int{3, 14, 35, 71}
+				return c
+			},
+			want:    testCard,
+			reasons: []string{reasonOCRAdded},
+		},
+		{
+			name:  "OCR ignored in a full row",
+			ocr:   testCard,
+			extra: []model.OCRToken{placeToken("27", testLeft+2*testColPitch, testTop, 0)},
+			ai:    func(c []model.Block) []model.Block { return c },
+			want:  testCard,
+			// The AI already read 5 numbers in the row.
+			reasons: []string{reasonOCRIgnored},
+		},
+		{
+			name: "AI column clash with OCR",
+			ocr:  testCard,
+			ai: func(c []model.Block) []model.Block {
+				c[0].Row1 = []int{3, 14, 35, 52, 57, 71}
+				return c
+			},
+			want:    testCard,
+			reasons: []string{reasonAIColumnClash, reasonAIClashDropped},
+		},
+		{
+			name: "AI column clash where OCR saw nothing",
+			ocr:  testCard,
+			ai: func(c []model.Block) []model.Block {
+				c[0].Row1 = []int{3, 14, 24, 27, 35, 52, 71}
+				return c
+			},
+			want: func() []model.Block {
+				c := clone(testCard)
+				c[0].Row1 = []int{3, 14, 24, 35, 52, 71}
+				return c
+			}(),
+			reasons: []string{reasonAIColumnClash, reasonAIClashDropped},
+		},
+		{
+			name: "AI row of 4 against OCR row of 5",
+			ocr:  misreadCard,
+			ai: func(c []model.Block) []model.Block {
+				c[0].Row1 = []int{1, 22, 41, 81}
+				return c
+			},
+			want: func() []model.Block {
+				c := clone(misreadCard)
+				c[0].Row1 = []int{1, 22, 41, 61, 81}
+				return c
+			}(),
+			reasons: []string{reasonOCRAdded, reasonAIPreferred},
+		},
+		{
+			name:  "plain AI row disputed, OCR more confident",
+			ocr:   misreadCard,
+			plain: true, aiConf: 0.8,
+			ai: func(c []model.Block) []model.Block {
+				c[0].Row1 = []int{1, 22, 41, 81}
+				return c
+			},
+			want:    misreadCard,
+			reasons: []string{reasonOCRAdded, reasonDisputed},
+		},
+		{
+			name:  "plain AI row disputed, AI more confident",
+			ocr:   misreadCard,
+			plain: true, aiConf: 0.95,
+			ai: func(c []model.Block) []model.Block {
+				c[0].Row1 = []int{1, 22, 41, 81}
+				return c
+			},
+			want: func() []model.Block {
+				c := clone(misreadCard)
+				c[0].Row1 = []int{1, 22, 41, 61, 81}
+				return c
+			}(),
+			reasons: []string{reasonOCRAdded, reasonDisputed},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			grid := ReconstructGrid(append(cardTokens(tt.ocr, 0), tt.extra...))
+			if grid == nil || !grid.Complete() {
+				t.Fatalf("grid not reconstructed: %d blocks", blockCount(grid))
+			}
+			ocrResult := &model.OCRScanResult{Confidence: 0.9}
+			ai := &model.GPTScanResponse{LotteryType: "LOTO", Confidence: cmp.Or(tt.aiConf, 0.9), Blocks: tt.ai(clone(tt.ocr))}
+
+			got := reconcile(ocrResult, grid, ai, !tt.plain, zap.NewNop())
+			if !reflect.DeepEqual(got.Blocks, tt.want) {
+				t.Errorf("blocks = %v, want %v", got.Blocks, tt.want)
+			}
+			var reasons []string
+			for _, d := range got.Reconciliation {
+				reasons = append(reasons, d.Reason)
+			}
+			if !reflect.DeepEqual(reasons, tt.reasons) {
+				t.Errorf("reasons = %v, want %v (%+v)", reasons, tt.reasons, got.Reconciliation)
+			}
+			want := 0
+			for _, b := range tt.want {
+				want += len(b.Row1) + len(b.Row2) + len(b.Row3)
+			}
+			if n := len(got.AllNumbers); n != want {
+				t.Errorf("%d numbers, want %d", n, want)
+			}
+		})
+	}
+}
+
+func TestReconcileGridDroppedNumber(t *testing.T) {
+	grid := ReconstructGrid(cardTokens(testCard, 0))
+	blocks := clone(testCard)
+	blocks[0].Row1 = []int{3, 14, 35, 52, 57, 71}
+	ai := &model.GPTScanResponse{LotteryType: "LOTO", Confidence: 0.9, Blocks: blocks}
+
+	got := reconcile(&model.OCRScanResult{}, grid, ai, true, zap.NewNop())
+	want := []model.ReconcileDecision{
+		{Block: 1, Row: 1, Col: 6, OCR: 52, AI: 52, Chosen: 52, Source: model.CellSourceBoth, Reason: reasonAIColumnClash},
+		{Block: 1, Row: 1, Col: 6, OCR: 52, AI: 57, Source: model.CellSourceAI, Reason: reasonAIClashDropped},
+	}
+	if !reflect.DeepEqual(got.Reconciliation, want) {
+		t.Errorf("decisions = %+v, want %+v", got.Reconciliation, want)
+	}
+	for _, n := range got.AllNumbers {
+		if n == 57 {
+			t.Errorf("dropped %d kept in AllNumbers", n)
+		}
+	}
+}
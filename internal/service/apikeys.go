@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"loto/internal/auth"
+	"loto/internal/model"
+	"loto/internal/repository"
+)
+
+var (
+	ErrAPIKeyNotFound = NewError(ErrNotFound, "api_key_not_found", "api key not found")
+	ErrInvalidAPIKey  = NewError(ErrUnauthenticated, "invalid_api_key", "invalid api key")
+)
+
+// CreateAPIKey creates a partner key. Without a user ID in req the key gets
+// an account of its own, which owns the scans made with it.
+func (s *Service) CreateAPIKey(ctx context.Context, req model.CreateAPIKeyRequest) (*model.APIKeySecret, error) {
+	if !s.hasDB() {
+		return nil, errDatabaseDisabled
+	}
+	for _, scope := range req.Scopes {
+		if !slices.Contains(model.APIKeyScopes, scope) {
+			return nil, errInvalidAPIKeyReq.Withf("unknown scope %q, allowed: %v", scope, model.APIKeyScopes)
+		}
+	}
+
+	userID := req.UserID
+	if userID == "" {
+		user := &model.User{}
+		if err := s.repo.CreateUser(ctx, user); err != nil {
+			return nil, fmt.Errorf("failed to create api key account: %w", err)
+		}
+		userID = user.ID
+	} else if _, err := s.GetUser(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	key, prefix, hash, err := auth.NewAPIKey()
+	if err != nil {
+		return nil, err
+	}
+	record := &model.APIKey{
+		UserID: userID,
+		Name:   req.Name,
+		Prefix: prefix,
+		Scopes: slices.Compact(slices.Sorted(slices.Values(req.Scopes))),
+	}
+	if err := s.repo.CreateAPIKey(ctx, record, hash); err != nil {
+		return nil, fmt.Errorf("failed to save api key: %w", err)
+	}
+	s.logger.Info("api key created", zap.String("key_id", record.ID), zap.String("prefix", prefix), zap.Strings("scopes", record.Scopes))
+	return &model.APIKeySecret{APIKey: *record, Key: key}, nil
+}
+
+func (s *Service) ListAPIKeys(ctx context.Context) ([]model.APIKey, error) {
+	if !s.hasDB() {
+		return nil, errDatabaseDisabled
+	}
+	return s.repo.ListAPIKeys(ctx)
+}
+
+// RotateAPIKey issues a replacement with the same name, owner and scopes.
+// The old key keeps working for the grace period.
+func (s *Service) RotateAPIKey(ctx context.Context, keyID string, req model.RotateAPIKeyRequest) (*model.APIKeySecret, error) {
+	if !s.hasDB() {
+		return nil, errDatabaseDisabled
+	}
+	old, err := s.getAPIKey(ctx, keyID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key, prefix, hash, err := auth.NewAPIKey()
+	if err != nil {
+		return nil, err
+	}
+	next := &model.APIKey{UserID: old.UserID, Name: old.Name, Prefix: prefix, Scopes: old.Scopes}
+	grace := time.Duration(req.GraceHours) * time.Hour
+	if err := s.repo.RotateAPIKey(ctx, keyID, next, hash, grace); errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrAPIKeyNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to rotate api key: %w", err)
+	}
+	s.logger.Info("api key rotated", zap.String("key_id", keyID), zap.String("new_key_id", next.ID), zap.Duration("grace", grace))
+	return &model.APIKeySecret{APIKey: *next, Key: key}, nil
+}
+
+func (s *Service) RevokeAPIKey(ctx context.Context, keyID string) error {
+	if !s.hasDB() {
+		return errDatabaseDisabled
+	}
+	if uuid.Validate(keyID) != nil {
+		return ErrAPIKeyNotFound
+	}
+	if err := s.repo.RevokeAPIKey(ctx, keyID); errors.Is(err, repository.ErrNotFound) {
+		return ErrAPIKeyNotFound
+	} else if err != nil {
+		return err
+	}
+	s.logger.Info("api key revoked", zap.String("key_id", keyID))
+	return nil
+}
+
+// VerifyAPIKey returns the active key matching key.
+func (s *Service) VerifyAPIKey(ctx context.Context, key string) (*model.APIKey, error) {
+	if !s.hasDB() {
+		return nil, ErrInvalidAPIKey
+	}
+	k, err := s.repo.GetActiveAPIKey(ctx, auth.HashToken(key))
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrInvalidAPIKey
+	}
+	return k, err
+}
+
+// RecordAPIKeyUse counts a request made with a key; failures are only
+// logged, so usage accounting never fails a request.
+func (s *Service) RecordAPIKeyUse(ctx context.Context, keyID string, failed bool) {
+	if !s.hasDB() {
+		return
+	}
+	if err := s.repo.RecordAPIKeyUse(ctx, keyID, failed); err != nil {
+		s.logger.Error("failed to record api key use", zap.String("key_id", keyID), zap.Error(err))
+	}
+}
+
+func (s *Service) GetAPIKeyUsage(ctx context.Context, keyID string, from, to time.Time) ([]model.APIKeyUsage, error) {
+	if !s.hasDB() {
+		return nil, errDatabaseDisabled
+	}
+	if _, err := s.getAPIKey(ctx, keyID); errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrAPIKeyNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return s.repo.GetAPIKeyUsage(ctx, keyID, from, to)
+}
+
+func (s *Service) getAPIKey(ctx context.Context, keyID string) (*model.APIKey, error) {
+	if uuid.Validate(keyID) != nil {
+		return nil, repository.ErrNotFound
+	}
+	return s.repo.GetAPIKey(ctx, keyID)
+}
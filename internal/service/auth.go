@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"loto/internal/auth"
+	"loto/internal/model"
+	"loto/internal/repository"
+)
+
+var (
+	ErrInvalidCredentials  = NewError(ErrUnauthenticated, "invalid_credentials", "invalid email or password")
+	ErrEmailTaken          = NewError(ErrConflict, "email_taken", "email already registered")
+	ErrInvalidRefreshToken = NewError(ErrUnauthenticated, "invalid_refresh_token", "invalid or expired refresh token")
+	ErrAccountRegistered   = NewError(ErrConflict, "account_registered", "account already has an email")
+)
+
+func (s *Service) SetTokens(t *auth.Tokens) {
+	s.tokens = t
+}
+
+// Register creates an account with an email and password.
+func (s *Service) Register(ctx context.Context, req model.RegisterRequest) (*model.AuthResponse, error) {
+	if !s.hasDB() {
+		return nil, errDatabaseDisabled
+	}
+	hash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &model.User{Email: &req.Email, PasswordHash: &hash}
+	if err := s.repo.CreateUser(ctx, user); errors.Is(err, repository.ErrConflict) {
+		return nil, ErrEmailTaken
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+	s.logger.Info("user registered", zap.String("user_id", user.ID))
+	return s.issueTokens(ctx, user)
+}
+
+func (s *Service) Login(ctx context.Context, req model.LoginRequest) (*model.AuthResponse, error) {
+	if !s.hasDB() {
+		return nil, errDatabaseDisabled
+	}
+	user, err := s.repo.GetUserByEmail(ctx, req.Email)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user.PasswordHash == nil || !auth.CheckPassword(*user.PasswordHash, req.Password) {
+		return nil, ErrInvalidCredentials
+	}
+	return s.issueTokens(ctx, user)
+}
+
+// DeviceLogin logs in the anonymous account of an app install, creating it
+// on first use.
+func (s *Service) DeviceLogin(ctx context.Context, req model.DeviceRequest) (*model.AuthResponse, error) {
+	if !s.hasDB() {
+		return nil, errDatabaseDisabled
+	}
+	user, err := s.repo.GetUserByDeviceID(ctx, req.DeviceID)
+	if errors.Is(err, repository.ErrNotFound) {
+		user = &model.User{DeviceID: &req.DeviceID}
+		err = s.repo.CreateUser(ctx, user)
+		if errors.Is(err, repository.ErrConflict) {
+			// Another request for the same device created it first.
+			user, err = s.repo.GetUserByDeviceID(ctx, req.DeviceID)
+		} else if err == nil {
+			s.logger.Info("device account created", zap.String("user_id", user.ID))
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device account: %w", err)
+	}
+	return s.issueTokens(ctx, user)
+}
+
+// UpgradeAccount adds an email and password to the caller's anonymous device
+// account, keeping its user ID and scan history.
+func (s *Service) UpgradeAccount(ctx context.Context, userID string, req model.RegisterRequest) (*model.AuthResponse, error) {
+	if !s.hasDB() {
+		return nil, errDatabaseDisabled
+	}
+	hash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.repo.UpgradeUser(ctx, userID, req.Email, hash)
+	switch {
+	case errors.Is(err, repository.ErrConflict):
+		return nil, ErrEmailTaken
+	case errors.Is(err, repository.ErrNotFound):
+		return nil, ErrAccountRegistered
+	case err != nil:
+		return nil, fmt.Errorf("failed to upgrade account: %w", err)
+	}
+	s.logger.Info("device account upgraded", zap.String("user_id", user.ID))
+	return s.issueTokens(ctx, user)
+}
+
+// Refresh exchanges a refresh token for a new access and refresh token. The
+// old refresh token stops working.
+func (s *Service) Refresh(ctx context.Context, req model.RefreshRequest) (*model.AuthResponse, error) {
+	if !s.hasDB() {
+		return nil, errDatabaseDisabled
+	}
+	userID, err := s.repo.UseRefreshToken(ctx, auth.HashToken(req.RefreshToken))
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to use refresh token: %w", err)
+	}
+
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	return s.issueTokens(ctx, user)
+}
+
+// Logout revokes a refresh token. Access tokens stay valid until they expire.
+func (s *Service) Logout(ctx context.Context, req model.RefreshRequest) error {
+	if !s.hasDB() {
+		return errDatabaseDisabled
+	}
+	return s.repo.RevokeRefreshToken(ctx, auth.HashToken(req.RefreshToken))
+}
+
+func (s *Service) GetUser(ctx context.Context, userID string) (*model.User, error) {
+	if !s.hasDB() {
+		return nil, errDatabaseDisabled
+	}
+	if uuid.Validate(userID) != nil {
+		return nil, ErrUserNotFound
+	}
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrUserNotFound
+	}
+	return user, err
+}
+
+func (s *Service) issueTokens(ctx context.Context, user *model.User) (*model.AuthResponse, error) {
+	access, ttl, err := s.tokens.Access(user.ID, user.Anonymous)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign access token: %w", err)
+	}
+	refresh, hash, expires, err := s.tokens.Refresh()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create refresh token: %w", err)
+	}
+	if err := s.repo.SaveRefreshToken(ctx, user.ID, hash, expires); err != nil {
+		return nil, fmt.Errorf("failed to save refresh token: %w", err)
+	}
+	return &model.AuthResponse{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(ttl.Seconds()),
+		User:         user,
+	}, nil
+}
@@ -0,0 +1,321 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+
+	"loto/internal/config"
+	"loto/internal/model"
+	"loto/internal/repository"
+)
+
+var ErrBatchNotFound = NewError(ErrNotFound, "batch_not_found", "batch not found")
+
+const batchInterrupted = "interrupted by a server restart"
+
+// BatchImage is one image of a batch upload.
+type BatchImage struct {
+	Filename string
+	Data     []byte
+}
+
+// batchRunner runs batches in the background. Its limiter is shared by all
+// batches so concurrent batches together stay under the provider rate limit.
+type batchRunner struct {
+	cfg     config.BatchConfig
+	limiter *rate.Limiter
+
+	mu      sync.Mutex
+	batches map[string]*batch
+}
+
+type batch struct {
+	mu      sync.Mutex
+	resp    model.BatchResponse
+	expires time.Time
+}
+
+func newBatchRunner(cfg config.BatchConfig) *batchRunner {
+	cfg.Workers = max(1, cfg.Workers)
+	limit := rate.Inf
+	if cfg.RatePerMinute > 0 {
+		limit = rate.Limit(float64(cfg.RatePerMinute) / 60)
+	}
+	return &batchRunner{
+		cfg:     cfg,
+		limiter: rate.NewLimiter(limit, cfg.Workers),
+		batches: make(map[string]*batch),
+	}
+}
+
+func (s *Service) SetBatchConfig(cfg config.BatchConfig) {
+	s.batches = newBatchRunner(cfg)
+}
+
+// ResentBatch returns userID's batch with batchID when an upload is resent,
+// or nil when batchID is new. A batchID that is malformed or another user's
+// is an error, so it can be refused before the scans are counted.
+func (s *Service) ResentBatch(ctx context.Context, userID, batchID string) (*model.BatchResponse, error) {
+	if err := uuid.Validate(batchID); err != nil {
+		return nil, ErrInvalidBatch.Withf("invalid batch_id").Wrap(err)
+	}
+	existing, err := s.findBatch(ctx, batchID)
+	if errors.Is(err, ErrBatchNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if !ownedBy(existing, userID) {
+		return nil, errBatchIDInUse
+	}
+	return existing, nil
+}
+
+// StartBatch registers a batch and scans its images in the background, so the
+// batch keeps running when the client disconnects; progress and results are
+// read with GetBatch. A client that lost the response can resend the upload
+// with the same batchID: a batch that already exists is returned as is
+// instead of being scanned again. Batches belong to req.UserID.
+func (s *Service) StartBatch(ctx context.Context, batchID string, images []BatchImage, req model.ScanRequest) (*model.BatchResponse, error) {
+	if batchID != "" {
+		if existing, err := s.ResentBatch(ctx, req.UserID, batchID); err != nil || existing != nil {
+			return existing, err
+		}
+	} else {
+		batchID = uuid.NewString()
+	}
+
+	if len(images) == 0 {
+		return nil, ErrInvalidBatch.Withf("batch has no images")
+	}
+	if limit := s.batches.cfg.MaxImages; limit > 0 && len(images) > limit {
+		return nil, ErrInvalidBatch.Withf("batch has %d images, at most %d allowed", len(images), limit)
+	}
+
+	b := &batch{resp: model.BatchResponse{
+		BatchID:   batchID,
+		UserID:    &req.UserID,
+		Status:    model.BatchRunning,
+		Items:     make([]model.BatchItem, len(images)),
+		CreatedAt: time.Now().UTC(),
+	}}
+	for i, img := range images {
+		b.resp.Items[i] = model.BatchItem{Index: i + 1, Filename: img.Filename, Status: model.BatchPending}
+	}
+
+	s.batches.mu.Lock()
+	s.batches.evictExpired()
+	if existing, ok := s.batches.batches[batchID]; ok {
+		s.batches.mu.Unlock()
+		if resp := existing.snapshot(); ownedBy(resp, req.UserID) {
+			return resp, nil
+		}
+		return nil, errBatchIDInUse
+	}
+	s.batches.batches[batchID] = b
+	s.batches.mu.Unlock()
+
+	s.logger.Info("batch started", zap.String("batch_id", batchID), zap.Int("images", len(images)))
+	// Stored now as well as when it completes, so a resend is recognized
+	// after a restart.
+	resp := b.snapshot()
+	s.saveBatch(ctx, resp)
+	go s.runBatch(context.WithoutCancel(ctx), b, images, req)
+
+	return resp, nil
+}
+
+func (s *Service) saveBatch(ctx context.Context, resp *model.BatchResponse) {
+	if !s.hasDB() {
+		return
+	}
+	if err := s.repo.SaveBatch(ctx, resp); err != nil {
+		s.logger.Error("failed to save batch", zap.String("batch_id", resp.BatchID), zap.Error(err))
+	}
+}
+
+// GetBatch returns a running or finished batch of userID. Finished batches
+// are kept in memory for the configured retention and in the database when
+// available. Batches of other users are reported as not found.
+func (s *Service) GetBatch(ctx context.Context, userID, batchID string) (*model.BatchResponse, error) {
+	resp, err := s.findBatch(ctx, batchID)
+	if err == nil && !ownedBy(resp, userID) {
+		return nil, ErrBatchNotFound
+	}
+	return resp, err
+}
+
+func (s *Service) findBatch(ctx context.Context, batchID string) (*model.BatchResponse, error) {
+	s.batches.mu.Lock()
+	b, ok := s.batches.batches[batchID]
+	s.batches.mu.Unlock()
+	if ok {
+		return b.snapshot(), nil
+	}
+
+	if !s.hasDB() {
+		return nil, ErrBatchNotFound
+	}
+	resp, err := s.repo.GetBatch(ctx, batchID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrBatchNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if resp.Status == model.BatchRunning {
+		s.interruptBatch(ctx, resp)
+	}
+	return resp, nil
+}
+
+// interruptBatch finishes a batch stored as running that this process is not
+// running: the server stopped while scanning it, so its unfinished images
+// will never be scanned. They are marked failed and the batch is stored as
+// completed, so clients stop polling and can upload those images again.
+func (s *Service) interruptBatch(ctx context.Context, resp *model.BatchResponse) {
+	now := time.Now().UTC()
+	for i := range resp.Items {
+		if it := &resp.Items[i]; it.Status == model.BatchPending || it.Status == model.BatchRunning {
+			it.Status = model.BatchFailed
+			it.Error = batchInterrupted
+		}
+	}
+	resp.Status = model.BatchCompleted
+	resp.CompletedAt = &now
+	resp.Summary = summarizeBatch(resp.Items)
+
+	s.logger.Warn("batch interrupted by a restart", zap.String("batch_id", resp.BatchID), zap.Int("failed", resp.Summary.Failed))
+	s.saveBatch(ctx, resp)
+}
+
+func ownedBy(b *model.BatchResponse, userID string) bool {
+	return b.UserID != nil && *b.UserID == userID
+}
+
+func (s *Service) runBatch(ctx context.Context, b *batch, images []BatchImage, req model.ScanRequest) {
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(s.batches.cfg.Workers, len(images)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				s.runBatchItem(ctx, b, i, images[i], req)
+				images[i].Data = nil
+			}
+		}()
+	}
+	for i := range images {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	now := time.Now().UTC()
+	b.mu.Lock()
+	b.resp.Status = model.BatchCompleted
+	b.resp.CompletedAt = &now
+	b.expires = now.Add(s.batches.cfg.Retention)
+	b.mu.Unlock()
+
+	final := b.snapshot()
+	s.logger.Info("batch completed",
+		zap.String("batch_id", final.BatchID),
+		zap.Int("done", final.Summary.Done),
+		zap.Int("failed", final.Summary.Failed),
+		zap.Int("cards", final.Summary.Cards),
+	)
+	s.saveBatch(ctx, final)
+}
+
+func (s *Service) runBatchItem(ctx context.Context, b *batch, i int, img BatchImage, req model.ScanRequest) {
+	if err := s.batches.limiter.Wait(ctx); err != nil {
+		b.setItem(i, func(it *model.BatchItem) {
+			it.Status = model.BatchFailed
+			it.Error = err.Error()
+		})
+		return
+	}
+	b.setItem(i, func(it *model.BatchItem) { it.Status = model.BatchRunning })
+
+	result, err := s.scanImage(ctx, img.Data, img.Filename, req)
+	if err != nil {
+		s.logger.Warn("batch image failed", zap.Int("index", i+1), zap.String("filename", img.Filename), zap.Error(err))
+	}
+	b.setItem(i, func(it *model.BatchItem) {
+		if err != nil {
+			it.Status = model.BatchFailed
+			it.Error = err.Error()
+			return
+		}
+		it.Status = model.BatchDone
+		it.Result = result
+	})
+}
+
+func (b *batch) setItem(i int, update func(*model.BatchItem)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	update(&b.resp.Items[i])
+}
+
+// snapshot copies the batch and computes its summary.
+func (b *batch) snapshot() *model.BatchResponse {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	resp := b.resp
+	resp.Items = append([]model.BatchItem(nil), b.resp.Items...)
+	resp.Summary = summarizeBatch(resp.Items)
+	return &resp
+}
+
+func summarizeBatch(items []model.BatchItem) model.BatchSummary {
+	sum := model.BatchSummary{Total: len(items)}
+	for _, it := range items {
+		switch it.Status {
+		case model.BatchPending:
+			sum.Pending++
+		case model.BatchRunning:
+			sum.Running++
+		case model.BatchDone:
+			sum.Done++
+		case model.BatchFailed:
+			sum.Failed++
+		}
+		if it.Result == nil {
+			continue
+		}
+		for _, card := range it.Result.Cards {
+			sum.Cards++
+			switch card.Status {
+			case "confirmed":
+				sum.Confirmed++
+			case "needs_confirmation":
+				sum.NeedsConfirmation++
+			case "rejected":
+				sum.Rejected++
+			}
+		}
+	}
+	return sum
+}
+
+// evictExpired drops finished batches past their retention. Callers hold r.mu.
+func (r *batchRunner) evictExpired() {
+	now := time.Now()
+	for id, b := range r.batches {
+		b.mu.Lock()
+		expired := !b.expires.IsZero() && now.After(b.expires)
+		b.mu.Unlock()
+		if expired {
+			delete(r.batches, id)
+		}
+	}
+}
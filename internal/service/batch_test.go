@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"loto/internal/model"
+	"loto/internal/repository/memory"
+)
+
+func TestBatchInterruptedByRestart(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	userID, batchID := uuid.NewString(), uuid.NewString()
+
+	// What StartBatch stored before the server stopped mid-batch.
+	err := store.SaveBatch(ctx, &model.BatchResponse{
+		BatchID: batchID,
+		UserID:  &userID,
+		Status:  model.BatchRunning,
+		Items: []model.BatchItem{
+			{Index: 1, Filename: "a.jpg", Status: model.BatchDone},
+			{Index: 2, Filename: "b.jpg", Status: model.BatchRunning},
+			{Index: 3, Filename: "c.jpg", Status: model.BatchPending},
+		},
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := New(store, nil, zap.NewNop())
+	resp, err := s.StartBatch(ctx, batchID, []BatchImage{{Filename: "a.jpg"}}, model.ScanRequest{UserID: userID})
+	if err != nil {
+		t.Fatalf("resend: %v", err)
+	}
+	if resp.Status != model.BatchCompleted || resp.CompletedAt == nil {
+		t.Errorf("status = %s, completed_at = %v, want completed", resp.Status, resp.CompletedAt)
+	}
+	want := []string{model.BatchDone, model.BatchFailed, model.BatchFailed}
+	for i, it := range resp.Items {
+		if it.Status != want[i] {
+			t.Errorf("item %d status = %s, want %s", it.Index, it.Status, want[i])
+		}
+		if it.Status == model.BatchFailed && it.Error == "" {
+			t.Errorf("item %d failed without an error", it.Index)
+		}
+	}
+	if resp.Summary.Done != 1 || resp.Summary.Failed != 2 || resp.Summary.Running+resp.Summary.Pending != 0 {
+		t.Errorf("summary = %+v", resp.Summary)
+	}
+
+	stored, err := store.GetBatch(ctx, batchID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != model.BatchCompleted {
+		t.Errorf("stored status = %s, want completed", stored.Status)
+	}
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"loto/internal/repository"
+)
+
+// Kinds of domain error. Handlers map each kind to an HTTP status; match them
+// with errors.Is.
+var (
+	ErrNotFound            = errors.New("not found")
+	ErrInvalidInput        = errors.New("invalid input")
+	ErrUnauthenticated     = errors.New("unauthenticated")
+	ErrForbidden           = errors.New("forbidden")
+	ErrConflict            = errors.New("conflict")
+	ErrQuotaExceeded       = errors.New("quota exceeded")
+	ErrProviderUnavailable = errors.New("provider unavailable")
+	ErrDBDisabled          = errors.New("database disabled")
+	// ErrDBUnavailable is the store's own error, so that store errors
+	// returned as they are map to it too.
+	ErrDBUnavailable = repository.ErrUnavailable
+)
+
+// Error is a domain error of a Kind with a machine-readable Code, which
+// clients use to pick a localized message. Message is an English
+// description for logs and developers; Err is the underlying cause.
+type Error struct {
+	Kind    error
+	Code    string
+	Message string
+	Err     error
+}
+
+func NewError(kind error, code, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is matches the error's kind, so errors.Is(err, ErrNotFound) holds for
+// every not-found error, and other errors with the same code, so
+// errors.Is(err, ErrScanNotFound) holds for its wrapped copies.
+func (e *Error) Is(target error) bool {
+	if t, ok := target.(*Error); ok {
+		return t.Code == e.Code
+	}
+	return target == e.Kind
+}
+
+// Wrap returns a copy of e caused by err.
+func (e *Error) Wrap(err error) *Error {
+	out := *e
+	out.Err = err
+	return &out
+}
+
+// Withf returns a copy of e with a more specific message.
+func (e *Error) Withf(format string, args ...any) *Error {
+	out := *e
+	out.Message = fmt.Sprintf(format, args...)
+	return &out
+}
+
+var (
+	errDatabaseDisabled = NewError(ErrDBDisabled, "database_disabled", "database not configured")
+	errInvalidFile      = NewError(ErrInvalidInput, "unsupported_file_type", "unsupported file type")
+	errUnreadableImage  = NewError(ErrInvalidInput, "unreadable_image", "unreadable image")
+	errImageTooLarge    = NewError(ErrInvalidInput, "image_too_large", "image too large")
+	errAIUnavailable    = NewError(ErrProviderUnavailable, "ai_unavailable", "AI scan failed")
+	errBatchIDInUse     = NewError(ErrConflict, "batch_id_in_use", "invalid batch_id: already in use")
+	errInvalidAPIKeyReq = NewError(ErrInvalidInput, "invalid_api_key_request", "invalid api key request")
+	errInvalidCursor    = NewError(ErrInvalidInput, "invalid_cursor", "invalid cursor")
+
+	ErrInvalidBatch = NewError(ErrInvalidInput, "invalid_batch", "invalid batch")
+	ErrScanNotFound = NewError(ErrNotFound, "scan_not_found", "scan not found")
+	ErrUserNotFound = NewError(ErrNotFound, "user_not_found", "user not found")
+)
@@ -3,35 +3,71 @@ package service
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
-	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 
 	"loto/internal/ai"
+	"loto/internal/auth"
+	"loto/internal/config"
 	"loto/internal/model"
+	"loto/internal/preprocess"
+	"loto/internal/pricing"
+	"loto/internal/prompt"
 	"loto/internal/repository"
 	"loto/internal/scan"
 	"loto/internal/validator"
 )
 
 type Service struct {
-	repo   *repository.Repository
-	ai     ai.Scanner
-	hybrid *scan.HybridScanner
-	logger *zap.Logger
+	repo    repository.Store
+	ai      ai.Scanner
+	hybrid  *scan.HybridScanner
+	prices  *pricing.Table
+	prompts *prompt.Registry
+	images  *preprocess.Preprocessor
+	batches *batchRunner
+	tokens  *auth.Tokens
+	logger  *zap.Logger
 }
 
 func (s *Service) SetHybridScanner(hs *scan.HybridScanner) {
 	s.hybrid = hs
 }
 
-func New(repo *repository.Repository, aiClient ai.Scanner, logger *zap.Logger) *Service {
+func (s *Service) SetPriceTable(t *pricing.Table) {
+	s.prices = t
+}
+
+func (s *Service) SetPrompts(r *prompt.Registry) {
+	s.prompts = r
+}
+
+func (s *Service) SetPreprocessor(p *preprocess.Preprocessor) {
+	s.images = p
+}
+
+// New creates the service. Without a store, scans are not kept and the
+// features that need history are disabled.
+func New(repo repository.Store, aiClient ai.Scanner, logger *zap.Logger) *Service {
 	return &Service{
 		repo:   repo,
 		ai:     aiClient,
+		prices: pricing.Default(),
+		images: preprocess.New(config.PreprocessConfig{}),
+		batches: newBatchRunner(config.BatchConfig{
+			Workers:       4,
+			RatePerMinute: 30,
+			MaxImages:     100,
+			Retention:     24 * time.Hour,
+		}),
 		logger: logger,
 	}
 }
@@ -40,16 +76,40 @@ func (s *Service) hasDB() bool {
 	return s.repo != nil
 }
 
-func (s *Service) ScanTicket(ctx context.Context, file multipart.File, header *multipart.FileHeader, userID *string) (*model.ScanResponse, error) {
+// Health is "degraded" while the store cannot reach its database.
+func (s *Service) Health() model.HealthResponse {
+	resp := model.HealthResponse{Status: "ok"}
+	if r, ok := s.repo.(repository.HealthReporter); ok {
+		db := r.Health()
+		resp.Database = &db
+		if db.Status != model.DatabaseUp {
+			resp.Status = "degraded"
+		}
+	}
+	return resp
+}
+
+// ScanTicket scans an upload and returns the first card found. CardCount on
+// the response tells clients whether the photo held more; ScanTickets returns
+// them all.
+func (s *Service) ScanTicket(ctx context.Context, file multipart.File, header *multipart.FileHeader, req model.ScanRequest) (*model.ScanResponse, error) {
+	upload, err := s.ScanTickets(ctx, file, header, req)
+	if err != nil {
+		return nil, err
+	}
+	return &upload.Cards[0], nil
+}
+
+// ScanTickets scans every card in an uploaded photo. Each card is validated,
+// costed and persisted as its own scan; all share the upload ID.
+func (s *Service) ScanTickets(ctx context.Context, file multipart.File, header *multipart.FileHeader, req model.ScanRequest) (*model.UploadResponse, error) {
 	buf := make([]byte, 512)
 	n, err := file.Read(buf)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read file header: %w", err)
 	}
-	contentType := http.DetectContentType(buf[:n])
-
-	if err := validator.ValidateFileType(contentType); err != nil {
-		return nil, err
+	if err := validator.ValidateFileType(preprocess.DetectContentType(buf[:n])); err != nil {
+		return nil, errInvalidFile.Withf("%v", err)
 	}
 
 	if _, err := file.Seek(0, io.SeekStart); err != nil {
@@ -61,50 +121,256 @@ func (s *Service) ScanTicket(ctx context.Context, file multipart.File, header *m
 		return nil, fmt.Errorf("failed to read file: %w", err)
 	}
 
+	return s.scanImage(ctx, data, header.Filename, req)
+}
+
+// scanImage scans the cards in one uploaded image.
+func (s *Service) scanImage(ctx context.Context, data []byte, filename string, req model.ScanRequest) (*model.UploadResponse, error) {
+	var userID, apiKeyID *string
+	if req.UserID != "" {
+		userID = &req.UserID
+	}
+	if req.APIKeyID != "" {
+		apiKeyID = &req.APIKeyID
+	}
+
+	contentType := preprocess.DetectContentType(data)
+	if err := validator.ValidateFileType(contentType); err != nil {
+		return nil, errInvalidFile.Withf("%v", err)
+	}
+
+	if converted, mimeType, err := s.images.Normalize(data, contentType); errors.Is(err, preprocess.ErrTooLarge) {
+		return nil, errImageTooLarge.Withf("%v", err)
+	} else if err != nil {
+		return nil, errUnreadableImage.Withf("unreadable %s upload", contentType).Wrap(err)
+	} else if mimeType != contentType {
+		s.logger.Info("upload converted",
+			zap.String("from", contentType),
+			zap.String("to", mimeType),
+			zap.Int("bytes_before", len(data)),
+			zap.Int("bytes_after", len(converted)),
+		)
+		data, contentType = converted, mimeType
+	}
+
+	var steps []string
+	res, err := s.images.Process(data, contentType)
+	if errors.Is(err, preprocess.ErrTooLarge) {
+		return nil, errImageTooLarge.Withf("%v", err)
+	} else if err != nil {
+		s.logger.Warn("image preprocessing failed, using original upload", zap.Error(err))
+	} else if len(res.Steps) > 0 {
+		s.logger.Info("image preprocessed",
+			zap.Strings("steps", res.Steps),
+			zap.Int("width", res.Width),
+			zap.Int("height", res.Height),
+			zap.Int("bytes_before", len(data)),
+			zap.Int("bytes_after", len(res.Data)),
+		)
+		data, contentType, steps = res.Data, res.MimeType, res.Steps
+	}
+
 	b64 := base64.StdEncoding.EncodeToString(data)
 
-	var gptResp *model.GPTScanResponse
+	opts := prompt.Options{Locale: req.Locale}
+	if req.LotteryType == "LOTO" || req.LotteryType == "VN_6_DIGIT" {
+		opts.LotteryTypeHint = req.LotteryType
+	}
+	if s.prompts != nil {
+		key := req.UserID
+		if key == "" {
+			key = uuid.NewString()
+		}
+		opts.Version = s.prompts.Assign(key)
+	}
+	ctx = prompt.NewContext(ctx, opts)
+
+	started := time.Now()
+	var cards []*model.GPTScanResponse
 	if s.hybrid != nil {
-		gptResp, err = s.hybrid.Scan(ctx, data, b64, contentType)
+		cards, err = s.hybrid.ScanCards(ctx, data, b64, contentType)
 	} else {
+		var gptResp *model.GPTScanResponse
 		gptResp, err = s.ai.ScanTicket(ctx, b64, contentType)
+		cards = []*model.GPTScanResponse{gptResp}
 	}
 	if err != nil {
-		return nil, fmt.Errorf("AI scan failed: %w", err)
+		s.saveFailedScan(ctx, err, userID, apiKeyID, filename, opts.Version)
+		return nil, errAIUnavailable.Wrap(err)
+	}
+	took := time.Since(started)
+
+	upload := &model.UploadResponse{UploadID: uuid.NewString()}
+	for i, gptResp := range cards {
+		card := uploadCard{
+			uploadID: upload.UploadID,
+			index:    i + 1,
+			count:    len(cards),
+			userID:   userID,
+			apiKeyID: apiKeyID,
+			filename: filename,
+			steps:    steps,
+			took:     took,
+		}
+		resp, err := s.finishCard(ctx, gptResp, card)
+		if err != nil {
+			return nil, err
+		}
+		upload.Cards = append(upload.Cards, *resp)
+	}
+	return upload, nil
+}
+
+// saveFailedScan keeps a scan that failed after the provider billed for some
+// of its calls as rejected, so that its cost is not lost.
+func (s *Service) saveFailedScan(ctx context.Context, err error, userID, apiKeyID *string, filename, promptVersion string) {
+	usage := ai.FailedUsage(err)
+	if len(usage) == 0 || !s.hasDB() {
+		return
+	}
+	record := &model.Scan{
+		UserID:        userID,
+		APIKeyID:      apiKeyID,
+		ImageURL:      filename,
+		Status:        "rejected",
+		Notes:         err.Error(),
+		Provider:      usage[0].Provider,
+		Model:         usage[0].Model,
+		CostUSD:       s.prices.Apply(usage),
+		PromptVersion: promptVersion,
+		Path:          model.PathAIFailed,
+		CardIndex:     1,
+		Usage:         usage,
+	}
+	if err := s.repo.SaveScan(ctx, record); err != nil {
+		s.logger.Error("failed to save failed scan", zap.Error(err))
+	}
+}
+
+// uploadCard identifies one card of an upload.
+type uploadCard struct {
+	uploadID string
+	index    int
+	count    int
+	userID   *string
+	apiKeyID *string
+	filename string
+	steps    []string
+	took     time.Duration
+}
+
+// finishCard runs the structure check, costs, validates and persists one
+// scanned card.
+func (s *Service) finishCard(ctx context.Context, gptResp *model.GPTScanResponse, card uploadCard) (*model.ScanResponse, error) {
+	if gptResp.Mode == "" {
+		gptResp.Mode = model.ModeAI
+	}
+	if gptResp.Path == "" {
+		gptResp.Path = model.PathAI
+	}
+	s.logger.Info("scan pipeline completed",
+		zap.String("path", gptResp.Path),
+		zap.Duration("latency", card.took),
+		zap.Int("card", card.index),
+		zap.Int("cards", card.count),
+	)
+	scan.ApplyCorrections(gptResp)
+	scan.AnnotateCells(gptResp)
+
+	cost := s.prices.Apply(gptResp.Usage)
+	s.logger.Info("scan cost", zap.Float64("cost_usd", cost), zap.Int("provider_calls", len(gptResp.Usage)))
+
+	record := &model.Scan{
+		UserID:        card.userID,
+		APIKeyID:      card.apiKeyID,
+		ImageURL:      card.filename,
+		LotteryType:   gptResp.LotteryType,
+		Blocks:        gptResp.Blocks,
+		Confidence:    gptResp.Confidence,
+		Notes:         gptResp.Notes,
+		Provider:      gptResp.Provider,
+		Model:         gptResp.Model,
+		CostUSD:       cost,
+		PromptVersion: gptResp.PromptVersion,
+		Path:          gptResp.Path,
+		DurationMS:    card.took.Milliseconds(),
+		Preprocessing: card.steps,
+		UploadID:      &card.uploadID,
+		CardIndex:     card.index,
+		Usage:         gptResp.Usage,
+		OCRTokens:     gptResp.OCRTokens,
+		RawResponse:   gptResp.RawResponse,
+	}
+	if gptResp.TicketID != "" {
+		record.TicketID = &gptResp.TicketID
 	}
 
 	numbers, status, err := validator.ValidateScanResponse(gptResp)
+	record.ExtractedNumbers, record.Status = numbers, status
 	if err != nil {
 		s.logger.Warn("scan validation failed",
 			zap.Float64("confidence", gptResp.Confidence),
 			zap.Error(err),
 		)
+		// Rejected scans are kept, with the reason, so they show in the
+		// history and the prompt stats.
+		record.Notes = err.Error()
+		if s.hasDB() {
+			if err := s.repo.SaveScan(ctx, record); err != nil {
+				s.logger.Error("failed to save scan", zap.Error(err))
+				return nil, fmt.Errorf("failed to save scan: %w", err)
+			}
+		}
 		return &model.ScanResponse{
+			ScanID:      record.ID,
 			LotteryType: gptResp.LotteryType,
 			AllNumbers:  nil,
 			Confidence:  gptResp.Confidence,
 			Status:      status,
-			Notes:       err.Error(),
+			Notes:       record.Notes,
+
+			PromptVersion: gptResp.PromptVersion,
+			Path:          gptResp.Path,
+			Preprocessing: card.steps,
+			Violations:    gptResp.Violations,
+			Corrections:   gptResp.Corrections,
+			Cells:         gptResp.Cells,
+
+			Reconciliation: gptResp.Reconciliation,
+
+			UploadID:  card.uploadID,
+			CardIndex: card.index,
+			CardCount: card.count,
+			Region:    gptResp.Region,
 		}, nil
 	}
 
-	scan := &model.Scan{
-		UserID:           userID,
-		ImageURL:         header.Filename,
-		ExtractedNumbers: numbers,
-		Confidence:       gptResp.Confidence,
-		Status:           status,
+	fingerprint := scan.Fingerprint(gptResp.LotteryType, gptResp.Blocks)
+	if fingerprint != "" {
+		record.Fingerprint = &fingerprint
 	}
 
+	var duplicates []string
 	if s.hasDB() {
-		if err := s.repo.SaveScan(ctx, scan); err != nil {
+		if err := s.repo.SaveScan(ctx, record); err != nil {
 			s.logger.Error("failed to save scan", zap.Error(err))
 			return nil, fmt.Errorf("failed to save scan: %w", err)
 		}
+		// Scans queued while the database is down are not checked.
+		if duplicates, err = s.repo.FindDuplicates(ctx, record); errors.Is(err, repository.ErrUnavailable) {
+			duplicates = nil
+		} else if err != nil {
+			s.logger.Error("failed to check duplicate cards", zap.Error(err))
+		} else if len(duplicates) > 0 {
+			s.logger.Warn("card already registered by another user",
+				zap.String("scan_id", record.ID),
+				zap.Strings("reasons", duplicates),
+			)
+		}
 	}
 
 	return &model.ScanResponse{
-		ScanID:      scan.ID,
+		ScanID:      record.ID,
 		LotteryType: gptResp.LotteryType,
 		Blocks:      gptResp.Blocks,
 		AllNumbers:  numbers,
@@ -112,24 +378,182 @@ func (s *Service) ScanTicket(ctx context.Context, file multipart.File, header *m
 		Confidence:  gptResp.Confidence,
 		Status:      status,
 		Notes:       gptResp.Notes,
+
+		PromptVersion: gptResp.PromptVersion,
+		Path:          gptResp.Path,
+		Preprocessing: card.steps,
+		Violations:    gptResp.Violations,
+		Corrections:   gptResp.Corrections,
+		Cells:         gptResp.Cells,
+
+		Reconciliation: gptResp.Reconciliation,
+
+		UploadID:  card.uploadID,
+		CardIndex: card.index,
+		CardCount: card.count,
+		Region:    gptResp.Region,
+
+		Fingerprint: fingerprint,
+		Duplicates:  duplicates,
 	}, nil
 }
 
-func (s *Service) GetScanHistory(ctx context.Context, userID string) ([]model.ScanHistoryItem, error) {
+// historyPageSize is the number of scans per history page when the client
+// does not ask for a limit.
+const historyPageSize = 50
+
+// GetScanHistory returns a page of userID's scans, newest first.
+func (s *Service) GetScanHistory(ctx context.Context, userID string, q model.ScanHistoryQuery) (*model.ScanHistoryResponse, error) {
 	if !s.hasDB() {
-		return nil, fmt.Errorf("database not configured")
+		return nil, errDatabaseDisabled
+	}
+
+	f := repository.ScanFilter{
+		Status:        q.Status,
+		LotteryType:   q.LotteryType,
+		MinConfidence: q.MinConfidence,
+		Limit:         q.Limit,
+	}
+	if f.Limit == 0 {
+		f.Limit = historyPageSize
+	}
+	// Dates are validated by binding.
+	if q.From != "" {
+		f.From, _ = time.Parse(time.DateOnly, q.From)
+	}
+	if q.To != "" {
+		to, _ := time.Parse(time.DateOnly, q.To)
+		f.To = to.AddDate(0, 0, 1)
 	}
-	return s.repo.GetScansByUserID(ctx, userID)
+	if q.Cursor != "" {
+		var err error
+		if f.AfterTime, f.AfterID, err = decodeCursor(q.Cursor); err != nil {
+			return nil, errInvalidCursor.Wrap(err)
+		}
+	}
+
+	// One extra row tells whether there is a next page.
+	f.Limit++
+	items, err := s.repo.GetScansByUserID(ctx, userID, f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scan history: %w", err)
+	}
+	resp := &model.ScanHistoryResponse{Scans: items}
+	if len(items) == f.Limit {
+		resp.Scans = items[:len(items)-1]
+		last := resp.Scans[len(resp.Scans)-1]
+		resp.NextCursor = encodeCursor(last.CreatedAt, last.ID)
+	}
+	if resp.Scans == nil {
+		resp.Scans = []model.ScanHistoryItem{}
+	}
+	return resp, nil
 }
 
-func (s *Service) CheckResult(ctx context.Context, scanID string) (*model.CheckResultResponse, error) {
+// A history cursor is the creation time and ID of the last scan of a page.
+func encodeCursor(t time.Time, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(t.UnixMicro(), 10) + "." + id))
+}
+
+func decodeCursor(cursor string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	micros, id, ok := strings.Cut(string(raw), ".")
+	if !ok {
+		return time.Time{}, "", fmt.Errorf("malformed cursor")
+	}
+	usec, err := strconv.ParseInt(micros, 10, 64)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	if err := uuid.Validate(id); err != nil {
+		return time.Time{}, "", err
+	}
+	return time.UnixMicro(usec).UTC(), id, nil
+}
+
+// GetScan returns one of userID's scans as stored.
+func (s *Service) GetScan(ctx context.Context, userID, scanID string) (*model.ScanDetail, error) {
 	if !s.hasDB() {
-		return nil, fmt.Errorf("database not configured")
+		return nil, errDatabaseDisabled
+	}
+	sc, err := s.ownScan(ctx, userID, scanID)
+	if err != nil {
+		return nil, err
 	}
+	return &model.ScanDetail{
+		ID:               sc.ID,
+		UserID:           sc.UserID,
+		ImageURL:         sc.ImageURL,
+		LotteryType:      sc.LotteryType,
+		Blocks:           sc.Blocks,
+		ExtractedNumbers: sc.ExtractedNumbers,
+		Confidence:       sc.Confidence,
+		Status:           sc.Status,
+		Notes:            sc.Notes,
+		Provider:         sc.Provider,
+		Model:            sc.Model,
+		PromptVersion:    sc.PromptVersion,
+		Path:             sc.Path,
+		DurationMS:       sc.DurationMS,
+		Preprocessing:    sc.Preprocessing,
+		UploadID:         sc.UploadID,
+		CardIndex:        sc.CardIndex,
+		TicketID:         sc.TicketID,
+		CreatedAt:        sc.CreatedAt,
+	}, nil
+}
 
+// GetScanByID returns any user's scan as stored, with its cost, usage, API
+// key and fingerprint, for admins.
+func (s *Service) GetScanByID(ctx context.Context, scanID string) (*model.Scan, error) {
+	if !s.hasDB() {
+		return nil, errDatabaseDisabled
+	}
+	if uuid.Validate(scanID) != nil {
+		return nil, ErrScanNotFound
+	}
+	sc, err := s.repo.GetScanByID(ctx, scanID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrScanNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scan: %w", err)
+	}
+	return sc, nil
+}
+
+// ownScan loads a scan of userID. Scans of other users are reported as not
+// found.
+func (s *Service) ownScan(ctx context.Context, userID, scanID string) (*model.Scan, error) {
+	if uuid.Validate(scanID) != nil {
+		return nil, ErrScanNotFound
+	}
 	scan, err := s.repo.GetScanByID(ctx, scanID)
+	if err == nil && (scan.UserID == nil || *scan.UserID != userID) {
+		err = repository.ErrNotFound
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrScanNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scan: %w", err)
+	}
+	return scan, nil
+}
+
+// CheckResult checks a scan of userID against the lottery results. Scans of
+// other users are reported as not found.
+func (s *Service) CheckResult(ctx context.Context, userID, scanID string) (*model.CheckResultResponse, error) {
+	if !s.hasDB() {
+		return nil, errDatabaseDisabled
+	}
+
+	scan, err := s.ownScan(ctx, userID, scanID)
 	if err != nil {
-		return nil, fmt.Errorf("scan not found: %w", err)
+		return nil, err
 	}
 
 	lotteryResults, err := s.repo.FindMatchingResults(ctx, scan.ExtractedNumbers)
@@ -159,3 +583,24 @@ func (s *Service) CheckResult(ctx context.Context, scanID string) (*model.CheckR
 		Matches: matches,
 	}, nil
 }
+
+func (s *Service) GetDailyUsage(ctx context.Context, from, to time.Time) ([]model.UsageAggregate, error) {
+	if !s.hasDB() {
+		return nil, errDatabaseDisabled
+	}
+	return s.repo.GetDailyUsage(ctx, from, to)
+}
+
+func (s *Service) GetPromptStats(ctx context.Context, from, to time.Time) ([]model.PromptStats, error) {
+	if !s.hasDB() {
+		return nil, errDatabaseDisabled
+	}
+	return s.repo.GetPromptStats(ctx, from, to)
+}
+
+func (s *Service) GetSuspiciousCards(ctx context.Context, from, to time.Time) ([]model.SuspiciousCard, error) {
+	if !s.hasDB() {
+		return nil, errDatabaseDisabled
+	}
+	return s.repo.GetSuspiciousCards(ctx, from, to)
+}
@@ -41,10 +41,10 @@ func ValidateScanResponse(resp *model.GPTScanResponse) ([]int, string, error) {
 
 func ValidateFileType(contentType string) error {
 	switch contentType {
-	case "image/jpeg", "image/png":
+	case "image/jpeg", "image/png", "image/webp", "image/heic", "application/pdf":
 		return nil
 	default:
-		return fmt.Errorf("unsupported file type: %s (only jpg/png allowed)", contentType)
+		return fmt.Errorf("unsupported file type: %s (only jpg/png/webp/heic/pdf allowed)", contentType)
 	}
 }
 
@@ -69,3 +69,116 @@ func ValidateLOTOGrid(blocks []model.Block) error {
 
 	return nil
 }
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// DecadeColumn is the 1-based card column a LOTO number is printed in: 1-9 in
+// column 1, 10-19 in column 2, ..., 80-90 in column 9.
+func DecadeColumn(n int) int {
+	return min(n/10, 8) + 1
+}
+
+// ValidateLOTOCard checks the full card structure and returns every
+// violation found. Column order within a block is only a warning: many
+// printed decks sort columns top to bottom, but not all of them do.
+func ValidateLOTOCard(blocks []model.Block) []model.CellViolation {
+	var out []model.CellViolation
+
+	if len(blocks) != 3 {
+		out = append(out, model.CellViolation{
+			Rule:     "block_count",
+			Severity: SeverityError,
+			Message:  fmt.Sprintf("expected 3 blocks, got %d", len(blocks)),
+		})
+	}
+
+	type pos struct{ block, row, index int }
+	seen := make(map[int]pos)
+
+	for b, block := range blocks {
+		rows := [][]int{block.Row1, block.Row2, block.Row3}
+		colRow := make(map[int][]int)
+
+		for r, row := range rows {
+			if len(row) != 5 {
+				out = append(out, model.CellViolation{
+					Block:    b + 1,
+					Row:      r + 1,
+					Rule:     "row_count",
+					Severity: SeverityError,
+					Message:  fmt.Sprintf("block %d row %d: expected 5 numbers, got %d", b+1, r+1, len(row)),
+				})
+			}
+
+			cols := make(map[int]int)
+			for i, n := range row {
+				v := model.CellViolation{Block: b + 1, Row: r + 1, Index: i + 1, Number: n, Severity: SeverityError}
+
+				if n < 1 || n > 90 {
+					v.Rule = "range"
+					v.Message = fmt.Sprintf("block %d row %d: number %d out of range 1-90", b+1, r+1, n)
+					out = append(out, v)
+					continue
+				}
+
+				col := DecadeColumn(n)
+				if j, ok := cols[col]; ok {
+					v.Rule = "column_conflict"
+					v.Message = fmt.Sprintf("block %d row %d: %d and %d both belong in column %d", b+1, r+1, row[j], n, col)
+					out = append(out, v)
+				} else {
+					cols[col] = i
+				}
+
+				if i > 0 && row[i-1] >= n {
+					v.Rule = "row_order"
+					v.Severity = SeverityWarning
+					v.Message = fmt.Sprintf("block %d row %d: %d listed after %d", b+1, r+1, n, row[i-1])
+					out = append(out, v)
+				}
+
+				if p, ok := seen[n]; ok {
+					v.Rule = "duplicate"
+					v.Severity = SeverityError
+					v.Message = fmt.Sprintf("number %d appears in block %d row %d and block %d row %d", n, p.block, p.row, b+1, r+1)
+					out = append(out, v)
+				} else {
+					seen[n] = pos{b + 1, r + 1, i + 1}
+				}
+
+				colRow[col] = append(colRow[col], n)
+			}
+		}
+
+		for col := 1; col <= 9; col++ {
+			nums := colRow[col]
+			for i := 1; i < len(nums); i++ {
+				if nums[i] <= nums[i-1] {
+					out = append(out, model.CellViolation{
+						Block:    b + 1,
+						Number:   nums[i],
+						Rule:     "column_order",
+						Severity: SeverityWarning,
+						Message:  fmt.Sprintf("block %d column %d: %d below %d", b+1, col, nums[i], nums[i-1]),
+					})
+				}
+			}
+		}
+	}
+
+	return out
+}
+
+// CountErrors returns how many violations have error severity.
+func CountErrors(violations []model.CellViolation) int {
+	n := 0
+	for _, v := range violations {
+		if v.Severity == SeverityError {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,67 @@
+package validator
+
+import (
+	"reflect"
+	"testing"
+
+	"loto/internal/model"
+)
+
+func validCard() []model.Block {
+	return []model.Block{
+		{Row1: []int{3, 14, 35, 52, 71}, Row2: []int{21, 40, 56, 63, 85}, Row3: []int{7, 18, 29, 47, 78}},
+		{Row1: []int{1, 26, 44, 67, 80}, Row2: []int{12, 33, 58, 69, 88}, Row3: []int{9, 19, 37, 49, 74}},
+		{Row1: []int{5, 23, 51, 60, 82}, Row2: []int{16, 30, 45, 65, 77}, Row3: []int{8, 28, 39, 54, 90}},
+	}
+}
+
+func TestValidateLOTOCard(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(c []model.Block) []model.Block
+		rules  []string
+		errors int
+	}{
+		{"valid", func(c []model.Block) []model.Block { return c }, nil, 0},
+		{"block count", func(c []model.Block) []model.Block { return c[:2] }, []string{"block_count"}, 1},
+		{"row count", func(c []model.Block) []model.Block {
+			c[0].Row1 = c[0].Row1[:4]
+			return c
+		}, []string{"row_count"}, 1},
+		{"range", func(c []model.Block) []model.Block {
+			c[2].Row1[4] = 95
+			return c
+		}, []string{"range"}, 1},
+		{"column conflict", func(c []model.Block) []model.Block {
+			c[0].Row1[4] = 53
+			return c
+		}, []string{"column_conflict"}, 1},
+		{"duplicate", func(c []model.Block) []model.Block {
+			c[2].Row1[4] = 88
+			return c
+		}, []string{"duplicate"}, 1},
+		{"row order", func(c []model.Block) []model.Block {
+			c[0].Row1[0], c[0].Row1[1] = 14, 3
+			return c
+		}, []string{"row_order"}, 0},
+		{"column order", func(c []model.Block) []model.Block {
+			c[0].Row1[1], c[0].Row3[1] = 18, 14
+			return c
+		}, []string{"column_order"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ValidateLOTOCard(tt.change(validCard()))
+			var rules []string
+			for _, v := range got {
+				rules = append(rules, v.Rule)
+			}
+			if !reflect.DeepEqual(rules, tt.rules) {
+				t.Errorf("rules = %v, want %v", rules, tt.rules)
+			}
+			if n := CountErrors(got); n != tt.errors {
+				t.Errorf("%d errors, want %d", n, tt.errors)
+			}
+		})
+	}
+}
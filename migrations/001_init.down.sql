@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS lottery_results;
+DROP TABLE IF EXISTS scans;
+DROP TABLE IF EXISTS users;
@@ -15,8 +15,8 @@ CREATE TABLE IF NOT EXISTS scans (
     created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
 );
 
-CREATE INDEX idx_scans_user_id ON scans(user_id);
-CREATE INDEX idx_scans_created_at ON scans(created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_scans_user_id ON scans(user_id);
+CREATE INDEX IF NOT EXISTS idx_scans_created_at ON scans(created_at DESC);
 
 CREATE TABLE IF NOT EXISTS lottery_results (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
@@ -26,5 +26,5 @@ CREATE TABLE IF NOT EXISTS lottery_results (
     winning_number TEXT NOT NULL
 );
 
-CREATE INDEX idx_lottery_results_winning_number ON lottery_results(winning_number);
-CREATE INDEX idx_lottery_results_date ON lottery_results(date DESC);
+CREATE INDEX IF NOT EXISTS idx_lottery_results_winning_number ON lottery_results(winning_number);
+CREATE INDEX IF NOT EXISTS idx_lottery_results_date ON lottery_results(date DESC);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS scan_usage;
+
+ALTER TABLE scans DROP COLUMN IF EXISTS cost_usd;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_scans_prompt_version;
+
+ALTER TABLE scans DROP COLUMN IF EXISTS prompt_version;
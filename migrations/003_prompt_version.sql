@@ -0,0 +1,3 @@
+ALTER TABLE scans ADD COLUMN IF NOT EXISTS prompt_version TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_scans_prompt_version ON scans(prompt_version, created_at DESC);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_scans_scan_path;
+
+ALTER TABLE scans DROP COLUMN IF EXISTS duration_ms;
+ALTER TABLE scans DROP COLUMN IF EXISTS scan_path;
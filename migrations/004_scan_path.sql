@@ -0,0 +1,4 @@
+ALTER TABLE scans ADD COLUMN IF NOT EXISTS scan_path TEXT NOT NULL DEFAULT '';
+ALTER TABLE scans ADD COLUMN IF NOT EXISTS duration_ms BIGINT NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_scans_scan_path ON scans(scan_path, created_at DESC);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_scans_upload_id;
+
+ALTER TABLE scans DROP COLUMN IF EXISTS card_index;
+ALTER TABLE scans DROP COLUMN IF EXISTS upload_id;
@@ -0,0 +1,4 @@
+ALTER TABLE scans ADD COLUMN IF NOT EXISTS upload_id UUID;
+ALTER TABLE scans ADD COLUMN IF NOT EXISTS card_index INT NOT NULL DEFAULT 1;
+
+CREATE INDEX IF NOT EXISTS idx_scans_upload_id ON scans(upload_id);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS scan_batches (
+    id UUID PRIMARY KEY,
+    status TEXT NOT NULL,
+    summary JSONB NOT NULL DEFAULT '{}',
+    items JSONB NOT NULL DEFAULT '[]',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    completed_at TIMESTAMPTZ
+);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_scans_ticket_id;
+DROP INDEX IF EXISTS idx_scans_card_fingerprint;
+
+ALTER TABLE scans DROP COLUMN IF EXISTS ticket_id;
+ALTER TABLE scans DROP COLUMN IF EXISTS card_fingerprint;
@@ -0,0 +1,5 @@
+ALTER TABLE scans ADD COLUMN IF NOT EXISTS card_fingerprint TEXT;
+ALTER TABLE scans ADD COLUMN IF NOT EXISTS ticket_id TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_scans_card_fingerprint ON scans(card_fingerprint) WHERE card_fingerprint IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_scans_ticket_id ON scans(ticket_id) WHERE ticket_id IS NOT NULL;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_scans_api_key_id;
+ALTER TABLE scans DROP COLUMN IF EXISTS api_key_id;
+
+DROP TABLE IF EXISTS api_key_usage;
+DROP TABLE IF EXISTS api_keys;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS quota_counters;
+DROP TABLE IF EXISTS rate_buckets;
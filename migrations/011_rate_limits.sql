@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS rate_buckets (
+    key TEXT PRIMARY KEY,
+    tokens DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS quota_counters (
+    key TEXT PRIMARY KEY,
+    used BIGINT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_rate_buckets_expires_at ON rate_buckets(expires_at);
+CREATE INDEX IF NOT EXISTS idx_quota_counters_expires_at ON quota_counters(expires_at);
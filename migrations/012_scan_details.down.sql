@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_scans_user_history;
+
+ALTER TABLE scans DROP COLUMN IF EXISTS notes;
+ALTER TABLE scans DROP COLUMN IF EXISTS blocks;
+ALTER TABLE scans DROP COLUMN IF EXISTS lottery_type;
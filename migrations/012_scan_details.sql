@@ -0,0 +1,6 @@
+ALTER TABLE scans ADD COLUMN IF NOT EXISTS lottery_type TEXT NOT NULL DEFAULT '';
+ALTER TABLE scans ADD COLUMN IF NOT EXISTS blocks JSONB NOT NULL DEFAULT '[]';
+ALTER TABLE scans ADD COLUMN IF NOT EXISTS notes TEXT NOT NULL DEFAULT '';
+
+-- Scan history pages through a user's scans newest first.
+CREATE INDEX IF NOT EXISTS idx_scans_user_history ON scans(user_id, created_at DESC, id DESC);
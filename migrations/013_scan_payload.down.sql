@@ -0,0 +1,4 @@
+ALTER TABLE scans DROP COLUMN IF EXISTS raw_response;
+ALTER TABLE scans DROP COLUMN IF EXISTS ocr_tokens;
+ALTER TABLE scans DROP COLUMN IF EXISTS model;
+ALTER TABLE scans DROP COLUMN IF EXISTS provider;
@@ -0,0 +1,6 @@
+ALTER TABLE scans ADD COLUMN IF NOT EXISTS provider TEXT NOT NULL DEFAULT '';
+ALTER TABLE scans ADD COLUMN IF NOT EXISTS model TEXT NOT NULL DEFAULT '';
+
+-- Raw OCR tokens and model output, kept for debugging.
+ALTER TABLE scans ADD COLUMN IF NOT EXISTS ocr_tokens JSONB NOT NULL DEFAULT '[]';
+ALTER TABLE scans ADD COLUMN IF NOT EXISTS raw_response TEXT NOT NULL DEFAULT '';
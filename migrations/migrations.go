@@ -0,0 +1,9 @@
+// Package migrations embeds the SQL migrations applied by internal/migrate.
+// NNN_name.sql moves the schema up to version NNN and NNN_name.down.sql, when
+// present, back to the version before it.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
@@ -8,12 +8,88 @@ const getBaseUrl = () => {
 
 const API_URL = getBaseUrl();
 
+interface Session {
+  access_token: string;
+  refresh_token: string;
+}
+
+// Anonymous device account for this install. The ID is kept for the app
+// session only; persisting it would keep the scan history across launches.
+const DEVICE_ID = Array.from({ length: 32 }, () =>
+  Math.floor(Math.random() * 16).toString(16)
+).join("");
+
+let session: Session | null = null;
+
+async function postAuth(path: string, body: object): Promise<Session | null> {
+  const response = await fetch(`${API_URL}/auth/${path}`, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(body),
+  });
+  return response.ok ? response.json() : null;
+}
+
+async function login(): Promise<Session> {
+  if (session) {
+    const refreshed = await postAuth("refresh", { refresh_token: session.refresh_token });
+    if (refreshed) {
+      return (session = refreshed);
+    }
+  }
+  const created = await postAuth("device", { device_id: DEVICE_ID });
+  if (!created) {
+    throw new Error("Login failed");
+  }
+  return (session = created);
+}
+
+// authorizedFetch sends the access token, logging in first and once more when
+// the token has expired.
+async function authorizedFetch(path: string, init: RequestInit): Promise<Response> {
+  const send = (s: Session) =>
+    fetch(`${API_URL}${path}`, {
+      ...init,
+      headers: {
+        ...init.headers,
+        Authorization: `Bearer ${s.access_token}`,
+        "Accept-Language": "vi",
+      },
+    });
+
+  const response = await send(session ?? (await login()));
+  if (response.status !== 401) {
+    return response;
+  }
+  return send(await login());
+}
+
+// ApiError is the body of every error response; message is localized from
+// Accept-Language.
+interface ApiError {
+  error?: {
+    code: string;
+    message: string;
+    request_id: string;
+  };
+}
+
 export interface Block {
   row1: number[];
   row2: number[];
   row3: number[];
 }
 
+export interface CellDetail {
+  block: number;
+  row: number;
+  index: number;
+  col: number;
+  number: number;
+  confidence: number;
+  source: "ocr" | "ai" | "both" | "corrected";
+}
+
 export interface ScanResult {
   scan_id?: string;
   lottery_type: string;
@@ -23,14 +99,37 @@ export interface ScanResult {
   confidence: number;
   status: string;
   notes?: string;
+  cells?: CellDetail[];
+  upload_id?: string;
+  card_index?: number;
+  card_count?: number;
 }
 
+export const UNCERTAIN_CELL_CONFIDENCE = 0.7;
+
+export function uncertainNumbers(result: ScanResult): Set<number> {
+  const out = new Set<number>();
+  for (const cell of result.cells ?? []) {
+    if (cell.confidence < UNCERTAIN_CELL_CONFIDENCE || cell.source === "corrected") {
+      out.add(cell.number);
+    }
+  }
+  return out;
+}
+
+const MIME_TYPES: Record<string, string> = {
+  png: "image/png",
+  webp: "image/webp",
+  heic: "image/heic",
+  pdf: "application/pdf",
+};
+
 export async function scanTicket(imageUri: string): Promise<ScanResult> {
   const formData = new FormData();
 
   const filename = imageUri.split("/").pop() || "ticket.jpg";
   const ext = filename.split(".").pop()?.toLowerCase();
-  const mimeType = ext === "png" ? "image/png" : "image/jpeg";
+  const mimeType = MIME_TYPES[ext ?? ""] ?? "image/jpeg";
 
   if (Platform.OS === "web") {
     const resp = await fetch(imageUri);
@@ -47,15 +146,15 @@ export async function scanTicket(imageUri: string): Promise<ScanResult> {
   const controller = new AbortController();
   const timeout = setTimeout(() => controller.abort(), 90000);
 
-  const response = await fetch(`${API_URL}/scan-ticket`, {
+  const response = await authorizedFetch("/scan-ticket", {
     method: "POST",
     body: formData,
     signal: controller.signal,
   }).finally(() => clearTimeout(timeout));
 
   if (!response.ok) {
-    const err = await response.json();
-    throw new Error(err.error || "Scan failed");
+    const err: ApiError = await response.json().catch(() => ({}));
+    throw new Error(err.error?.message || "Không thể quét vé số");
   }
 
   return response.json();
@@ -20,6 +20,7 @@ function TicketRow({
   cellWidth,
   cellHeight,
   matched,
+  uncertain,
   onToggle,
   colors,
 }: {
@@ -27,6 +28,7 @@ function TicketRow({
   cellWidth: number;
   cellHeight: number;
   matched: Set<number>;
+  uncertain: Set<number>;
   onToggle: (n: number) => void;
   colors: TicketColors;
 }) {
@@ -35,6 +37,7 @@ function TicketRow({
     <View className="flex-row" style={{ gap: GAP, marginBottom: GAP }}>
       {cells.map((n, i) => {
         const isMatched = n !== null && matched.has(n);
+        const isUncertain = n !== null && !isMatched && uncertain.has(n);
         if (n !== null) {
           return (
             <Pressable
@@ -46,7 +49,12 @@ function TicketRow({
                 height: cellHeight,
                 backgroundColor: isMatched ? "#E53935" : "#fff",
                 borderWidth: 2,
-                borderColor: isMatched ? "#7f1d1d" : "#E65100",
+                borderColor: isMatched
+                  ? "#7f1d1d"
+                  : isUncertain
+                    ? "#FBC02D"
+                    : "#E65100",
+                borderStyle: isUncertain ? "dashed" : "solid",
                 borderRadius: 6,
               }}
             >
@@ -89,6 +97,7 @@ function TicketBlock({
   cellWidth,
   cellHeight,
   matched,
+  uncertain,
   onToggle,
   colors,
 }: {
@@ -97,6 +106,7 @@ function TicketBlock({
   cellWidth: number;
   cellHeight: number;
   matched: Set<number>;
+  uncertain: Set<number>;
   onToggle: (n: number) => void;
   colors: TicketColors;
 }) {
@@ -110,6 +120,7 @@ function TicketBlock({
         cellWidth={cellWidth}
         cellHeight={cellHeight}
         matched={matched}
+        uncertain={uncertain}
         onToggle={onToggle}
         colors={colors}
       />
@@ -118,6 +129,7 @@ function TicketBlock({
         cellWidth={cellWidth}
         cellHeight={cellHeight}
         matched={matched}
+        uncertain={uncertain}
         onToggle={onToggle}
         colors={colors}
       />
@@ -126,6 +138,7 @@ function TicketBlock({
         cellWidth={cellWidth}
         cellHeight={cellHeight}
         matched={matched}
+        uncertain={uncertain}
         onToggle={onToggle}
         colors={colors}
       />
@@ -138,6 +151,7 @@ export default function TicketCard({
   ticketId,
   confidence,
   matched,
+  uncertain = new Set<number>(),
   onToggle,
   colors,
   isLandscape = false,
@@ -146,6 +160,7 @@ export default function TicketCard({
   ticketId?: string;
   confidence: number;
   matched: Set<number>;
+  uncertain?: Set<number>;
   onToggle: (n: number) => void;
   colors: TicketColors;
   isLandscape?: boolean;
@@ -206,6 +221,7 @@ export default function TicketCard({
           cellWidth={cellWidth}
           cellHeight={cellHeight}
           matched={matched}
+          uncertain={uncertain}
           onToggle={onToggle}
           colors={colors}
         />
@@ -1,4 +1,4 @@
-import { useState, useRef, useCallback, useEffect } from "react";
+import { useState, useRef, useCallback, useEffect, useMemo } from "react";
 import {
   View,
   Text,
@@ -20,7 +20,7 @@ import Animated, {
 import * as ImagePicker from "expo-image-picker";
 import ConfettiCannon from "react-native-confetti-cannon";
 import { Audio } from "expo-av";
-import { scanTicket, ScanResult } from "../api/client";
+import { scanTicket, ScanResult, uncertainNumbers } from "../api/client";
 import TicketCard from "../components/TicketCard";
 import { useImageColors } from "../hooks/useImageColors";
 import { Ionicons } from "@expo/vector-icons";
@@ -121,6 +121,10 @@ export default function HomeScreen() {
   }, [soundEnabled]);
 
   const scanned = result && result.blocks && result.blocks.length > 0;
+  const uncertain = useMemo(
+    () => (result ? uncertainNumbers(result) : new Set<number>()),
+    [result],
+  );
 
   const checkRowWin = useCallback(
     (newMatched: Set<number>) => {
@@ -635,6 +639,7 @@ export default function HomeScreen() {
                       blocks={result.blocks!}
                       ticketId={result.ticket_id}
                       confidence={result.confidence}
+                      uncertain={uncertain}
                       matched={matched}
                       onToggle={handleToggle}
                       colors={ticketColors}
@@ -700,6 +705,7 @@ export default function HomeScreen() {
                       blocks={result.blocks!}
                       ticketId={result.ticket_id}
                       confidence={result.confidence}
+                      uncertain={uncertain}
                       matched={matched}
                       onToggle={handleToggle}
                       colors={ticketColors}